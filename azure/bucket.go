@@ -0,0 +1,837 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	pathSeparator     rune = '/'
+	copyPollInterval       = 100 * time.Millisecond
+	defaultMaxBuffers      = 4
+	defaultBufferSize      = 4 * 1024 * 1024
+)
+
+type (
+	Bucket struct {
+		name      string
+		config    Config
+		service   azblob.ServiceURL
+		container azblob.ContainerURL
+	}
+
+	Config struct {
+		accountName string
+		accountKey  string
+		endpoint    string
+		credential  azblob.Credential
+		pipeline    pipeline.Pipeline
+		maxRetries  int
+	}
+
+	Option func(cfg *Config)
+
+	writer struct {
+		pw   *io.PipeWriter
+		done chan error
+		err  error
+	}
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		marker azblob.Marker
+		queue  []bucketly.Item
+		loaded bool
+		done   bool
+	}
+)
+
+func WithAccountName(accountName string) Option {
+	return func(cfg *Config) {
+		cfg.accountName = accountName
+	}
+}
+
+func WithAccountKey(accountKey string) Option {
+	return func(cfg *Config) {
+		cfg.accountKey = accountKey
+	}
+}
+
+// WithEndpoint sets the URL of the blob service, e.g. http://127.0.0.1:10000/devstoreaccount1 for Azurite.
+// It defaults to https://<account>.blob.core.windows.net.
+func WithEndpoint(endpoint string) Option {
+	return func(cfg *Config) {
+		cfg.endpoint = endpoint
+	}
+}
+
+func WithCredential(credential azblob.Credential) Option {
+	return func(cfg *Config) {
+		cfg.credential = credential
+	}
+}
+
+func WithPipeline(p pipeline.Pipeline) Option {
+	return func(cfg *Config) {
+		cfg.pipeline = p
+	}
+}
+
+func WithMaxRetries(maxRetries int) Option {
+	return func(cfg *Config) {
+		cfg.maxRetries = maxRetries
+	}
+}
+
+func NewBucket(name string, opts ...Option) (*Bucket, error) {
+	cfg := Config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.endpoint == "" {
+		if cfg.accountName == "" {
+			return nil, errors.New("bucket cannot be created because account name and endpoint are missing")
+		}
+
+		cfg.endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.accountName)
+	}
+
+	u, err := url.Parse(cfg.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid endpoint "%s": %w`, cfg.endpoint, err)
+	}
+
+	p := cfg.pipeline
+	if p == nil {
+		credential := cfg.credential
+		if credential == nil {
+			if cfg.accountName == "" || cfg.accountKey == "" {
+				return nil, errors.New("bucket cannot be created because credentials are missing")
+			}
+
+			credential, err = azblob.NewSharedKeyCredential(cfg.accountName, cfg.accountKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		po := azblob.PipelineOptions{}
+		if cfg.maxRetries > 0 {
+			po.Retry.MaxTries = int32(cfg.maxRetries + 1)
+		}
+
+		p = azblob.NewPipeline(credential, po)
+	}
+
+	service := azblob.NewServiceURL(*u, p)
+
+	return &Bucket{
+		name:      name,
+		config:    cfg,
+		service:   service,
+		container: service.NewContainerURL(name),
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	resp, err := b.container.NewBlobURL(key).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return resp.Body(azblob.RetryReaderOptions{MaxRetryRequests: b.config.maxRetries}), nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, dir, err := b.key(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if dir {
+		return 0, fmt.Errorf("%s is a directory", name)
+	}
+
+	if err := b.upload(ctx, key, data, wo.Metadata); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{
+		BufferSize: defaultBufferSize,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	pr, pw := io.Pipe()
+	w := &writer{
+		pw:   pw,
+		done: make(chan error, 1),
+	}
+
+	go func() {
+		_, err := azblob.UploadStreamToBlockBlob(ctx, pr, b.container.NewBlockBlobURL(key), azblob.UploadStreamToBlockBlobOptions{
+			BufferSize: wo.BufferSize,
+			MaxBuffers: defaultMaxBuffers,
+			Metadata:   azblob.Metadata(wo.Metadata),
+		})
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		item := bucketly.NewItem(b, string(pathSeparator))
+		item.SetDir(true)
+		item.SetMetadata(bucketly.Metadata{})
+
+		return item, nil
+	}
+
+	if !dir {
+		item, err := b.stat(ctx, key)
+		if !isNotExists(err) {
+			return item, err
+		}
+	}
+
+	item, err := b.stat(ctx, dirKey(key))
+	if !isNotExists(err) {
+		return item, err
+	}
+
+	// there is no marker, the directory still exists if there are blobs under its prefix
+	resp, err := b.container.ListBlobsFlatSegment(ctx, azblob.Marker{}, azblob.ListBlobsSegmentOptions{
+		Prefix:     dirKey(key),
+		MaxResults: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Segment.BlobItems) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	dirItem := bucketly.NewItem(b, dirKey(key))
+	dirItem.SetDir(true)
+	dirItem.SetModeTime(resp.Segment.BlobItems[0].Properties.LastModified)
+	dirItem.SetMetadata(bucketly.Metadata{})
+
+	return dirItem, nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, _, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	return b.upload(ctx, dirKey(key), []byte{}, wo.Metadata)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	key, _, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	var current []string
+	for _, token := range strings.Split(key, string(pathSeparator)) {
+		current = append(current, token)
+		if err := b.Mkdir(ctx, strings.Join(current, string(pathSeparator)), opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	if !dir {
+		err := b.delete(ctx, key)
+		if !isNotExists(err) {
+			return err
+		}
+	}
+
+	return convertError(b.delete(ctx, dirKey(key)))
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if !dir {
+		if err := b.delete(ctx, key); err != nil && !isNotExists(err) {
+			return err
+		}
+	}
+
+	prefix := ""
+	if key != "" {
+		prefix = dirKey(key)
+	}
+
+	return b.listAll(ctx, prefix, func(blobName string) error {
+		if err := b.delete(ctx, blobName); err != nil && !isNotExists(err) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	item, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	fromKey, _, err := b.key(item.Name())
+	if err != nil {
+		return err
+	}
+
+	toKey, _, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if fromKey == "" || toKey == "" {
+		return fmt.Errorf("cannot rename %s to %s", from, to)
+	}
+
+	if !item.IsDir() {
+		if err := b.copyBlob(ctx, b.container.NewBlobURL(fromKey), toKey, co.Metadata); err != nil {
+			return err
+		}
+
+		return b.delete(ctx, fromKey)
+	}
+
+	if strings.HasPrefix(dirKey(toKey), dirKey(fromKey)) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	err = b.listAll(ctx, dirKey(fromKey), func(blobName string) error {
+		dest := dirKey(toKey) + strings.TrimPrefix(blobName, dirKey(fromKey))
+
+		return b.copyBlob(ctx, b.container.NewBlobURL(blobName), dest, co.Metadata)
+	})
+	if err != nil {
+		return err
+	}
+
+	// implicit directories have no marker, the destination still needs to show up as a directory
+	if err := b.MkdirAll(ctx, toKey); err != nil {
+		return err
+	}
+
+	return b.RemoveAll(ctx, dirKey(fromKey))
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.MkdirAll(ctx, to, bucketly.WithWriteMetadata(co.Metadata))
+	}
+
+	toKey, dir, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if dir {
+		return fmt.Errorf("%s is a directory", to)
+	}
+
+	// blobs of the same storage account are copied server side
+	if src, ok := from.Bucket().(*Bucket); ok && src.service.String() == b.service.String() {
+		fromKey, _, err := src.key(from.Name())
+		if err != nil {
+			return err
+		}
+
+		return b.copyBlob(ctx, src.container.NewBlobURL(fromKey), toKey, co.Metadata)
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	r, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := b.NewWriter(ctx, toKey, bucketly.WithWriteMetadata(co.Metadata))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.(*writer).abort(err)
+
+		return err
+	}
+
+	return w.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, name string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	if _, _, err := b.key(name); err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	key, _, err := b.key(dir)
+	if err != nil {
+		return err
+	}
+
+	var items []bucketly.Item
+	marker := azblob.Marker{}
+	for marker.NotDone() {
+		var page []bucketly.Item
+		page, marker, err = b.listDir(ctx, key, marker)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, page...)
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listDir returns one page of the children of the key directory, sorted by name.
+func (b *Bucket) listDir(ctx context.Context, key string, marker azblob.Marker) ([]bucketly.Item, azblob.Marker, error) {
+	prefix := ""
+	if key != "" {
+		prefix = dirKey(key)
+	}
+
+	resp, err := b.container.ListBlobsHierarchySegment(ctx, marker, string(pathSeparator), azblob.ListBlobsSegmentOptions{
+		Prefix:  prefix,
+		Details: azblob.BlobListingDetails{Metadata: true},
+	})
+	if err != nil {
+		return nil, marker, err
+	}
+
+	items := make([]bucketly.Item, 0, len(resp.Segment.BlobItems)+len(resp.Segment.BlobPrefixes))
+	for _, p := range resp.Segment.BlobPrefixes {
+		item := bucketly.NewItem(b, p.Name)
+		item.SetDir(true)
+		items = append(items, item)
+	}
+
+	for _, blob := range resp.Segment.BlobItems {
+		// the marker of the directory itself
+		if blob.Name == prefix {
+			continue
+		}
+
+		item := bucketly.NewItem(b, blob.Name)
+		item.SetDir(isDirPath(blob.Name))
+		item.SetModeTime(blob.Properties.LastModified)
+		item.SetETag(string(blob.Properties.Etag))
+		item.SetMetadata(toMetadata(blob.Metadata))
+		if blob.Properties.ContentLength != nil {
+			item.SetSize(*blob.Properties.ContentLength)
+		}
+
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name() < items[j].Name()
+	})
+
+	return items, resp.NextMarker, nil
+}
+
+func (b *Bucket) listAll(ctx context.Context, prefix string, fn func(blobName string) error) error {
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := b.container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
+			Prefix: prefix,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, blob := range resp.Segment.BlobItems {
+			if err := fn(blob.Name); err != nil {
+				return err
+			}
+		}
+
+		marker = resp.NextMarker
+	}
+
+	return nil
+}
+
+func (b *Bucket) stat(ctx context.Context, key string) (bucketly.Item, error) {
+	resp, err := b.container.NewBlobURL(key).GetProperties(ctx, azblob.BlobAccessConditions{})
+	if err != nil {
+		return nil, err
+	}
+
+	item := bucketly.NewItem(b, key)
+	item.SetDir(isDirPath(key))
+	item.SetSize(resp.ContentLength())
+	item.SetModeTime(resp.LastModified())
+	item.SetETag(string(resp.ETag()))
+	item.SetMetadata(toMetadata(resp.NewMetadata()))
+
+	return item, nil
+}
+
+func (b *Bucket) upload(ctx context.Context, key string, data []byte, metadata bucketly.Metadata) error {
+	_, err := b.container.NewBlockBlobURL(key).Upload(
+		ctx,
+		bytes.NewReader(data),
+		azblob.BlobHTTPHeaders{},
+		azblob.Metadata(metadata),
+		azblob.BlobAccessConditions{},
+	)
+
+	return err
+}
+
+func (b *Bucket) delete(ctx context.Context, key string) error {
+	_, err := b.container.NewBlobURL(key).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+
+	return err
+}
+
+// copyBlob copies the source blob server side and waits for the copy to finish. The metadata of the
+// source is kept unless a new one is given.
+func (b *Bucket) copyBlob(ctx context.Context, src azblob.BlobURL, toKey string, metadata bucketly.Metadata) error {
+	dest := b.container.NewBlobURL(toKey)
+	resp, err := dest.StartCopyFromURL(
+		ctx,
+		src.URL(),
+		azblob.Metadata(metadata),
+		azblob.ModifiedAccessConditions{},
+		azblob.BlobAccessConditions{},
+	)
+	if err != nil {
+		return convertError(err)
+	}
+
+	status := resp.CopyStatus()
+	for status == azblob.CopyStatusPending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(copyPollInterval):
+		}
+
+		props, err := dest.GetProperties(ctx, azblob.BlobAccessConditions{})
+		if err != nil {
+			return err
+		}
+
+		status = props.CopyStatus()
+	}
+
+	if status != azblob.CopyStatusSuccess {
+		return fmt.Errorf("copy of %s to %s ended with status %s", src.String(), toKey, status)
+	}
+
+	return nil
+}
+
+// key turns a bucket path into a blob name. The root directory has the empty key and dir reports
+// whether the path explicitly refers to a directory.
+func (b *Bucket) key(name string) (key string, dir bool, err error) {
+	dir = isDirPath(name)
+	name, err = bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", false, err
+	}
+
+	key = strings.Trim(name, string(pathSeparator))
+
+	return key, dir || key == "", nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.done == nil {
+		return w.err
+	}
+
+	w.pw.Close()
+	w.err = <-w.done
+	w.done = nil
+
+	return w.err
+}
+
+// abort fails the upload so that no partial blob is committed.
+func (w *writer) abort(err error) {
+	w.pw.CloseWithError(err)
+	if w.done != nil {
+		<-w.done
+		w.done = nil
+	}
+	w.err = err
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	for len(i.queue) == 0 {
+		if i.done {
+			return nil, io.EOF
+		}
+
+		if err := i.load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) load(ctx context.Context) error {
+	if !i.loaded {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return err
+		}
+
+		i.loaded = true
+		if !item.IsDir() {
+			i.queue = []bucketly.Item{item}
+			i.done = true
+
+			return nil
+		}
+
+		key, _, err := i.bucket.key(item.Name())
+		if err != nil {
+			return err
+		}
+		i.name = key
+	}
+
+	items, marker, err := i.bucket.listDir(ctx, i.name, i.marker)
+	if err != nil {
+		return err
+	}
+
+	i.queue = items
+	i.marker = marker
+	i.done = !marker.NotDone()
+
+	return nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+	i.done = true
+
+	return nil
+}
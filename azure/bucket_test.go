@@ -0,0 +1,93 @@
+package azure_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/azure"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewBucket(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := azure.NewBucket("test")
+	a.Error(err)
+
+	_, err = azure.NewBucket("test", azure.WithAccountName("account"))
+	a.Error(err)
+
+	_, err = azure.NewBucket("test", azure.WithAccountName("account"), azure.WithAccountKey("not base64"))
+	a.Error(err)
+
+	bucket, err := azure.NewBucket("test", azure.WithAccountName("account"), azure.WithAccountKey("a2V5"))
+	if a.NoError(err) {
+		a.Equal("test", bucket.Name())
+	}
+}
+
+func TestBucket_MetadataAndStreaming(t *testing.T) {
+	if os.Getenv("AZURE_STORAGE_ACCOUNT") == "" {
+		t.Skip("AZURE_STORAGE_ACCOUNT is not set")
+	}
+
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket, err := azure.NewBucket(
+		"bucketly-"+uuid.New().String(),
+		azure.WithAccountName(os.Getenv("AZURE_STORAGE_ACCOUNT")),
+		azure.WithAccountKey(os.Getenv("AZURE_STORAGE_KEY")),
+		azure.WithEndpoint(os.Getenv("AZURE_STORAGE_ENDPOINT")),
+	)
+	if !a.NoError(err) {
+		return
+	}
+
+	manager := azure.NewBucketManager(bucket)
+	if !a.NoError(manager.Create(ctx)) {
+		return
+	}
+	defer manager.Remove(ctx)
+
+	// a buffer smaller than the content makes the writer upload several blocks
+	content := strings.Repeat("0123456789", 100)
+	w, err := bucket.NewWriter(
+		ctx,
+		"foo/bar.txt",
+		bucketly.WithWriteMetadata(bucketly.Metadata{"foo": "bar"}),
+		bucketly.WithWriteBufferSize(64),
+	)
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = w.Write([]byte(content))
+	a.NoError(err)
+	if !a.NoError(w.Close()) {
+		return
+	}
+
+	data, err := bucket.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal(content, string(data))
+	}
+
+	a.NoError(bucket.Copy2(ctx, "foo/bar.txt", "baz.txt"))
+	item, err := bucket.Stat(ctx, "baz.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err := item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+	}
+
+	etag, err := item.ETag()
+	if a.NoError(err) {
+		a.NotEmpty(etag)
+	}
+}
@@ -0,0 +1,41 @@
+package azure
+
+import (
+	"context"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+type (
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+func (m *BucketManager) Create(ctx context.Context) error {
+	_, err := m.bucket.container.Create(ctx, azblob.Metadata{}, azblob.PublicAccessNone)
+	if err != nil {
+		if err, ok := err.(azblob.StorageError); ok {
+			if err.ServiceCode() == azblob.ServiceCodeContainerAlreadyExists {
+				return nil
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m *BucketManager) Remove(ctx context.Context) error {
+	_, err := m.bucket.container.Delete(ctx, azblob.ContainerAccessConditions{})
+
+	return err
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, "/")
+}
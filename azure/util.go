@@ -0,0 +1,52 @@
+package azure
+
+import (
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/vcraescu/bucketly"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func isNotExists(err error) bool {
+	serr, ok := err.(azblob.StorageError)
+	if !ok {
+		return false
+	}
+
+	if serr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		return true
+	}
+
+	return serr.Response() != nil && serr.Response().StatusCode == http.StatusNotFound
+}
+
+func convertError(err error) error {
+	if isNotExists(err) {
+		return os.ErrNotExist
+	}
+
+	return err
+}
+
+func isDirPath(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return true
+	}
+
+	return strings.HasSuffix(name, string(pathSeparator))
+}
+
+func dirKey(key string) string {
+	return key + string(pathSeparator)
+}
+
+func toMetadata(metadata azblob.Metadata) bucketly.Metadata {
+	m := make(bucketly.Metadata, len(metadata))
+	for k, v := range metadata {
+		m[k] = v
+	}
+
+	return m
+}
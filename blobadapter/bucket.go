@@ -0,0 +1,658 @@
+package blobadapter
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"gocloud.dev/blob"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const pathSeparator rune = '/'
+
+type (
+	Bucket struct {
+		name   string
+		bucket *blob.Bucket
+	}
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		iter   *blob.ListIterator
+		done   bool
+	}
+)
+
+func NewBucket(name string, bucket *blob.Bucket) *Bucket {
+	return &Bucket{
+		name:   name,
+		bucket: bucket,
+	}
+}
+
+// OpenBucket opens the bucket behind a gocloud URL (e.g. mem://, file:///tmp/dir, gs://name).
+// The driver of the URL scheme has to be registered by importing its package.
+func OpenBucket(ctx context.Context, urlstr string) (*Bucket, error) {
+	bucket, err := blob.OpenBucket(ctx, urlstr)
+	if err != nil {
+		return nil, fmt.Errorf(`error opening bucket "%s": %w`, urlstr, err)
+	}
+
+	return NewBucket(urlstr, bucket), nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+func (b *Bucket) Blob() *blob.Bucket {
+	return b.bucket
+}
+
+func (b *Bucket) Close() error {
+	return b.bucket.Close()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	r, err := b.bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return r, nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.Close()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	w, err := b.bucket.NewWriter(ctx, key, &blob.WriterOptions{
+		Metadata:   wo.Metadata,
+		BufferSize: wo.BufferSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`error creating writer for path "%s": %w`, name, err)
+	}
+
+	return w, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		item := bucketly.NewItem(b, string(pathSeparator))
+		item.SetDir(true)
+		item.SetMetadata(bucketly.Metadata{})
+
+		return item, nil
+	}
+
+	if !dir {
+		attrs, err := b.bucket.Attributes(ctx, key)
+		if err == nil {
+			return b.attributesToItem(key, attrs), nil
+		}
+
+		if !isNotExists(err) {
+			return nil, err
+		}
+	}
+
+	return b.statDir(ctx, key)
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, _, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	return b.bucket.WriteAll(ctx, dirKey(key), []byte{}, &blob.WriterOptions{
+		Metadata:    wo.Metadata,
+		ContentType: "application/x-directory",
+	})
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	key, _, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	var current []string
+	for _, token := range strings.Split(key, string(pathSeparator)) {
+		current = append(current, token)
+		if err := b.Mkdir(ctx, strings.Join(current, string(pathSeparator)), opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	if !dir {
+		err := b.bucket.Delete(ctx, key)
+		if !isNotExists(err) {
+			return err
+		}
+	}
+
+	return convertError(b.bucket.Delete(ctx, dirKey(key)))
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if !dir {
+		if err := b.bucket.Delete(ctx, key); err != nil && !isNotExists(err) {
+			return err
+		}
+	}
+
+	prefix := ""
+	if key != "" {
+		prefix = dirKey(key)
+	}
+
+	iter := b.bucket.List(&blob.ListOptions{Prefix: prefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := b.bucket.Delete(ctx, obj.Key); err != nil && !isNotExists(err) {
+			return err
+		}
+	}
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	item, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	fromKey, _, err := b.key(item.Name())
+	if err != nil {
+		return err
+	}
+
+	toKey, _, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if fromKey == "" || toKey == "" {
+		return fmt.Errorf("cannot rename %s to %s", from, to)
+	}
+
+	if !item.IsDir() {
+		if err := b.copyKey(ctx, fromKey, toKey, co.Metadata); err != nil {
+			return err
+		}
+
+		return b.bucket.Delete(ctx, fromKey)
+	}
+
+	if strings.HasPrefix(dirKey(toKey), dirKey(fromKey)) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	iter := b.bucket.List(&blob.ListOptions{Prefix: dirKey(fromKey)})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		metadata := co.Metadata
+		if strings.HasSuffix(obj.Key, string(pathSeparator)) {
+			metadata = nil
+		}
+
+		dest := dirKey(toKey) + strings.TrimPrefix(obj.Key, dirKey(fromKey))
+		if err := b.copyKey(ctx, obj.Key, dest, metadata); err != nil {
+			return err
+		}
+	}
+
+	// implicit directories have no marker, the destination still needs to show up as a directory
+	if err := b.MkdirAll(ctx, toKey); err != nil {
+		return err
+	}
+
+	return b.RemoveAll(ctx, dirKey(fromKey))
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.MkdirAll(ctx, to, bucketly.WithWriteMetadata(co.Metadata))
+	}
+
+	if src, ok := from.Bucket().(*Bucket); ok && src == b {
+		fromKey, _, err := b.key(from.Name())
+		if err != nil {
+			return err
+		}
+
+		toKey, dir, err := b.key(to)
+		if err != nil {
+			return err
+		}
+
+		if dir {
+			return fmt.Errorf("%s is a directory", to)
+		}
+
+		return b.copyKey(ctx, fromKey, toKey, co.Metadata)
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return b.copyFrom(ctx, src, to, co.Metadata)
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, name string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	if _, _, err := b.key(name); err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	key, _, err := b.key(dir)
+	if err != nil {
+		return err
+	}
+
+	items, err := b.readDir(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) readDir(ctx context.Context, key string) ([]bucketly.Item, error) {
+	iter := b.list(key)
+
+	var items []bucketly.Item
+	for {
+		item, err := b.nextItem(ctx, iter, key)
+		if err == io.EOF {
+			return items, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+}
+
+func (b *Bucket) list(key string) *blob.ListIterator {
+	prefix := ""
+	if key != "" {
+		prefix = dirKey(key)
+	}
+
+	return b.bucket.List(&blob.ListOptions{
+		Prefix:    prefix,
+		Delimiter: string(pathSeparator),
+	})
+}
+
+// nextItem returns the next child of the key directory, skipping the marker of the directory itself.
+func (b *Bucket) nextItem(ctx context.Context, iter *blob.ListIterator, key string) (bucketly.Item, error) {
+	for {
+		obj, err := iter.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != "" && obj.Key == dirKey(key) {
+			continue
+		}
+
+		item := bucketly.NewItem(b, obj.Key)
+		item.SetDir(obj.IsDir || strings.HasSuffix(obj.Key, string(pathSeparator)))
+		item.SetSize(obj.Size)
+		item.SetModeTime(obj.ModTime)
+		if len(obj.MD5) > 0 {
+			item.SetETag(fmt.Sprintf(`"%x"`, obj.MD5))
+		}
+
+		return item, nil
+	}
+}
+
+func (b *Bucket) statDir(ctx context.Context, key string) (bucketly.Item, error) {
+	attrs, err := b.bucket.Attributes(ctx, dirKey(key))
+	if err == nil {
+		return b.attributesToItem(dirKey(key), attrs), nil
+	}
+
+	if !isNotExists(err) {
+		return nil, err
+	}
+
+	// there is no marker, the directory still exists if there are objects under its prefix
+	obj, err := b.bucket.List(&blob.ListOptions{Prefix: dirKey(key)}).Next(ctx)
+	if err == io.EOF {
+		return nil, os.ErrNotExist
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	item := bucketly.NewItem(b, dirKey(key))
+	item.SetDir(true)
+	item.SetModeTime(obj.ModTime)
+	item.SetMetadata(bucketly.Metadata{})
+
+	return item, nil
+}
+
+func (b *Bucket) attributesToItem(key string, attrs *blob.Attributes) bucketly.Item {
+	item := bucketly.NewItem(b, key)
+	item.SetDir(strings.HasSuffix(key, string(pathSeparator)))
+	item.SetSize(attrs.Size)
+	item.SetModeTime(attrs.ModTime)
+	item.SetETag(etag(attrs))
+	item.SetSys(attrs)
+
+	metadata := make(bucketly.Metadata, len(attrs.Metadata))
+	for k, v := range attrs.Metadata {
+		metadata[k] = v
+	}
+	item.SetMetadata(metadata)
+
+	return item
+}
+
+// copyKey copies an object inside the bucket. The provider copies it server side unless the metadata
+// has to be replaced, which gocloud can only do by rewriting the object.
+func (b *Bucket) copyKey(ctx context.Context, fromKey, toKey string, metadata bucketly.Metadata) error {
+	if metadata == nil {
+		return convertError(b.bucket.Copy(ctx, toKey, fromKey, nil))
+	}
+
+	r, err := b.bucket.NewReader(ctx, fromKey, nil)
+	if err != nil {
+		return convertError(err)
+	}
+	defer r.Close()
+
+	return b.copyFrom(ctx, r, toKey, metadata)
+}
+
+func (b *Bucket) copyFrom(ctx context.Context, src io.Reader, to string, metadata bucketly.Metadata) error {
+	dest, err := b.NewWriter(ctx, to, bucketly.WithWriteMetadata(metadata))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+// key turns a bucket path into an object key. The root directory has the empty key and dir reports
+// whether the path explicitly refers to a directory.
+func (b *Bucket) key(name string) (key string, dir bool, err error) {
+	dir = isDirPath(name)
+	name, err = bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", false, err
+	}
+
+	key = strings.Trim(name, string(pathSeparator))
+
+	return key, dir || key == "", nil
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.done {
+		return nil, io.EOF
+	}
+
+	if i.iter == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.done = true
+
+			return item, nil
+		}
+
+		key, _, err := i.bucket.key(item.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		i.name = key
+		i.iter = i.bucket.list(key)
+	}
+
+	item, err := i.bucket.nextItem(ctx, i.iter, i.name)
+	if err == io.EOF {
+		i.done = true
+	}
+
+	return item, err
+}
+
+func (i *listIterator) Close() error {
+	i.done = true
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package blobadapter_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/blobadapter"
+	_ "gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/memblob"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOpenBucket(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bucketly-blob-")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	bucket, err := blobadapter.OpenBucket(ctx, "file://"+dir)
+	if !a.NoError(err) {
+		return
+	}
+	defer bucket.Close()
+
+	_, err = bucket.Write(ctx, "foo/bar.txt", []byte("12345"))
+	if !a.NoError(err) {
+		return
+	}
+
+	content, err := bucket.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	item, err := bucket.Stat(ctx, "foo")
+	if a.NoError(err) {
+		a.True(item.IsDir())
+	}
+
+	_, err = blobadapter.OpenBucket(ctx, "unknown://bucket")
+	a.Error(err)
+}
+
+func TestBucket_MetadataAndETag(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := blobadapter.NewBucket("test", memblob.OpenBucket(nil))
+
+	_, err := bucket.Write(ctx, "foo/bar.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"foo": "bar"}))
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err := bucket.Stat(ctx, "foo/bar.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err := item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+	}
+
+	etag, err := item.ETag()
+	if a.NoError(err) {
+		a.Equal(`"827ccb0eea8a706c4c34a16891f84e7b"`, etag)
+	}
+
+	a.NoError(bucket.Copy2(ctx, "foo/bar.txt", "baz.txt"))
+	item, err = bucket.Stat(ctx, "baz.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err = item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+	}
+
+	a.NoError(bucket.Copy2(ctx, "foo/bar.txt", "qux.txt", bucketly.WithCopyMetadata(bucketly.Metadata{"foo": "baz"})))
+	item, err = bucket.Stat(ctx, "qux.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err = item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "baz"}, metadata)
+	}
+}
+
+func TestBucket_ImplicitDirs(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := blobadapter.NewBucket("test", memblob.OpenBucket(nil))
+
+	// objects written without bucketly have no directory markers
+	if !a.NoError(bucket.Blob().WriteAll(ctx, "foo/bar/baz.txt", []byte("12345"), nil)) {
+		return
+	}
+
+	item, err := bucket.Stat(ctx, "foo/bar")
+	if a.NoError(err) {
+		a.True(item.IsDir())
+	}
+
+	var actual []string
+	err = bucket.Walk(ctx, "/", func(item bucketly.Item, err error) error {
+		actual = append(actual, strings.TrimSuffix(item.Name(), "/"))
+
+		return nil
+	})
+	if a.NoError(err) {
+		a.Equal([]string{"foo", "foo/bar", "foo/bar/baz.txt"}, actual)
+	}
+
+	a.NoError(bucket.Rename(ctx, "foo/", "qux/"))
+
+	found, err := bucket.Exists(ctx, "qux/bar/baz.txt")
+	if a.NoError(err) {
+		a.True(found)
+	}
+
+	_, err = bucket.Stat(ctx, "foo")
+	a.True(os.IsNotExist(err))
+}
@@ -0,0 +1,29 @@
+package blobadapter
+
+import (
+	"context"
+)
+
+type (
+	// BucketManager manages the content of the bucket. gocloud has no portable way of creating or deleting
+	// the bucket itself, so Create is a no-op and Remove deletes every object.
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+func (m *BucketManager) Create(_ context.Context) error {
+	return nil
+}
+
+func (m *BucketManager) Remove(ctx context.Context) error {
+	return m.Clean(ctx)
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, string(m.bucket.PathSeparator()))
+}
@@ -0,0 +1,44 @@
+package blobadapter
+
+import (
+	"fmt"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"os"
+	"strings"
+)
+
+func isNotExists(err error) bool {
+	return err != nil && gcerrors.Code(err) == gcerrors.NotFound
+}
+
+func convertError(err error) error {
+	if isNotExists(err) {
+		return os.ErrNotExist
+	}
+
+	return err
+}
+
+func isDirPath(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return true
+	}
+
+	return strings.HasSuffix(name, string(pathSeparator))
+}
+
+func dirKey(key string) string {
+	return key + string(pathSeparator)
+}
+
+// etag builds the entity tag from the MD5 hash of the content. Not every provider reports one, in which
+// case a weak tag is derived from the size and the modification time.
+func etag(attrs *blob.Attributes) string {
+	if len(attrs.MD5) > 0 {
+		return fmt.Sprintf(`"%x"`, attrs.MD5)
+	}
+
+	return fmt.Sprintf(`W/"%x-%x"`, attrs.Size, attrs.ModTime.UnixNano())
+}
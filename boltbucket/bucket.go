@@ -0,0 +1,798 @@
+package boltbucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	bolt "go.etcd.io/bbolt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	pathSeparator   rune        = '/'
+	defaultDirMode  os.FileMode = 0744
+	defaultFileMode os.FileMode = 0666
+	defaultDBMode   os.FileMode = 0600
+	defaultTimeout              = 5 * time.Second
+)
+
+var (
+	metaBucket = []byte("meta")
+	dataBucket = []byte("data")
+
+	errWriterClosed = errors.New("writer is closed")
+)
+
+type (
+	// Bucket stores its items in a top level bucket, named after it, of a bolt database. Every item
+	// has a record in the nested "meta" bucket and files have their content in the nested "data"
+	// bucket, both keyed by the item path. Each write happens in a single transaction.
+	Bucket struct {
+		name   string
+		config Config
+		db     *bolt.DB
+	}
+
+	Config struct {
+		path    string
+		mode    os.FileMode
+		timeout time.Duration
+		db      *bolt.DB
+	}
+
+	Option func(cfg *Config)
+
+	writer struct {
+		bucket   *Bucket
+		name     string
+		mode     os.FileMode
+		metadata bucketly.Metadata
+		buf      bytes.Buffer
+		closed   bool
+	}
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+)
+
+// WithPath sets the file of the database, created if missing.
+func WithPath(path string) Option {
+	return func(cfg *Config) {
+		cfg.path = path
+	}
+}
+
+func WithFileMode(mode os.FileMode) Option {
+	return func(cfg *Config) {
+		cfg.mode = mode
+	}
+}
+
+// WithTimeout sets how long to wait for the file lock held by another process using the database.
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithDB shares an already opened database, which is left open by Close.
+func WithDB(db *bolt.DB) Option {
+	return func(cfg *Config) {
+		cfg.db = db
+	}
+}
+
+func NewBucket(name string, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		mode:    defaultDBMode,
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if name == "" {
+		return nil, errors.New("bucket name is missing")
+	}
+
+	db := cfg.db
+	if db == nil {
+		if cfg.path == "" {
+			return nil, errors.New("database path is missing")
+		}
+
+		var err error
+		db, err = bolt.Open(cfg.path, cfg.mode, &bolt.Options{Timeout: cfg.timeout})
+		if err != nil {
+			return nil, fmt.Errorf(`error opening database "%s": %w`, cfg.path, err)
+		}
+	}
+
+	return &Bucket{
+		name:   name,
+		config: cfg,
+		db:     db,
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+// DB returns the underlying database.
+func (b *Bucket) DB() *bolt.DB {
+	return b.db
+}
+
+func (b *Bucket) Close() error {
+	if b.config.db != nil {
+		return nil
+	}
+
+	return b.db.Close()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(_ context.Context, name string) (io.ReadCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err = b.db.View(func(tx *bolt.Tx) error {
+		meta, content, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		r, err := get(meta, key)
+		if err != nil {
+			return err
+		}
+
+		if r.Dir {
+			return fmt.Errorf("%s is a directory", name)
+		}
+
+		// the value is only valid during the transaction
+		data = append([]byte(nil), content.Get([]byte(key))...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.Close()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+// NewWriter buffers the content in memory and stores it in a single transaction on Close.
+func (b *Bucket) NewWriter(_ context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultFileMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return &writer{
+		bucket:   b,
+		name:     key,
+		mode:     wo.Mode,
+		metadata: copyMetadata(wo.Metadata),
+	}, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(_ context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, content, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		r, err := get(meta, key)
+		if err != nil {
+			return err
+		}
+
+		if r.Dir && hasChildren(meta, key) {
+			return fmt.Errorf("%s: directory not empty", name)
+		}
+
+		if err := meta.Delete([]byte(key)); err != nil {
+			return err
+		}
+
+		return content.Delete([]byte(key))
+	})
+}
+
+func (b *Bucket) Stat(_ context.Context, name string) (bucketly.Item, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var item bucketly.Item
+	err = b.db.View(func(tx *bolt.Tx) error {
+		meta, _, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		r, err := get(meta, key)
+		if err != nil {
+			return err
+		}
+
+		item = b.recordToItem(key, r)
+
+		return nil
+	})
+
+	return item, err
+}
+
+func (b *Bucket) Mkdir(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, _, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		if r, err := get(meta, key); err == nil {
+			if !r.Dir {
+				return fmt.Errorf("%s is not a directory", name)
+			}
+
+			return nil
+		}
+
+		parent, err := get(meta, parentKey(key))
+		if err != nil {
+			return err
+		}
+
+		if !parent.Dir {
+			return fmt.Errorf("%s is not a directory", parentKey(key))
+		}
+
+		return put(meta, key, newDirRecord(wo.Mode))
+	})
+}
+
+func (b *Bucket) MkdirAll(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, _, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		return mkdirAll(meta, key, wo.Mode)
+	})
+}
+
+func (b *Bucket) Chmod(_ context.Context, name string, mode os.FileMode) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, _, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		r, err := get(meta, key)
+		if err != nil {
+			return err
+		}
+
+		if key == "" {
+			return nil
+		}
+
+		r.Mode = mode.Perm()
+		r.ModTime = time.Now()
+
+		return put(meta, key, r)
+	})
+}
+
+func (b *Bucket) RemoveAll(_ context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, content, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		return removeAll(meta, content, key)
+	})
+}
+
+func (b *Bucket) Rename(_ context.Context, from string, to string, _ ...bucketly.CopyOption) error {
+	fromKey, err := b.key(from)
+	if err != nil {
+		return err
+	}
+
+	toKey, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if fromKey == "" || toKey == "" {
+		return fmt.Errorf("cannot rename %s to %s", from, to)
+	}
+
+	if strings.HasPrefix(toKey+string(pathSeparator), fromKey+string(pathSeparator)) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, content, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		src, err := get(meta, fromKey)
+		if err != nil {
+			return err
+		}
+
+		// like os.Rename, an existing directory is only replaced by another directory and only when empty
+		if dest, err := get(meta, toKey); err == nil && dest.Dir && (!src.Dir || hasChildren(meta, toKey)) {
+			return fmt.Errorf("cannot rename %s to %s: %w", from, to, os.ErrExist)
+		}
+
+		if err := mkdirAll(meta, parentKey(toKey), defaultDirMode); err != nil {
+			return err
+		}
+
+		if err := removeAll(meta, content, toKey); err != nil {
+			return err
+		}
+
+		// the keys are collected first, a bucket must not be modified while a cursor walks it
+		keys := append([]string{fromKey}, descendants(meta, fromKey)...)
+		for _, k := range keys {
+			newKey := toKey + strings.TrimPrefix(k, fromKey)
+			for _, bb := range []*bolt.Bucket{meta, content} {
+				v := bb.Get([]byte(k))
+				if v == nil {
+					continue
+				}
+
+				if err := bb.Put([]byte(newKey), append([]byte(nil), v...)); err != nil {
+					return err
+				}
+
+				if err := bb.Delete([]byte(k)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{
+		Mode: from.Mode().Perm(),
+	}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		if co.Mode == 0 {
+			co.Mode = defaultDirMode
+		}
+
+		return b.MkdirAll(ctx, to, bucketly.WithWriteMode(co.Mode))
+	}
+
+	if co.Mode == 0 {
+		co.Mode = defaultFileMode
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := b.NewWriter(ctx, to, bucketly.WithWriteMode(co.Mode), bucketly.WithWriteMetadata(co.Metadata))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.(*writer).abort()
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   key,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	key, err := b.key(dir)
+	if err != nil {
+		return err
+	}
+
+	items, err := b.readDir(key)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDir lists the direct children of the directory with a cursor over its prefix, jumping over
+// the content of the subdirectories.
+func (b *Bucket) readDir(key string) ([]bucketly.Item, error) {
+	var items []bucketly.Item
+	err := b.db.View(func(tx *bolt.Tx) error {
+		meta, _, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		prefix := dirPrefix(key)
+		c := meta.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); {
+			rest := string(k[len(prefix):])
+			if i := strings.IndexRune(rest, pathSeparator); i >= 0 {
+				// '0' follows '/', so this is the first key after the subdirectory content
+				k, v = c.Seek([]byte(prefix + rest[:i] + "0"))
+
+				continue
+			}
+
+			r, err := decodeRecord(v)
+			if err != nil {
+				return err
+			}
+
+			items = append(items, b.recordToItem(string(k), r))
+			k, v = c.Next()
+		}
+
+		return nil
+	})
+
+	return items, err
+}
+
+// buckets returns the nested buckets of the bucket, which must have been created by the BucketManager.
+func (b *Bucket) buckets(tx *bolt.Tx) (*bolt.Bucket, *bolt.Bucket, error) {
+	root := tx.Bucket([]byte(b.name))
+	if root == nil {
+		return nil, nil, fmt.Errorf(`bucket "%s" does not exist`, b.name)
+	}
+
+	return root.Bucket(metaBucket), root.Bucket(dataBucket), nil
+}
+
+// key turns a bucket path into the key of its record. The root directory has the empty key.
+func (b *Bucket) key(name string) (string, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(name, string(pathSeparator)), nil
+}
+
+func (b *Bucket) recordToItem(key string, r *record) bucketly.Item {
+	name := key
+	if name == "" {
+		name = string(pathSeparator)
+	}
+
+	item := bucketly.NewItem(b, name)
+	item.SetDir(r.Dir)
+	item.SetSize(r.Size)
+	item.SetModeTime(r.ModTime)
+	item.SetETag(r.ETag)
+	item.SetMetadata(bucketly.Metadata{})
+	if r.Metadata != nil {
+		item.SetMetadata(copyMetadata(r.Metadata))
+	}
+
+	mode := r.Mode
+	if r.Dir {
+		mode |= os.ModeDir
+	}
+	item.SetMode(mode)
+
+	return item
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	return w.buf.Write(p)
+}
+
+// abort drops the buffered content, nothing is stored.
+func (w *writer) abort() {
+	w.closed = true
+	w.buf.Reset()
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	data := w.buf.Bytes()
+	r := &record{
+		Size:     int64(len(data)),
+		Mode:     w.mode.Perm(),
+		ModTime:  time.Now(),
+		ETag:     fmt.Sprintf(`"%x"`, md5.Sum(data)),
+		Metadata: w.metadata,
+	}
+
+	b := w.bucket
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta, content, err := b.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		if existing, err := get(meta, w.name); err == nil && existing.Dir {
+			return fmt.Errorf("%s is a directory", w.name)
+		}
+
+		if err := mkdirAll(meta, parentKey(w.name), defaultDirMode); err != nil {
+			return err
+		}
+
+		if err := put(meta, w.name, r); err != nil {
+			return err
+		}
+
+		return content.Put([]byte(w.name), data)
+	})
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		i.queue, err = i.bucket.readDir(i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if i.queue == nil {
+			i.queue = make([]bucketly.Item, 0)
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
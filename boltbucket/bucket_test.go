@@ -0,0 +1,193 @@
+package boltbucket_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/boltbucket"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newBucket(t *testing.T, path string) *boltbucket.Bucket {
+	bucket, err := boltbucket.NewBucket("test", boltbucket.WithPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := boltbucket.NewBucketManager(bucket).Create(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func tempPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bucketly-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return filepath.Join(dir, "test.db")
+}
+
+func TestBucket_Persistence(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	path := tempPath(t)
+
+	bucket := newBucket(t, path)
+	_, err := bucket.Write(
+		ctx,
+		"foo/bar.txt",
+		[]byte("12345"),
+		bucketly.WithWriteMode(0600),
+		bucketly.WithWriteMetadata(bucketly.Metadata{"owner": "foo"}),
+	)
+	a.NoError(err)
+	a.NoError(bucket.Close())
+
+	bucket = newBucket(t, path)
+	defer bucket.Close()
+
+	item, err := bucket.Stat(ctx, "foo/bar.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(int64(5), item.Size())
+	a.Equal(os.FileMode(0600), item.Mode())
+
+	etag, err := item.ETag()
+	if a.NoError(err) {
+		a.Equal(`"827ccb0eea8a706c4c34a16891f84e7b"`, etag)
+	}
+
+	metadata, err := item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"owner": "foo"}, metadata)
+	}
+
+	content, err := bucket.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+}
+
+func TestBucket_AtomicWrite(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, tempPath(t))
+	defer bucket.Close()
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("old"))
+	a.NoError(err)
+
+	w, err := bucket.NewWriter(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = w.Write([]byte("new"))
+	a.NoError(err)
+
+	content, err := bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("old"), content)
+	}
+
+	a.NoError(w.Close())
+
+	content, err = bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("new"), content)
+	}
+
+	_, err = bucket.Write(ctx, "foo.txt/bar.txt", []byte("12345"))
+	a.Error(err)
+
+	exists, err := bucket.Exists(ctx, "foo.txt/bar.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+}
+
+func TestBucket_Isolation(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	path := tempPath(t)
+
+	foo := newBucket(t, path)
+	defer foo.Close()
+
+	bar, err := boltbucket.NewBucket("bar", boltbucket.WithDB(foo.DB()))
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = bar.Write(ctx, "foo.txt", []byte("12345"))
+	a.Error(err)
+
+	manager := boltbucket.NewBucketManager(bar)
+	if !a.NoError(manager.Create(ctx)) {
+		return
+	}
+
+	_, err = bar.Write(ctx, "foo.txt", []byte("12345"))
+	a.NoError(err)
+
+	exists, err := foo.Exists(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	a.NoError(manager.Remove(ctx))
+	a.NoError(bar.Close())
+
+	_, err = foo.Stat(ctx, "/")
+	a.NoError(err)
+}
+
+func TestBucket_Rename(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, tempPath(t))
+	defer bucket.Close()
+
+	for _, name := range []string{"foo/a.txt", "bar/b.txt", "c.txt"} {
+		if _, err := bucket.Write(ctx, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := bucket.Rename(ctx, "foo", "bar")
+	a.True(errors.Is(err, os.ErrExist))
+
+	err = bucket.Rename(ctx, "c.txt", "bar")
+	a.True(errors.Is(err, os.ErrExist))
+
+	exists, err := bucket.Exists(ctx, "bar/b.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	a.NoError(bucket.Remove(ctx, "bar/b.txt"))
+	a.NoError(bucket.Rename(ctx, "foo", "bar"))
+
+	content, err := bucket.Read(ctx, "bar/a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("foo/a.txt"), content)
+	}
+}
+
+func TestNewBucket_MissingPath(t *testing.T) {
+	_, err := boltbucket.NewBucket("test")
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package boltbucket
+
+import (
+	"context"
+	bolt "go.etcd.io/bbolt"
+)
+
+type (
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+func (m *BucketManager) Create(_ context.Context) error {
+	return m.bucket.db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(m.bucket.name))
+		if err != nil {
+			return err
+		}
+
+		if _, err := root.CreateBucketIfNotExists(metaBucket); err != nil {
+			return err
+		}
+
+		_, err = root.CreateBucketIfNotExists(dataBucket)
+
+		return err
+	})
+}
+
+func (m *BucketManager) Remove(_ context.Context) error {
+	return m.bucket.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(m.bucket.name))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+
+		return err
+	})
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, string(m.bucket.PathSeparator()))
+}
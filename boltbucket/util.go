@@ -0,0 +1,160 @@
+package boltbucket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"strings"
+	"time"
+)
+
+type record struct {
+	Dir      bool              `json:"dir,omitempty"`
+	Size     int64             `json:"size"`
+	Mode     os.FileMode       `json:"mode"`
+	ModTime  time.Time         `json:"modTime"`
+	ETag     string            `json:"etag,omitempty"`
+	Metadata bucketly.Metadata `json:"metadata,omitempty"`
+}
+
+func newDirRecord(mode os.FileMode) *record {
+	return &record{
+		Dir:     true,
+		Mode:    mode.Perm(),
+		ModTime: time.Now(),
+	}
+}
+
+func decodeRecord(v []byte) (*record, error) {
+	r := &record{}
+	if err := json.Unmarshal(v, r); err != nil {
+		return nil, fmt.Errorf("error decoding record: %w", err)
+	}
+
+	return r, nil
+}
+
+func get(meta *bolt.Bucket, key string) (*record, error) {
+	if key == "" {
+		return &record{
+			Dir:  true,
+			Mode: defaultDirMode,
+		}, nil
+	}
+
+	v := meta.Get([]byte(key))
+	if v == nil {
+		return nil, os.ErrNotExist
+	}
+
+	return decodeRecord(v)
+}
+
+func put(meta *bolt.Bucket, key string, r *record) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return meta.Put([]byte(key), v)
+}
+
+func mkdirAll(meta *bolt.Bucket, key string, mode os.FileMode) error {
+	if key == "" {
+		return nil
+	}
+
+	parts := strings.Split(key, string(pathSeparator))
+	for i := range parts {
+		dir := strings.Join(parts[:i+1], string(pathSeparator))
+		r, err := get(meta, dir)
+		if err == nil {
+			if !r.Dir {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+
+			continue
+		}
+
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := put(meta, dir, newDirRecord(mode)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeAll(meta *bolt.Bucket, content *bolt.Bucket, key string) error {
+	keys := descendants(meta, key)
+	if key != "" {
+		keys = append(keys, key)
+	}
+
+	for _, k := range keys {
+		if err := meta.Delete([]byte(k)); err != nil {
+			return err
+		}
+
+		if err := content.Delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// descendants returns the keys of everything under the directory key.
+func descendants(meta *bolt.Bucket, key string) []string {
+	var keys []string
+	prefix := []byte(dirPrefix(key))
+	c := meta.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, string(k))
+	}
+
+	return keys
+}
+
+func hasChildren(meta *bolt.Bucket, key string) bool {
+	prefix := []byte(dirPrefix(key))
+	k, _ := meta.Cursor().Seek(prefix)
+
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+func dirPrefix(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return key + string(pathSeparator)
+}
+
+func parentKey(key string) string {
+	i := strings.LastIndex(key, string(pathSeparator))
+	if i < 0 {
+		return ""
+	}
+
+	return key[:i]
+}
+
+func copyMetadata(metadata bucketly.Metadata) bucketly.Metadata {
+	if metadata == nil {
+		return nil
+	}
+
+	m := make(bucketly.Metadata, len(metadata))
+	for k, v := range metadata {
+		m[k] = v
+	}
+
+	return m
+}
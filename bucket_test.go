@@ -1,57 +1,257 @@
 package bucketly_test
 
 import (
+	"cloud.google.com/go/storage"
 	"context"
 	"fmt"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
 	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/azure"
+	"github.com/vcraescu/bucketly/blobadapter"
+	"github.com/vcraescu/bucketly/boltbucket"
+	"github.com/vcraescu/bucketly/cache"
+	"github.com/vcraescu/bucketly/compress"
+	"github.com/vcraescu/bucketly/encrypt"
+	"github.com/vcraescu/bucketly/ftp"
+	"github.com/vcraescu/bucketly/gcs"
+	"github.com/vcraescu/bucketly/internal/ftptest"
+	"github.com/vcraescu/bucketly/internal/sftptest"
 	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/quota"
+	"github.com/vcraescu/bucketly/ratelimit"
+	"github.com/vcraescu/bucketly/retry"
 	"github.com/vcraescu/bucketly/s3"
+	"github.com/vcraescu/bucketly/sftp"
+	"github.com/vcraescu/bucketly/shard"
+	"github.com/vcraescu/bucketly/trash"
+	"github.com/vcraescu/bucketly/versioned"
+	"github.com/vcraescu/bucketly/webdav"
+	bolt "go.etcd.io/bbolt"
+	"gocloud.dev/blob/memblob"
+	"golang.org/x/crypto/ssh"
+	xwebdav "golang.org/x/net/webdav"
+	"google.golang.org/api/option"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-type BucketTestSuite struct {
-	suite.Suite
+type (
+	BucketTestSuite struct {
+		suite.Suite
 
-	newBucket        func(name string) bucketly.Bucket
-	newBucketManager func(bucket bucketly.Bucket) bucketly.BucketManager
-	bucket           bucketly.Bucket
-	manager          bucketly.BucketManager
-}
+		bucketName func() string
+		newBucket  bucketFactory
+		bucket     bucketly.Bucket
+		manager    bucketly.BucketManager
+	}
+
+	// bucketFactory returns a new bucket with the manager creating and removing it.
+	bucketFactory func(name string) (bucketly.Bucket, bucketly.BucketManager)
+
+	// managers manages the buckets wrapped together, e.g. the layers of an overlay.
+	managers []bucketly.BucketManager
+
+	// rootManager creates the root directory of a bucket living in a directory of the managed one.
+	rootManager struct {
+		bucketly.BucketManager
+		bucket bucketly.Bucket
+	}
+)
 
 func TestS3BucketTestSuite(t *testing.T) {
 	s := new(BucketTestSuite)
-	s.bucket = new(s3.Bucket)
-	s.newBucket = createS3Bucket
-	s.newBucketManager = newS3BucketManager
+	s.bucketName = func() string { return os.Getenv("AWS_S3_BUCKET") }
+	s.newBucket = backend(newS3Bucket, newS3BucketManager)
 
 	suite.Run(t, s)
 }
 
 func TestLocalBucketTestSuite(t *testing.T) {
 	s := new(BucketTestSuite)
-	s.bucket = new(s3.Bucket)
-	s.newBucket = createLocalBucket
-	s.newBucketManager = newLocalBucketManager
+	s.bucketName = func() string { return fmt.Sprintf("/tmp/bucketly-%s", uuid.New().String()) }
+	s.newBucket = backend(newLocalBucket, newLocalBucketManager)
 
 	suite.Run(t, s)
 }
 
+// bucketSuites are the other buckets the BucketTestSuite runs against, every test gets a bucket with
+// a random name.
+var bucketSuites = []struct {
+	name string
+	// env is an environment variable the bucket needs, the suite is skipped when it isn't set.
+	env       string
+	newBucket bucketFactory
+}{
+	{
+		name:      "FTP",
+		newBucket: backend(newFTPBucket, newFTPBucketManager),
+	},
+	{
+		name:      "SFTP",
+		newBucket: backend(newSFTPBucket, newSFTPBucketManager),
+	},
+	{
+		name:      "Memory",
+		newBucket: backend(newMemoryBucket, newMemoryBucketManager),
+	},
+	{
+		name:      "BlobAdapter",
+		newBucket: backend(newBlobAdapterBucket, newBlobAdapterBucketManager),
+	},
+	{
+		name:      "Azure",
+		env:       "AZURE_STORAGE_ACCOUNT",
+		newBucket: backend(newAzureBucket, newAzureBucketManager),
+	},
+	{
+		name:      "GCS",
+		newBucket: backend(newGCSBucket, newGCSBucketManager),
+	},
+	{
+		name:      "WebDAV",
+		newBucket: backend(newWebDAVBucket, newWebDAVBucketManager),
+	},
+	{
+		name:      "Bolt",
+		newBucket: backend(newBoltBucket, newBoltBucketManager),
+	},
+	{
+		name: "Overlay",
+		newBucket: func(name string) (bucketly.Bucket, bucketly.BucketManager) {
+			lower, upper := memory.NewBucket(name), memory.NewBucket(name)
+
+			return bucketly.NewOverlay(lower, upper), managers{memory.NewBucketManager(lower), memory.NewBucketManager(upper)}
+		},
+	},
+	{
+		name: "Sub",
+		newBucket: func(name string) (bucketly.Bucket, bucketly.BucketManager) {
+			parent := memory.NewBucket(name)
+			bucket := bucketly.Sub(parent, "tenant/data")
+
+			return bucket, rootManager{BucketManager: memory.NewBucketManager(parent), bucket: bucket}
+		},
+	},
+	{
+		name: "Cache",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			dir, err := ioutil.TempDir("", "bucketly-cache")
+			if err != nil {
+				return nil, err
+			}
+
+			return cache.NewBucket(parent, cache.WithDir(dir))
+		}),
+	},
+	{
+		name: "Encrypt",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			return encrypt.NewBucket(parent, encrypt.WithKey("test", []byte("0123456789abcdef0123456789abcdef")))
+		}),
+	},
+	{
+		name: "Compress",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			return compress.NewBucket(parent, compress.WithCodec(compress.Zstd))
+		}),
+	},
+	{
+		name: "Mirror",
+		newBucket: func(name string) (bucketly.Bucket, bucketly.BucketManager) {
+			primary, replica := memory.NewBucket(name), memory.NewBucket(name)
+
+			return bucketly.NewMirror(primary, replica), managers{memory.NewBucketManager(primary), memory.NewBucketManager(replica)}
+		},
+	},
+	{
+		name: "Shard",
+		newBucket: func(name string) (bucketly.Bucket, bucketly.BucketManager) {
+			var shards []bucketly.Bucket
+			var m managers
+			for i := 0; i < 3; i++ {
+				b := memory.NewBucket(fmt.Sprintf("%s-%d", name, i))
+				shards = append(shards, b)
+				m = append(m, memory.NewBucketManager(b))
+			}
+
+			bucket, err := shard.NewBucket(shards, shard.WithName(name))
+			if err != nil {
+				panic(err)
+			}
+
+			return bucket, m
+		},
+	},
+	{
+		name: "Versioned",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			return versioned.NewBucket(parent)
+		}),
+	},
+	{
+		name: "Trash",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			return trash.NewBucket(parent)
+		}),
+	},
+	{
+		name: "Quota",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			return quota.NewBucket(parent, quota.WithLimit(quota.Limit{MaxBytes: 1 << 30}))
+		}),
+	},
+	{
+		name: "RateLimit",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			return ratelimit.NewBucket(
+				parent,
+				ratelimit.WithBandwidth(ratelimit.NewLimiter(1<<30, 0)),
+				ratelimit.WithRequestRate(ratelimit.NewLimiter(1e6, 0)),
+			)
+		}),
+	},
+	{
+		name: "Retry",
+		newBucket: wrapMemory(func(parent bucketly.Bucket) (bucketly.Bucket, error) {
+			return retry.NewBucket(parent, retry.WithCircuitBreaker(5, time.Second))
+		}),
+	},
+}
+
+func TestBucketTestSuite(t *testing.T) {
+	for _, test := range bucketSuites {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if test.env != "" && os.Getenv(test.env) == "" {
+				t.Skipf("%s is not set", test.env)
+			}
+
+			s := new(BucketTestSuite)
+			s.newBucket = test.newBucket
+
+			suite.Run(t, s)
+		})
+	}
+}
+
 func (suite *BucketTestSuite) SetupTest() {
-	switch suite.bucket.(type) {
-	case *s3.Bucket:
-		suite.bucket = suite.newBucket(os.Getenv("AWS_S3_BUCKET"))
-	case *local.Bucket:
-		name := fmt.Sprintf("/tmp/bucketly-%s", uuid.New().String())
-		suite.bucket = suite.newBucket(name)
+	name := fmt.Sprintf("bucketly-%s", uuid.New().String())
+	if suite.bucketName != nil {
+		name = suite.bucketName()
 	}
 
-	suite.manager = suite.newBucketManager(suite.bucket)
+	suite.bucket, suite.manager = suite.createBucket(name)
 }
 
 func (suite *BucketTestSuite) TearDownTest() {
@@ -65,6 +265,16 @@ func (suite *BucketTestSuite) TearDownTest() {
 	}
 }
 
+// createBucket returns a new bucket, already created.
+func (suite *BucketTestSuite) createBucket(name string) (bucketly.Bucket, bucketly.BucketManager) {
+	bucket, manager := suite.newBucket(name)
+	if err := manager.Create(context.Background()); err != nil {
+		panic(err)
+	}
+
+	return bucket, manager
+}
+
 func (suite *BucketTestSuite) TestMkdir() {
 	ctx := context.Background()
 	tests := []struct {
@@ -668,12 +878,10 @@ func (suite *BucketTestSuite) TestCopy() {
 		return
 	}
 
-	destBucket := suite.newBucket("dest")
+	destBucket, manager := suite.createBucket("dest")
 	dest := "test_transfer_dest.txt"
 	suite.NoError(destBucket.Copy(ctx, bucketly.NewItem(suite.bucket, name), dest))
 	suite.NoError(destBucket.Remove(ctx, dest))
-
-	manager := suite.newBucketManager(destBucket)
 	suite.NoError(manager.Remove(context.Background()))
 }
 
@@ -688,14 +896,12 @@ func (suite *BucketTestSuite) TestCopyAll() {
 		return
 	}
 
-	destBucket := suite.newBucket("dest")
+	destBucket, manager := suite.createBucket("dest")
 	dest := "test_copy_all_dest/"
 	if suite.NoError(destBucket.CopyAll(ctx, bucketly.NewItem(suite.bucket, name), dest)) {
 		suite.testWalkDeepDir(destBucket.(bucketly.Walkable), dest)
 	}
 	suite.NoError(destBucket.RemoveAll(ctx, dest))
-
-	manager := suite.newBucketManager(destBucket)
 	suite.NoError(manager.Remove(context.Background()))
 }
 
@@ -915,33 +1121,116 @@ func (suite *BucketTestSuite) testWalkDeepDir(bucket bucketly.Walkable, name str
 	}
 }
 
-func createS3Bucket(name string) bucketly.Bucket {
-	bucket := newS3Bucket(name)
-	manager := newS3BucketManager(bucket)
-	if err := manager.Create(context.Background()); err != nil {
-		panic(err)
+func newS3BucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return s3.NewBucketManager(bucket.(*s3.Bucket))
+}
+
+func newLocalBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return local.NewBucketManager(bucket.(*local.Bucket))
+}
+
+func newFTPBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return ftp.NewBucketManager(bucket.(*ftp.Bucket))
+}
+
+func newSFTPBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return sftp.NewBucketManager(bucket.(*sftp.Bucket))
+}
+
+func newMemoryBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return memory.NewBucketManager(bucket.(*memory.Bucket))
+}
+
+func newBlobAdapterBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return blobadapter.NewBucketManager(bucket.(*blobadapter.Bucket))
+}
+
+func newAzureBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return azure.NewBucketManager(bucket.(*azure.Bucket))
+}
+
+func newGCSBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return gcs.NewBucketManager(bucket.(*gcs.Bucket))
+}
+
+func newWebDAVBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return webdav.NewBucketManager(bucket.(*webdav.Bucket))
+}
+
+func newBoltBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
+	return boltbucket.NewBucketManager(bucket.(*boltbucket.Bucket))
+}
+
+// backend returns the factory of a bucket managed by the manager of its backend.
+func backend(newBucket func(name string) bucketly.Bucket, newManager func(bucket bucketly.Bucket) bucketly.BucketManager) bucketFactory {
+	return func(name string) (bucketly.Bucket, bucketly.BucketManager) {
+		bucket := newBucket(name)
+
+		return bucket, newManager(bucket)
 	}
+}
 
-	return bucket
+// wrapMemory returns the factory of a bucket wrapping a memory bucket, which is the one managed.
+func wrapMemory(wrap func(parent bucketly.Bucket) (bucketly.Bucket, error)) bucketFactory {
+	return func(name string) (bucketly.Bucket, bucketly.BucketManager) {
+		parent := memory.NewBucket(name)
+		bucket, err := wrap(parent)
+		if err != nil {
+			panic(err)
+		}
+
+		return bucket, memory.NewBucketManager(parent)
+	}
 }
 
-func createLocalBucket(name string) bucketly.Bucket {
-	bucket := local.NewBucket(name)
+func (m managers) Create(ctx context.Context) error {
+	for _, manager := range m {
+		if err := manager.Create(ctx); err != nil {
+			return err
+		}
+	}
 
-	manager := newLocalBucketManager(bucket)
-	if err := manager.Create(context.Background()); err != nil {
-		panic(err)
+	return nil
+}
+
+func (m managers) Remove(ctx context.Context) error {
+	for _, manager := range m {
+		if err := manager.Remove(ctx); err != nil {
+			return err
+		}
 	}
 
-	return bucket
+	return nil
 }
 
-func newS3BucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
-	return s3.NewBucketManager(bucket.(*s3.Bucket))
+func (m managers) Clean(ctx context.Context) error {
+	for _, manager := range m {
+		if err := manager.Clean(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func newLocalBucketManager(bucket bucketly.Bucket) bucketly.BucketManager {
-	return local.NewBucketManager(bucket.(*local.Bucket))
+func (m rootManager) Create(ctx context.Context) error {
+	if err := m.BucketManager.Create(ctx); err != nil {
+		return err
+	}
+
+	return m.bucket.MkdirAll(ctx, "/")
+}
+
+func newLocalBucket(name string) bucketly.Bucket {
+	return local.NewBucket(name)
+}
+
+func newMemoryBucket(name string) bucketly.Bucket {
+	return memory.NewBucket(name)
+}
+
+func newBlobAdapterBucket(name string) bucketly.Bucket {
+	return blobadapter.NewBucket(name, memblob.OpenBucket(nil))
 }
 
 func newS3Bucket(name string) bucketly.Bucket {
@@ -959,6 +1248,170 @@ func newS3Bucket(name string) bucketly.Bucket {
 	return bucket
 }
 
+func newAzureBucket(name string) bucketly.Bucket {
+	bucket, err := azure.NewBucket(
+		name,
+		azure.WithAccountName(os.Getenv("AZURE_STORAGE_ACCOUNT")),
+		azure.WithAccountKey(os.Getenv("AZURE_STORAGE_KEY")),
+		azure.WithEndpoint(os.Getenv("AZURE_STORAGE_ENDPOINT")),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return bucket
+}
+
+var (
+	gcsServer     *fakestorage.Server
+	gcsClient     *storage.Client
+	gcsServerOnce sync.Once
+)
+
+// fakeGCSTransport acknowledges bucket deletions, which fake-gcs-server does not implement.
+type fakeGCSTransport struct {
+	http.RoundTripper
+}
+
+func (t fakeGCSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodDelete && !strings.Contains(strings.TrimPrefix(req.URL.Path, "/storage/v1/b/"), "/") {
+		return &http.Response{
+			StatusCode: http.StatusNoContent,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func newGCSBucket(name string) bucketly.Bucket {
+	gcsServerOnce.Do(func() {
+		server, err := fakestorage.NewServerWithOptions(fakestorage.Options{NoListener: true})
+		if err != nil {
+			panic(err)
+		}
+
+		gcsServer = server
+		gcsClient, err = storage.NewClient(
+			context.Background(),
+			option.WithHTTPClient(&http.Client{Transport: fakeGCSTransport{server.HTTPClient().Transport}}),
+		)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	bucket, err := gcs.NewBucket(name, gcs.WithProjectID("bucketly"), gcs.WithClient(gcsClient))
+	if err != nil {
+		panic(err)
+	}
+
+	return bucket
+}
+
+var (
+	ftpServer     *ftptest.Server
+	ftpServerOnce sync.Once
+)
+
+func newFTPBucket(name string) bucketly.Bucket {
+	ftpServerOnce.Do(func() {
+		root, err := ioutil.TempDir("", "bucketly-ftp-")
+		if err != nil {
+			panic(err)
+		}
+
+		ftpServer = ftptest.NewServer(root)
+	})
+
+	bucket, err := ftp.NewBucket(name, ftp.WithAddress(ftpServer.Addr))
+	if err != nil {
+		panic(err)
+	}
+
+	return bucket
+}
+
+var (
+	sftpServer     *sftptest.Server
+	sftpServerRoot string
+	sftpServerOnce sync.Once
+)
+
+func newSFTPBucket(name string) bucketly.Bucket {
+	sftpServerOnce.Do(func() {
+		root, err := ioutil.TempDir("", "bucketly-sftp-")
+		if err != nil {
+			panic(err)
+		}
+
+		sftpServerRoot = root
+		sftpServer = sftptest.NewServer("bucketly", "secret")
+	})
+
+	bucket, err := sftp.NewBucket(
+		filepath.Join(sftpServerRoot, name),
+		sftp.WithAddress(sftpServer.Addr),
+		sftp.WithUser("bucketly"),
+		sftp.WithPassword("secret"),
+		sftp.WithHostKeyCallback(ssh.FixedHostKey(sftpServer.HostKey)),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return bucket
+}
+
+var (
+	webdavServer     *httptest.Server
+	webdavServerOnce sync.Once
+)
+
+func newWebDAVBucket(name string) bucketly.Bucket {
+	webdavServerOnce.Do(func() {
+		webdavServer = httptest.NewServer(&xwebdav.Handler{
+			FileSystem: xwebdav.NewMemFS(),
+			LockSystem: xwebdav.NewMemLS(),
+		})
+	})
+
+	bucket, err := webdav.NewBucket(name, webdav.WithEndpoint(webdavServer.URL))
+	if err != nil {
+		panic(err)
+	}
+
+	return bucket
+}
+
+var (
+	boltDB     *bolt.DB
+	boltDBOnce sync.Once
+)
+
+func newBoltBucket(name string) bucketly.Bucket {
+	boltDBOnce.Do(func() {
+		dir, err := ioutil.TempDir("", "bucketly-bolt")
+		if err != nil {
+			panic(err)
+		}
+
+		boltDB, err = bolt.Open(filepath.Join(dir, "bucketly.db"), 0600, nil)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	bucket, err := boltbucket.NewBucket(name, boltbucket.WithDB(boltDB))
+	if err != nil {
+		panic(err)
+	}
+
+	return bucket
+}
+
 func getItemsArray(ctx context.Context, l bucketly.Listable, name string) ([]bucketly.Item, error) {
 	it, err := l.Items(name)
 	if err != nil {
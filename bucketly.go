@@ -51,6 +51,12 @@ type (
 		Items(name string) (ListIterator, error)
 	}
 
+	// MetadataStore is implemented by the buckets telling whether they keep the metadata of the
+	// written items.
+	MetadataStore interface {
+		StoresMetadata() bool
+	}
+
 	ListIterator interface {
 		io.Closer
 
@@ -110,6 +116,44 @@ func WithWriteMode(mode os.FileMode) WriteOption {
 	}
 }
 
+// Get returns the value of the key, ignoring its case. Some backends change the case of the keys,
+// so the keys added by the wrappers only use lowercase letters and underscores, which are valid
+// for every backend, and are looked up with Get.
+func (m Metadata) Get(key string) (string, bool) {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// Without returns a copy of the metadata without the keys starting with the prefix, ignoring their
+// case.
+func (m Metadata) Without(prefix string) Metadata {
+	metadata := make(Metadata, len(m))
+	for k, v := range m {
+		if strings.HasPrefix(strings.ToLower(k), strings.ToLower(prefix)) {
+			continue
+		}
+
+		metadata[k] = v
+	}
+
+	return metadata
+}
+
+// StoresMetadata reports whether the bucket keeps the metadata of the written items. The buckets
+// which don't implement MetadataStore are assumed to keep it.
+func StoresMetadata(b Bucket) bool {
+	if m, ok := b.(MetadataStore); ok {
+		return m.StoresMetadata()
+	}
+
+	return true
+}
+
 func Base(b PathSeparable, name string) string {
 	if b.PathSeparator() == os.PathSeparator {
 		return filepath.Base(name)
@@ -225,8 +269,8 @@ func CopyAll(ctx context.Context, from Item, to Item, opts ...CopyOption) error
 	err := w.Walk(ctx, from.Name(), func(item Item, err error) error {
 		dest := to.Name() + strings.TrimPrefix(item.Name(), from.Name())
 
+		wg.Add(1)
 		go func() {
-			wg.Add(1)
 			defer wg.Done()
 
 			if err := cp(ctx, item, dest, opts...); err != nil {
@@ -252,3 +296,49 @@ func CopyAll(ctx context.Context, from Item, to Item, opts ...CopyOption) error
 		return err
 	}
 }
+
+// ListDir returns the direct children of the directory, or nothing when it doesn't exist or isn't a
+// directory. The bucket must be Listable.
+func ListDir(ctx context.Context, b Bucket, name string) ([]Item, error) {
+	l, ok := b.(Listable)
+	if !ok {
+		return nil, fmt.Errorf("bucket %s is not listable", b.Name())
+	}
+
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if !item.IsDir() {
+		return nil, nil
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var items []Item
+	for {
+		item, err := it.Next(ctx)
+		if err != nil {
+			if err == io.EOF {
+				return items, nil
+			}
+
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+}
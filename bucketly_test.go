@@ -1,15 +1,45 @@
 package bucketly_test
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/vcraescu/bucketly"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
 )
 
 type ps struct {
 }
 
+// copyBucket walks a fixed list of files and records the names copied to it.
+type copyBucket struct {
+	bucketly.Bucket
+	names  []string
+	mu     sync.Mutex
+	copied []string
+}
+
+func (b *copyBucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	for _, name := range b.names {
+		if err := walkFunc(bucketly.NewItem(b, name), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *copyBucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.copied = append(b.copied, to)
+
+	return nil
+}
+
 func (s ps) PathSeparator() rune {
 	return '/'
 }
@@ -287,3 +317,19 @@ func TestSanitize(t *testing.T) {
 		})
 	}
 }
+
+func TestCopyAll(t *testing.T) {
+	// with a single thread the copies only start once CopyAll waits for them
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	a := assert.New(t)
+	src := &copyBucket{names: []string{"src/a.txt", "src/b.txt", "src/c.txt"}}
+	dest := &copyBucket{}
+
+	a.NoError(bucketly.CopyAll(context.Background(), bucketly.NewItem(src, "src"), bucketly.NewItem(dest, "dest")))
+
+	dest.mu.Lock()
+	defer dest.mu.Unlock()
+
+	a.ElementsMatch([]string{"dest", "dest/a.txt", "dest/b.txt", "dest/c.txt"}, dest.copied)
+}
@@ -0,0 +1,954 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/local"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultFileMode os.FileMode = 0666
+
+// cacheDir is the subdirectory of the cache directory holding the cached content.
+const cacheDir = "bucketly-cache"
+
+const (
+	// WriteThrough writes to the remote bucket before caching the content.
+	WriteThrough Mode = iota
+	// WriteBack only caches the content, which is written to the remote bucket by Flush.
+	WriteBack
+)
+
+var errTooLarge = errors.New("too large to cache")
+
+type (
+	Mode int
+
+	// Bucket caches the content read from a remote bucket in a local directory. A cached entry is
+	// used while the ETag, or the modification time and size when there is no ETag, of the remote
+	// item is unchanged. Everything else goes to the remote bucket.
+	Bucket struct {
+		remote  bucketly.Bucket
+		cache   *local.Bucket
+		config  Config
+		mu      sync.Mutex
+		entries map[string]*list.Element
+		lru     *list.List
+		size    int64
+		stats   Stats
+		seq     uint64
+	}
+
+	Config struct {
+		dir     string
+		maxSize int64
+		maxAge  time.Duration
+		mode    Mode
+	}
+
+	Option func(cfg *Config)
+
+	Stats struct {
+		Hits      int64
+		Misses    int64
+		Evictions int64
+		// Size is the number of bytes in the cache.
+		Size int64
+		// Entries is the number of items in the cache.
+		Entries int
+	}
+
+	entry struct {
+		key       string
+		path      string
+		size      int64
+		etag      string
+		modTime   time.Time
+		validated time.Time
+		// dirty entries are not written to the remote bucket yet, they are written before being
+		// evicted.
+		dirty    bool
+		version  uint64
+		mode     os.FileMode
+		metadata bucketly.Metadata
+	}
+
+	listIterator struct {
+		bucket *Bucket
+		it     bucketly.ListIterator
+	}
+)
+
+// WithDir sets the cache directory. The content is cached in its bucketly-cache subdirectory, which
+// is emptied when the bucket is created, the rest of the directory is left alone.
+func WithDir(dir string) Option {
+	return func(cfg *Config) {
+		cfg.dir = dir
+	}
+}
+
+// WithMaxSize bounds the size of the cache, the least recently used entries are evicted first.
+// Items larger than it are not cached. In WriteBack mode, the least recently used dirty entries
+// are written to the remote bucket when the cache outgrows it.
+func WithMaxSize(size int64) Option {
+	return func(cfg *Config) {
+		cfg.maxSize = size
+	}
+}
+
+// WithMaxAge trusts the entries validated against the remote bucket within the duration.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.maxAge = maxAge
+	}
+}
+
+func WithMode(mode Mode) Option {
+	return func(cfg *Config) {
+		cfg.mode = mode
+	}
+}
+
+func NewBucket(remote bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		mode: WriteThrough,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.dir == "" {
+		return nil, errors.New("cache directory is missing")
+	}
+
+	// the index of the entries only lives in memory, the content left by a previous run can't be
+	// validated nor accounted for, so the cache starts empty
+	cache := local.NewBucket(filepath.Join(cfg.dir, cacheDir))
+	manager := local.NewBucketManager(cache)
+	if err := manager.Clean(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if err := manager.Create(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return &Bucket{
+		remote:  remote,
+		cache:   cache,
+		config:  cfg,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+func (b *Bucket) Remote() bucketly.Bucket {
+	return b.remote
+}
+
+// StoresMetadata reports whether the remote bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.remote)
+}
+
+func (b *Bucket) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Size = b.size
+	stats.Entries = len(b.entries)
+
+	return stats
+}
+
+func (b *Bucket) Name() string {
+	return b.remote.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.remote.PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if path, ok := b.lookup(ctx, key); ok {
+		r, err := b.cache.NewReader(ctx, path)
+		if err == nil {
+			b.count(&b.stats.Hits)
+
+			return r, nil
+		}
+
+		b.invalidate(key)
+	}
+
+	b.count(&b.stats.Misses)
+
+	item, err := b.remote.Stat(ctx, b.remoteName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	path, err := b.fetch(ctx, key, item)
+	if err != nil {
+		if err == errTooLarge {
+			return b.remote.NewReader(ctx, b.remoteName(key))
+		}
+
+		return nil, err
+	}
+
+	r, err := b.cache.NewReader(ctx, path)
+	if err != nil {
+		// evicted in the meantime
+		return b.remote.NewReader(ctx, b.remoteName(key))
+	}
+
+	return r, nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.(*writer).abort()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+// NewWriter writes the content in the cache directory, then, on Close, to the remote bucket in
+// WriteThrough mode or marks the entry as dirty in WriteBack mode.
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return b.newWriter(ctx, key, wo)
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := b.dirtyEntry(key); ok {
+		return true, nil
+	}
+
+	return b.remote.Exists(ctx, b.remoteName(key))
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	_, dirty := b.dirtyEntry(key)
+	b.invalidate(key)
+
+	err = b.remote.Remove(ctx, b.remoteName(key))
+	if err != nil && dirty && os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := b.dirtyEntry(key); ok {
+		item := bucketly.NewItem(b, key)
+		item.SetSize(e.size)
+		item.SetMode(defaultFileMode)
+		if e.mode != 0 {
+			item.SetMode(e.mode)
+		}
+		item.SetModeTime(e.modTime)
+		item.SetETag(e.etag)
+		item.SetMetadata(bucketly.Metadata{})
+		if e.metadata != nil {
+			item.SetMetadata(e.metadata)
+		}
+
+		return item, nil
+	}
+
+	item, err := b.remote.Stat(ctx, b.remoteName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.flush(ctx, key); err != nil {
+		return err
+	}
+
+	return b.remote.Mkdir(ctx, b.remoteName(key), opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.flush(ctx, key); err != nil {
+		return err
+	}
+
+	return b.remote.MkdirAll(ctx, b.remoteName(key), opts...)
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.flush(ctx, key); err != nil {
+		return err
+	}
+
+	return b.remote.Chmod(ctx, b.remoteName(key), mode)
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	// the dirty entries are only dropped once the remote bucket let go of the directory, they are lost
+	// otherwise
+	err = b.remote.RemoveAll(ctx, b.remoteName(key))
+	if err == nil || os.IsNotExist(err) {
+		b.invalidate(key)
+	}
+
+	return err
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromKey, err := b.key(from)
+	if err != nil {
+		return err
+	}
+
+	toKey, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if err := b.flush(ctx, fromKey); err != nil {
+		return err
+	}
+
+	if err := b.flush(ctx, toKey); err != nil {
+		return err
+	}
+
+	b.invalidate(fromKey)
+	b.invalidate(toKey)
+
+	return b.remote.Rename(ctx, b.remoteName(fromKey), b.remoteName(toKey), opts...)
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	from, err := b.unwrap(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	key, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if err := b.remote.Copy(ctx, from, to, opts...); err != nil {
+		return err
+	}
+
+	b.drop(key)
+
+	return nil
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	from, err := b.unwrap(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	key, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if err := b.remote.CopyAll(ctx, from, to, opts...); err != nil {
+		return err
+	}
+
+	return b.dropCopied(ctx, from, key)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+// Walk walks the remote bucket, after writing the dirty entries under the directory.
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	w, ok := b.remote.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	key, err := b.key(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := b.flush(ctx, key); err != nil {
+		return err
+	}
+
+	return w.Walk(ctx, b.remoteName(key), func(item bucketly.Item, err error) error {
+		if item != nil {
+			item = b.newItem(item)
+		}
+
+		return walkFunc(item, err)
+	})
+}
+
+// Items lists the remote bucket, after writing the dirty entries under the directory.
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	l, ok := b.remote.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.flush(context.Background(), key); err != nil {
+		return nil, err
+	}
+
+	it, err := l.Items(b.remoteName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+// Flush writes the dirty entries to the remote bucket.
+func (b *Bucket) Flush(ctx context.Context) error {
+	return b.flush(ctx, "")
+}
+
+// Clear empties the cache, after writing the dirty entries to the remote bucket.
+func (b *Bucket) Clear(ctx context.Context) error {
+	if err := b.flush(ctx, ""); err != nil {
+		return err
+	}
+
+	b.invalidate("")
+
+	return nil
+}
+
+// lookup returns the path of the cached content if still valid.
+func (b *Bucket) lookup(ctx context.Context, key string) (string, bool) {
+	b.mu.Lock()
+	el, ok := b.entries[key]
+	if !ok {
+		b.mu.Unlock()
+
+		return "", false
+	}
+
+	e := el.Value.(*entry)
+	if e.dirty || (b.config.maxAge > 0 && time.Since(e.validated) < b.config.maxAge) {
+		b.lru.MoveToFront(el)
+		b.mu.Unlock()
+
+		return e.path, true
+	}
+
+	version := e.version
+	b.mu.Unlock()
+
+	item, err := b.remote.Stat(ctx, b.remoteName(key))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	el, ok = b.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	e = el.Value.(*entry)
+	if e.version != version {
+		return "", false
+	}
+
+	if err != nil || !e.matches(item) {
+		b.remove(el)
+
+		return "", false
+	}
+
+	e.validated = time.Now()
+	b.lru.MoveToFront(el)
+
+	return e.path, true
+}
+
+// fetch copies the remote item in the cache directory.
+func (b *Bucket) fetch(ctx context.Context, key string, item bucketly.Item) (string, error) {
+	if b.config.maxSize > 0 && item.Size() > b.config.maxSize {
+		return "", errTooLarge
+	}
+
+	src, err := b.remote.NewReader(ctx, b.remoteName(key))
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmp, err := b.tempPath(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	dest, err := b.cache.NewWriter(ctx, tmp)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := io.Copy(dest, src)
+	if cerr := dest.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		b.cache.Remove(ctx, tmp)
+
+		return "", err
+	}
+
+	etag, _ := item.ETag()
+	e := &entry{
+		key:       key,
+		path:      cachePath(key),
+		size:      n,
+		etag:      etag,
+		modTime:   item.ModTime(),
+		validated: time.Now(),
+	}
+
+	if err := b.store(ctx, tmp, e); err != nil {
+		return "", err
+	}
+
+	return e.path, nil
+}
+
+// store moves the temporary file to the path of the entry and adds the entry to the cache.
+func (b *Bucket) store(ctx context.Context, tmp string, e *entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.cache.Rename(ctx, tmp, e.path); err != nil {
+		b.cache.Remove(ctx, tmp)
+
+		return err
+	}
+
+	if el, ok := b.entries[e.key]; ok {
+		b.size -= el.Value.(*entry).size
+		b.lru.Remove(el)
+	}
+
+	b.seq++
+	e.version = b.seq
+
+	b.entries[e.key] = b.lru.PushFront(e)
+	b.size += e.size
+	b.evict()
+
+	return nil
+}
+
+// evict removes the least recently used clean entries until the cache fits its size.
+func (b *Bucket) evict() {
+	if b.config.maxSize <= 0 {
+		return
+	}
+
+	for el := b.lru.Back(); el != nil && b.size > b.config.maxSize; {
+		prev := el.Prev()
+		if !el.Value.(*entry).dirty {
+			b.remove(el)
+			b.stats.Evictions++
+		}
+
+		el = prev
+	}
+}
+
+func (b *Bucket) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	b.cache.Remove(context.Background(), e.path)
+	b.lru.Remove(el)
+	delete(b.entries, e.key)
+	b.size -= e.size
+}
+
+// invalidate drops the cached entries at and under the key, including the dirty ones.
+func (b *Bucket) invalidate(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for k, el := range b.entries {
+		if isUnder(b, k, key) {
+			b.remove(el)
+		}
+	}
+}
+
+// drop drops the cached entry of the key, if any.
+func (b *Bucket) drop(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if el, ok := b.entries[key]; ok {
+		b.remove(el)
+	}
+}
+
+// dropCopied drops the cached entries overwritten by the copy of the item to the key, the entries
+// under the key without a counterpart in the copied directory are kept.
+func (b *Bucket) dropCopied(ctx context.Context, from bucketly.Item, key string) error {
+	if !from.IsDir() {
+		b.drop(key)
+
+		return nil
+	}
+
+	b.mu.Lock()
+	var keys []string
+	for k := range b.entries {
+		if isUnder(b, k, key) {
+			keys = append(keys, k)
+		}
+	}
+	b.mu.Unlock()
+
+	sep := string(b.PathSeparator())
+	for _, k := range keys {
+		rel := strings.TrimPrefix(strings.TrimPrefix(k, key), sep)
+		name := bucketly.Join(from.Bucket(), append([]string{from.Name()}, strings.Split(rel, sep)...)...)
+
+		exists, err := from.Bucket().Exists(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			b.drop(k)
+		}
+	}
+
+	return nil
+}
+
+// flush writes the dirty entries at and under the key to the remote bucket.
+func (b *Bucket) flush(ctx context.Context, key string) error {
+	b.mu.Lock()
+	var dirty []entry
+	for k, el := range b.entries {
+		if e := el.Value.(*entry); e.dirty && isUnder(b, k, key) {
+			dirty = append(dirty, *e)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, e := range dirty {
+		if err := b.upload(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shrink writes the least recently used dirty entries to the remote bucket, which evicts them, until
+// the cache fits its size.
+func (b *Bucket) shrink(ctx context.Context) error {
+	if b.config.maxSize <= 0 {
+		return nil
+	}
+
+	for {
+		var dirty *entry
+		b.mu.Lock()
+		for el := b.lru.Back(); el != nil && b.size > b.config.maxSize; el = el.Prev() {
+			if e := el.Value.(*entry); e.dirty {
+				dirty = e
+
+				break
+			}
+		}
+
+		if dirty == nil {
+			b.mu.Unlock()
+
+			return nil
+		}
+
+		e := *dirty
+		b.mu.Unlock()
+
+		if err := b.upload(ctx, e); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Bucket) upload(ctx context.Context, e entry) error {
+	src, err := b.cache.NewReader(ctx, e.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	item, err := b.put(ctx, e.key, src, e.mode, e.metadata)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if el, ok := b.entries[e.key]; ok {
+		if cur := el.Value.(*entry); cur.version == e.version {
+			cur.dirty = false
+			cur.etag, _ = item.ETag()
+			cur.modTime = item.ModTime()
+			cur.validated = time.Now()
+			b.evict()
+		}
+	}
+
+	return nil
+}
+
+// put writes the content to the remote bucket and returns the written item.
+func (b *Bucket) put(ctx context.Context, key string, r io.Reader, mode os.FileMode, metadata bucketly.Metadata) (bucketly.Item, error) {
+	var opts []bucketly.WriteOption
+	if mode != 0 {
+		opts = append(opts, bucketly.WithWriteMode(mode))
+	}
+
+	if metadata != nil {
+		opts = append(opts, bucketly.WithWriteMetadata(metadata))
+	}
+
+	dest, err := b.remote.NewWriter(ctx, b.remoteName(key), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(dest, r); err != nil {
+		dest.Close()
+
+		return nil, err
+	}
+
+	if err := dest.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.remote.Stat(ctx, b.remoteName(key))
+}
+
+func (b *Bucket) dirtyEntry(key string) (entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if el, ok := b.entries[key]; ok {
+		if e := el.Value.(*entry); e.dirty {
+			return *e, true
+		}
+	}
+
+	return entry{}, false
+}
+
+// unwrap returns the remote item of an item of the cache, so the remote bucket can use its own copy.
+func (b *Bucket) unwrap(ctx context.Context, item bucketly.Item) (bucketly.Item, error) {
+	if item.Bucket() != bucketly.Bucket(b) {
+		return item, nil
+	}
+
+	key, err := b.key(item.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.flush(ctx, key); err != nil {
+		return nil, err
+	}
+
+	remoteItem := bucketly.NewItem(b.remote, item.Name())
+	remoteItem.SetDir(item.IsDir())
+	remoteItem.SetSize(item.Size())
+	remoteItem.SetMode(item.Mode())
+	remoteItem.SetModeTime(item.ModTime())
+
+	return remoteItem, nil
+}
+
+func (b *Bucket) tempPath(ctx context.Context, key string) (string, error) {
+	path := cachePath(key)
+	if err := b.cache.MkdirAll(ctx, bucketly.Dir(b.cache, path)); err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	b.seq++
+	n := b.seq
+	b.mu.Unlock()
+
+	return fmt.Sprintf("%s.%d.tmp", path, n), nil
+}
+
+func (b *Bucket) count(counter *int64) {
+	b.mu.Lock()
+	*counter++
+	b.mu.Unlock()
+}
+
+func (b *Bucket) key(name string) (string, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(name, string(b.PathSeparator())), nil
+}
+
+func (b *Bucket) remoteName(key string) string {
+	if key == "" {
+		return string(b.PathSeparator())
+	}
+
+	return key
+}
+
+// newItem rebinds a remote item to the cache, so it is read through it.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	return bucketly.RebindItem(b, from.Name(), from)
+}
+
+func (e *entry) matches(item bucketly.Item) bool {
+	if etag, err := item.ETag(); err == nil && etag != "" && e.etag != "" {
+		return etag == e.etag
+	}
+
+	return item.Size() == e.size && item.ModTime().Equal(e.modTime)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.bucket.newItem(item), nil
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
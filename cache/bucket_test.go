@@ -0,0 +1,323 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/cache"
+	"github.com/vcraescu/bucketly/memory"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newBucket(t *testing.T, remote bucketly.Bucket, opts ...cache.Option) *cache.Bucket {
+	dir, err := ioutil.TempDir("", "bucketly-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	bucket, err := cache.NewBucket(remote, append([]cache.Option{cache.WithDir(dir)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func write(t *testing.T, bucket bucketly.Bucket, name string, content string) {
+	if _, err := bucket.Write(context.Background(), name, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBucket_ReadThrough(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	write(t, remote, "foo/bar.txt", "12345")
+	bucket := newBucket(t, remote)
+
+	for i := 0; i < 3; i++ {
+		content, err := bucket.Read(ctx, "foo/bar.txt")
+		if a.NoError(err) {
+			a.Equal([]byte("12345"), content)
+		}
+	}
+
+	stats := bucket.Stats()
+	a.Equal(int64(1), stats.Misses)
+	a.Equal(int64(2), stats.Hits)
+	a.Equal(int64(5), stats.Size)
+	a.Equal(1, stats.Entries)
+
+	write(t, remote, "foo/bar.txt", "123")
+
+	content, err := bucket.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("123"), content)
+	}
+
+	stats = bucket.Stats()
+	a.Equal(int64(2), stats.Misses)
+	a.Equal(int64(3), stats.Size)
+
+	a.NoError(remote.Remove(ctx, "foo/bar.txt"))
+
+	_, err = bucket.Read(ctx, "foo/bar.txt")
+	a.True(os.IsNotExist(err))
+	a.Equal(0, bucket.Stats().Entries)
+}
+
+func TestBucket_MaxAge(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	write(t, remote, "foo.txt", "12345")
+	bucket := newBucket(t, remote, cache.WithMaxAge(time.Hour))
+
+	_, err := bucket.Read(ctx, "foo.txt")
+	a.NoError(err)
+
+	write(t, remote, "foo.txt", "123")
+
+	content, err := bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	a.Equal(int64(1), bucket.Stats().Hits)
+}
+
+func TestBucket_Eviction(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		write(t, remote, name, "12345")
+	}
+	write(t, remote, "large.txt", "12345678901")
+	bucket := newBucket(t, remote, cache.WithMaxSize(10))
+
+	for _, name := range []string{"a.txt", "b.txt", "a.txt", "c.txt", "large.txt"} {
+		_, err := bucket.Read(ctx, name)
+		a.NoError(err, name)
+	}
+
+	stats := bucket.Stats()
+	a.Equal(int64(1), stats.Hits)
+	a.Equal(int64(4), stats.Misses)
+	a.Equal(int64(1), stats.Evictions)
+	a.Equal(int64(10), stats.Size)
+
+	_, err := bucket.Read(ctx, "a.txt")
+	a.NoError(err)
+	_, err = bucket.Read(ctx, "b.txt")
+	a.NoError(err)
+
+	stats = bucket.Stats()
+	a.Equal(int64(2), stats.Hits)
+	a.Equal(int64(5), stats.Misses)
+}
+
+func TestBucket_WriteThrough(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	bucket := newBucket(t, remote)
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"foo": "bar"}))
+	a.NoError(err)
+
+	content, err := remote.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	content, err = bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	stats := bucket.Stats()
+	a.Equal(int64(1), stats.Hits)
+	a.Equal(int64(0), stats.Misses)
+}
+
+func TestBucket_WriteBack(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	bucket := newBucket(t, remote, cache.WithMode(cache.WriteBack), cache.WithMaxSize(20))
+
+	_, err := bucket.Write(ctx, "foo/bar.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"foo": "bar"}))
+	a.NoError(err)
+	_, err = bucket.Write(ctx, "foo/baz.txt", []byte("1234567890"))
+	a.NoError(err)
+
+	exists, err := remote.Exists(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	item, err := bucket.Stat(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal(int64(5), item.Size())
+	}
+
+	content, err := bucket.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	a.Equal(int64(0), bucket.Stats().Evictions)
+	a.NoError(bucket.Flush(ctx))
+
+	content, err = remote.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	item, err = remote.Stat(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		metadata, err := item.Metadata()
+		if a.NoError(err) {
+			a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+		}
+	}
+
+	stats := bucket.Stats()
+	a.Equal(int64(0), stats.Evictions)
+	a.Equal(2, stats.Entries)
+}
+
+func TestBucket_WriteBackMaxSize(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	bucket := newBucket(t, remote, cache.WithMode(cache.WriteBack), cache.WithMaxSize(10))
+
+	write(t, bucket, "foo.txt", "12345")
+	write(t, bucket, "bar.txt", "1234567890")
+
+	content, err := remote.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	exists, err := remote.Exists(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	stats := bucket.Stats()
+	a.Equal(int64(1), stats.Evictions)
+	a.Equal(int64(10), stats.Size)
+	a.Equal(1, stats.Entries)
+}
+
+func TestBucket_WriteBackMkdirAll(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	bucket := newBucket(t, remote, cache.WithMode(cache.WriteBack))
+
+	write(t, bucket, "foo/bar.txt", "12345")
+	a.NoError(bucket.MkdirAll(ctx, "foo"))
+
+	content, err := remote.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	content, err = bucket.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+}
+
+func TestBucket_WriteBackCopyAll(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	write(t, remote, "foo/a.txt", "remote")
+	bucket := newBucket(t, remote, cache.WithMode(cache.WriteBack))
+
+	write(t, bucket, "bar/a.txt", "dirty")
+	write(t, bucket, "bar/b.txt", "dirty")
+
+	a.NoError(bucket.CopyAll2(ctx, "foo", "bar"))
+
+	content, err := bucket.Read(ctx, "bar/a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("remote"), content)
+	}
+
+	content, err = bucket.Read(ctx, "bar/b.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("dirty"), content)
+	}
+
+	a.NoError(bucket.Flush(ctx))
+
+	content, err = remote.Read(ctx, "bar/a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("remote"), content)
+	}
+
+	content, err = remote.Read(ctx, "bar/b.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("dirty"), content)
+	}
+}
+
+func TestNewBucket_Restart(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	remote := memory.NewBucket("remote")
+	write(t, remote, "foo.txt", "12345")
+	write(t, remote, "bar.txt", "12345")
+
+	dir, err := ioutil.TempDir("", "bucketly-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keep := filepath.Join(dir, "keep.txt")
+	if err := ioutil.WriteFile(keep, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"foo.txt", "bar.txt"} {
+		bucket, err := cache.NewBucket(remote, cache.WithDir(dir))
+		if !a.NoError(err) {
+			return
+		}
+
+		_, err = bucket.Read(ctx, name)
+		a.NoError(err)
+	}
+
+	// the content cached by the first bucket, which the second one doesn't track, is gone, the file
+	// of the caller is kept
+	var files int
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files++
+		}
+
+		return err
+	})
+	if a.NoError(err) {
+		a.Equal(2, files)
+	}
+
+	a.FileExists(keep)
+}
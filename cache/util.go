@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/vcraescu/bucketly"
+	"path/filepath"
+	"strings"
+)
+
+// cachePath returns the path of the cached content of the key. The keys are hashed so a key can be
+// both a file and the prefix of other keys.
+func cachePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+
+	return filepath.Join(name[:2], name)
+}
+
+// isUnder reports whether key is the prefix key or under it. The empty prefix is the root.
+func isUnder(b bucketly.PathSeparable, key string, prefix string) bool {
+	if prefix == "" || key == prefix {
+		return true
+	}
+
+	return strings.HasPrefix(key, prefix+string(b.PathSeparator()))
+}
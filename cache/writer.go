@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"hash"
+	"io"
+	"time"
+)
+
+type writer struct {
+	ctx    context.Context
+	bucket *Bucket
+	key    string
+	tmp    string
+	opts   *bucketly.WriteOptions
+	w      io.WriteCloser
+	hash   hash.Hash
+	size   int64
+	closed bool
+}
+
+func (b *Bucket) newWriter(ctx context.Context, key string, opts *bucketly.WriteOptions) (*writer, error) {
+	tmp, err := b.tempPath(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := b.cache.NewWriter(ctx, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writer{
+		ctx:    ctx,
+		bucket: b,
+		key:    key,
+		tmp:    tmp,
+		opts:   opts,
+		w:      w,
+		hash:   md5.New(),
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("%s: writer is closed", w.key)
+	}
+
+	n, err := w.w.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	b := w.bucket
+	if err := w.w.Close(); err != nil {
+		b.cache.Remove(w.ctx, w.tmp)
+
+		return err
+	}
+
+	now := time.Now()
+	e := &entry{
+		key:       w.key,
+		path:      cachePath(w.key),
+		size:      w.size,
+		modTime:   now,
+		validated: now,
+		mode:      w.opts.Mode,
+		metadata:  w.opts.Metadata,
+	}
+
+	if b.config.mode == WriteBack {
+		e.dirty = true
+		e.etag = fmt.Sprintf(`"%x"`, w.hash.Sum(nil))
+
+		if err := b.store(w.ctx, w.tmp, e); err != nil {
+			return err
+		}
+
+		return b.shrink(w.ctx)
+	}
+
+	src, err := b.cache.NewReader(w.ctx, w.tmp)
+	if err != nil {
+		b.cache.Remove(w.ctx, w.tmp)
+
+		return err
+	}
+
+	item, err := b.put(w.ctx, w.key, src, w.opts.Mode, w.opts.Metadata)
+	src.Close()
+	if err != nil {
+		b.cache.Remove(w.ctx, w.tmp)
+		b.invalidate(w.key)
+
+		return err
+	}
+
+	if b.config.maxSize > 0 && w.size > b.config.maxSize {
+		b.cache.Remove(w.ctx, w.tmp)
+		b.invalidate(w.key)
+
+		return nil
+	}
+
+	e.etag, _ = item.ETag()
+	e.modTime = item.ModTime()
+
+	return b.store(w.ctx, w.tmp, e)
+}
+
+func (w *writer) abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	w.w.Close()
+	w.bucket.cache.Remove(w.ctx, w.tmp)
+}
@@ -0,0 +1,381 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vcraescu/bucketly"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	blobsDir = "sha256"
+	refsDir  = "refs"
+	tmpDir   = "tmp"
+)
+
+var (
+	// ErrDigestMismatch is returned when the content of a blob doesn't match its digest.
+	ErrDigestMismatch = errors.New("blob content does not match its digest")
+	// ErrInvalidDigest is returned for a digest which is not a hex encoded SHA-256 hash.
+	ErrInvalidDigest = errors.New("invalid digest")
+)
+
+type (
+	// Digest is the hex encoded SHA-256 hash of a blob content.
+	Digest string
+
+	// Store keeps blobs in a bucket under their digest, so the same content is only stored once.
+	// Blobs are kept by the references pointing at them and the unreferenced ones are deleted by
+	// GC. The layout of the bucket is:
+	//
+	//	sha256/ab/cd/abcd...	the blobs
+	//	refs/<name>		the references, holding the digest of a blob
+	//	tmp/<uuid>		the blobs being written
+	//
+	// Use bucketly.Sub to keep the store in a directory of a bucket.
+	Store struct {
+		bucket bucketly.Bucket
+	}
+
+	// GCStats reports what a garbage collection did.
+	GCStats struct {
+		Deleted int
+		Freed   int64
+		Kept    int
+	}
+
+	verifyingReader struct {
+		r      io.ReadCloser
+		hash   hash.Hash
+		digest Digest
+	}
+)
+
+func NewStore(b bucketly.Bucket) *Store {
+	return &Store{bucket: b}
+}
+
+// ParseDigest validates a digest.
+func ParseDigest(s string) (Digest, error) {
+	if len(s) != sha256.Size*2 || strings.ToLower(s) != s {
+		return "", fmt.Errorf("%w %s", ErrInvalidDigest, s)
+	}
+
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", fmt.Errorf("%w %s", ErrInvalidDigest, s)
+	}
+
+	return Digest(s), nil
+}
+
+// Sum returns the digest of the content.
+func Sum(data []byte) Digest {
+	sum := sha256.Sum256(data)
+
+	return Digest(hex.EncodeToString(sum[:]))
+}
+
+func (d Digest) String() string {
+	return string(d)
+}
+
+func (s *Store) Bucket() bucketly.Bucket {
+	return s.bucket
+}
+
+// Put stores the content and returns its digest. The content is written to a temporary item first
+// and moved under its digest. An existing blob is replaced by the same content, which refreshes its
+// modification time so GC keeps it for the grace period, until it is referenced again.
+func (s *Store) Put(ctx context.Context, r io.Reader) (Digest, error) {
+	// the buckets with real directories don't create the parents of the written and renamed items
+	if err := s.bucket.MkdirAll(ctx, tmpDir); err != nil {
+		return "", err
+	}
+
+	tmp := bucketly.Join(s.bucket, tmpDir, uuid.New().String())
+	w, err := s.bucket.NewWriter(ctx, tmp)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(w, io.TeeReader(r, h)); err != nil {
+		w.Close()
+		s.bucket.Remove(ctx, tmp)
+
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		s.bucket.Remove(ctx, tmp)
+
+		return "", err
+	}
+
+	d := Digest(hex.EncodeToString(h.Sum(nil)))
+	if err := s.bucket.MkdirAll(ctx, bucketly.Dir(s.bucket, s.path(d))); err != nil {
+		s.bucket.Remove(ctx, tmp)
+
+		return "", err
+	}
+
+	if err := s.bucket.Rename(ctx, tmp, s.path(d)); err != nil {
+		s.bucket.Remove(ctx, tmp)
+
+		return "", err
+	}
+
+	return d, nil
+}
+
+// PutBytes stores the content like Put and returns its digest.
+func (s *Store) PutBytes(ctx context.Context, data []byte) (Digest, error) {
+	return s.Put(ctx, bytes.NewReader(data))
+}
+
+// Get returns a reader of the blob which fails with ErrDigestMismatch once the whole content was
+// read when it doesn't match the digest.
+func (s *Store) Get(ctx context.Context, d Digest) (io.ReadCloser, error) {
+	if _, err := ParseDigest(string(d)); err != nil {
+		return nil, err
+	}
+
+	r, err := s.bucket.NewReader(ctx, s.path(d))
+	if err != nil {
+		return nil, err
+	}
+
+	return &verifyingReader{
+		r:      r,
+		hash:   sha256.New(),
+		digest: d,
+	}, nil
+}
+
+// Read returns the verified content of the blob.
+func (s *Store) Read(ctx context.Context, d Digest) ([]byte, error) {
+	r, err := s.Get(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// Verify reads the blob and checks its content matches the digest.
+func (s *Store) Verify(ctx context.Context, d Digest) error {
+	r, err := s.Get(ctx, d)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(ioutil.Discard, r)
+
+	return err
+}
+
+func (s *Store) Has(ctx context.Context, d Digest) (bool, error) {
+	if _, err := ParseDigest(string(d)); err != nil {
+		return false, err
+	}
+
+	return s.bucket.Exists(ctx, s.path(d))
+}
+
+// Delete removes the blob, even when it is still referenced.
+func (s *Store) Delete(ctx context.Context, d Digest) error {
+	if _, err := ParseDigest(string(d)); err != nil {
+		return err
+	}
+
+	return s.bucket.Remove(ctx, s.path(d))
+}
+
+// SetRef points the reference to the blob, which must exist.
+func (s *Store) SetRef(ctx context.Context, name string, d Digest) error {
+	key, err := s.refKey(name)
+	if err != nil {
+		return err
+	}
+
+	exists, err := s.Has(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("blob %s: %w", d, os.ErrNotExist)
+	}
+
+	_, err = s.bucket.Write(ctx, key, []byte(d))
+
+	return err
+}
+
+// Ref returns the digest of the blob the reference points to.
+func (s *Store) Ref(ctx context.Context, name string) (Digest, error) {
+	key, err := s.refKey(name)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := s.bucket.Read(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	return ParseDigest(string(bytes.TrimSpace(content)))
+}
+
+func (s *Store) RemoveRef(ctx context.Context, name string) error {
+	key, err := s.refKey(name)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.Remove(ctx, key)
+}
+
+// Refs returns the digests of the blobs by reference name.
+func (s *Store) Refs(ctx context.Context) (map[string]Digest, error) {
+	refs := make(map[string]Digest)
+	prefix := refsDir + string(s.bucket.PathSeparator())
+	err := s.walk(ctx, refsDir, func(item bucketly.Item) error {
+		name := strings.TrimPrefix(item.Name(), prefix)
+		d, err := s.Ref(ctx, name)
+		if err != nil {
+			return fmt.Errorf("ref %s: %w", name, err)
+		}
+
+		refs[name] = d
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// GC deletes the blobs which are not referenced and the leftovers of interrupted writes. Only the
+// items older than the grace period are deleted, so the blobs just written have time to be
+// referenced.
+func (s *Store) GC(ctx context.Context, gracePeriod time.Duration) (*GCStats, error) {
+	refs, err := s.Refs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[Digest]bool, len(refs))
+	for _, d := range refs {
+		referenced[d] = true
+	}
+
+	deadline := time.Now().Add(-gracePeriod)
+	stats := &GCStats{}
+	var garbage []bucketly.Item
+	err = s.walk(ctx, blobsDir, func(item bucketly.Item) error {
+		d, err := ParseDigest(bucketly.Base(s.bucket, item.Name()))
+		if (err == nil && referenced[d]) || item.ModTime().After(deadline) {
+			stats.Kept++
+
+			return nil
+		}
+
+		garbage = append(garbage, item)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.walk(ctx, tmpDir, func(item bucketly.Item) error {
+		if item.ModTime().Before(deadline) {
+			garbage = append(garbage, item)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range garbage {
+		if err := s.bucket.Remove(ctx, item.Name()); err != nil {
+			return stats, err
+		}
+
+		stats.Deleted++
+		stats.Freed += item.Size()
+	}
+
+	return stats, nil
+}
+
+// path returns the name of the blob in the bucket.
+func (s *Store) path(d Digest) string {
+	return bucketly.Join(s.bucket, blobsDir, string(d[:2]), string(d[2:4]), string(d))
+}
+
+func (s *Store) refKey(name string) (string, error) {
+	key, err := bucketly.Sanitize(s.bucket, name)
+	if err != nil {
+		return "", err
+	}
+
+	key = strings.Trim(key, string(s.bucket.PathSeparator()))
+	if key == "" {
+		return "", errors.New("empty reference name")
+	}
+
+	return bucketly.Join(s.bucket, refsDir, key), nil
+}
+
+// walk calls the function for every file under the directory.
+func (s *Store) walk(ctx context.Context, dir string, fn func(item bucketly.Item) error) error {
+	w, ok := s.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if item.IsDir() {
+			return nil
+		}
+
+		return fn(item)
+	})
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.hash.Write(p[:n])
+
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != string(r.digest) {
+		return n, fmt.Errorf("blob %s: %w", r.digest, ErrDigestMismatch)
+	}
+
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.r.Close()
+}
@@ -0,0 +1,191 @@
+package cas_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/cas"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func blobNames(t *testing.T, bucket bucketly.Walkable) []string {
+	var names []string
+	err := bucket.Walk(context.Background(), "/", func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			names = append(names, item.Name())
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return names
+}
+
+func TestStore_Put(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("artifacts")
+	store := cas.NewStore(bucket)
+
+	d, err := store.Put(ctx, bytes.NewReader([]byte("hello")))
+	if !a.NoError(err) {
+		return
+	}
+
+	const expected = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	a.Equal(cas.Digest(expected), d)
+
+	d, err = store.PutBytes(ctx, []byte("hello"))
+	if a.NoError(err) {
+		a.Equal(cas.Digest(expected), d)
+	}
+
+	d, err = store.Put(ctx, bytes.NewReader([]byte("hello")))
+	if a.NoError(err) {
+		a.Equal(cas.Digest(expected), d)
+	}
+
+	a.Equal([]string{"sha256/2c/f2/" + expected}, blobNames(t, bucket))
+
+	a.Error(store.SetRef(ctx, "", d))
+	a.Error(store.SetRef(ctx, "/", d))
+
+	content, err := store.Read(ctx, d)
+	if a.NoError(err) {
+		a.Equal([]byte("hello"), content)
+	}
+
+	_, err = store.Read(ctx, cas.Sum([]byte("missing")))
+	a.True(os.IsNotExist(err))
+
+	_, err = store.Read(ctx, "../secret")
+	a.True(errors.Is(err, cas.ErrInvalidDigest))
+}
+
+func TestStore_Local(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "bucketly-cas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := cas.NewStore(local.NewBucket(dir))
+
+	d, err := store.PutBytes(ctx, []byte("hello"))
+	if !a.NoError(err) {
+		return
+	}
+
+	d, err = store.PutBytes(ctx, []byte("hello"))
+	if !a.NoError(err) {
+		return
+	}
+
+	a.NoError(store.SetRef(ctx, "builds/1/app.tar", d))
+
+	content, err := store.Read(ctx, d)
+	if a.NoError(err) {
+		a.Equal([]byte("hello"), content)
+	}
+
+	stats, err := store.GC(ctx, 0)
+	if a.NoError(err) {
+		a.Equal(&cas.GCStats{Kept: 1}, stats)
+	}
+}
+
+func TestStore_Verify(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("artifacts")
+	store := cas.NewStore(bucket)
+
+	d, err := store.PutBytes(ctx, []byte("hello"))
+	a.NoError(err)
+	a.NoError(store.Verify(ctx, d))
+
+	_, err = bucket.Write(ctx, "sha256/2c/f2/"+d.String(), []byte("hellO"))
+	a.NoError(err)
+
+	a.True(errors.Is(store.Verify(ctx, d), cas.ErrDigestMismatch))
+
+	_, err = store.Read(ctx, d)
+	a.True(errors.Is(err, cas.ErrDigestMismatch))
+}
+
+func TestStore_GC(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("artifacts")
+	store := cas.NewStore(bucket)
+
+	kept, err := store.PutBytes(ctx, []byte("kept"))
+	a.NoError(err)
+	garbage, err := store.PutBytes(ctx, []byte("garbage"))
+	a.NoError(err)
+	_, err = bucket.Write(ctx, "tmp/interrupted", []byte("partial"))
+	a.NoError(err)
+
+	a.NoError(store.SetRef(ctx, "builds/1/app.tar", kept))
+	a.NoError(store.SetRef(ctx, "builds/2/app.tar", garbage))
+	a.True(os.IsNotExist(errors.Unwrap(store.SetRef(ctx, "builds/3/app.tar", cas.Sum([]byte("missing"))))))
+	a.NoError(store.RemoveRef(ctx, "builds/2/app.tar"))
+
+	refs, err := store.Refs(ctx)
+	if a.NoError(err) {
+		a.Equal(map[string]cas.Digest{"builds/1/app.tar": kept}, refs)
+	}
+
+	stats, err := store.GC(ctx, time.Hour)
+	if a.NoError(err) {
+		a.Equal(&cas.GCStats{Kept: 2}, stats)
+	}
+
+	stats, err = store.GC(ctx, 0)
+	if a.NoError(err) {
+		a.Equal(&cas.GCStats{Deleted: 2, Freed: 14, Kept: 1}, stats)
+	}
+
+	a.Equal([]string{"refs/builds/1/app.tar", "sha256/" + kept.String()[:2] + "/" + kept.String()[2:4] + "/" + kept.String()}, blobNames(t, bucket))
+}
+
+func TestStore_GCPutAgain(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("artifacts")
+	store := cas.NewStore(bucket)
+
+	d, err := store.PutBytes(ctx, []byte("hello"))
+	a.NoError(err)
+
+	// putting the blob again gives it a new grace period to be referenced
+	time.Sleep(50 * time.Millisecond)
+	_, err = store.Put(ctx, bytes.NewReader([]byte("hello")))
+	a.NoError(err)
+
+	stats, err := store.GC(ctx, 40*time.Millisecond)
+	if a.NoError(err) {
+		a.Equal(&cas.GCStats{Kept: 1}, stats)
+	}
+
+	has, err := store.Has(ctx, d)
+	if a.NoError(err) {
+		a.True(has)
+	}
+}
@@ -0,0 +1,430 @@
+package compress
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+type (
+	// Bucket compresses the content written to the wrapped bucket and decompresses it when read.
+	// The codec and the original size are stored in the item metadata, so items written without
+	// the wrapper are read as they are. Content that is already compressed, detected from its
+	// extension or from the content type and encoding found in its metadata, is stored as it is.
+	// The wrapped bucket must keep the metadata of the items.
+	Bucket struct {
+		bucket bucketly.Bucket
+		config Config
+	}
+
+	Config struct {
+		codec      Codec
+		level      int
+		extensions []string
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		bucket *Bucket
+		it     bucketly.ListIterator
+	}
+)
+
+// WithCodec sets the codec used to compress the written items, Gzip by default.
+func WithCodec(codec Codec) Option {
+	return func(cfg *Config) {
+		cfg.codec = codec
+	}
+}
+
+// WithLevel sets the compression level of the codec, 0 uses its default level.
+func WithLevel(level int) Option {
+	return func(cfg *Config) {
+		cfg.level = level
+	}
+}
+
+// WithSkipExtensions adds extensions, e.g. ".parquet", of content that is stored uncompressed.
+func WithSkipExtensions(exts ...string) Option {
+	return func(cfg *Config) {
+		for _, ext := range exts {
+			cfg.extensions = append(cfg.extensions, strings.ToLower(ext))
+		}
+	}
+}
+
+func NewBucket(b bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		codec:      Gzip,
+		extensions: append([]string(nil), compressedExtensions...),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.codec != Gzip && cfg.codec != Zstd {
+		return nil, fmt.Errorf("unsupported codec %s", cfg.codec)
+	}
+
+	if !cfg.codec.validLevel(cfg.level) {
+		return nil, fmt.Errorf("invalid %s compression level %d", cfg.codec, cfg.level)
+	}
+
+	// the codec is stored in the metadata, without it the content would be read compressed
+	if !bucketly.StoresMetadata(b) {
+		return nil, fmt.Errorf("bucket %s does not store the item metadata: %w", b.Name(), bucketly.ErrNotSupported)
+	}
+
+	return &Bucket{
+		bucket: b,
+		config: cfg,
+	}, nil
+}
+
+func (b *Bucket) Parent() bucketly.Bucket {
+	return b.bucket
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.bucket)
+}
+
+func (b *Bucket) Name() string {
+	return b.bucket.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.bucket.PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	metadata, err := item.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := b.bucket.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, _, ok := parseCodec(metadata)
+	if !ok {
+		return r, nil
+	}
+
+	cr, err := codec.newReader(r)
+	if err != nil {
+		r.Close()
+
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return cr, nil
+}
+
+// Write compresses the content before writing it, so a failed compression leaves the item as it is.
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	if isCompressed(name, wo.Metadata, b.config.extensions) {
+		if wo.Metadata != nil {
+			opts = append(opts, bucketly.WithWriteMetadata(wo.Metadata.Without(metaPrefix)))
+		}
+
+		return b.bucket.Write(ctx, name, data, opts...)
+	}
+
+	compressed, err := b.config.codec.compress(data, b.config.level)
+	if err != nil {
+		return 0, err
+	}
+
+	metadata := codecMetadata(wo.Metadata, b.config.codec, int64(len(data)))
+	opts = append(opts, bucketly.WithWriteMetadata(metadata))
+	if _, err := b.bucket.Write(ctx, name, compressed, opts...); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// NewWriter returns a writer that compresses the content unless it is already compressed. The
+// original size is not known until the writer is closed, so the compressed content is kept in a
+// temporary file and only written to the wrapped bucket by Close.
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	if isCompressed(name, wo.Metadata, b.config.extensions) {
+		if wo.Metadata != nil {
+			opts = append(opts, bucketly.WithWriteMetadata(wo.Metadata.Without(metaPrefix)))
+		}
+
+		return b.bucket.NewWriter(ctx, name, opts...)
+	}
+
+	return b.newWriter(ctx, name, opts, wo.Metadata)
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bucket.Exists(ctx, name)
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	return b.bucket.Remove(ctx, name)
+}
+
+// Stat returns the item with its original size and without the compression metadata.
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.bucket.Mkdir(ctx, name, opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.bucket.MkdirAll(ctx, name, opts...)
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	return b.bucket.Chmod(ctx, name, mode)
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	return b.bucket.RemoveAll(ctx, name)
+}
+
+// Rename keeps the codec of the file when its metadata is replaced.
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if co.Metadata != nil {
+		item, err := b.bucket.Stat(ctx, from)
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			metadata, err := item.Metadata()
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, bucketly.WithCopyMetadata(replaceMetadata(metadata, co.Metadata)))
+		}
+	}
+
+	return b.bucket.Rename(ctx, from, to, opts...)
+}
+
+// Copy copies the compressed content as is when the item belongs to the bucket and compresses it
+// otherwise.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.bucket.Copy(ctx, from, to, opts...)
+	}
+
+	if from.Bucket() == bucketly.Bucket(b) {
+		return b.copyCompressed(ctx, from, to, co, opts)
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	if co.Mode == 0 {
+		co.Mode = from.Mode().Perm()
+	}
+
+	writeOpts := []bucketly.WriteOption{bucketly.WithWriteMetadata(co.Metadata)}
+	if co.Mode != 0 {
+		writeOpts = append(writeOpts, bucketly.WithWriteMode(co.Mode))
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// canceling the context aborts the upload of the content stored as it is
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dest, err := b.NewWriter(ctx, to, writeOpts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		cancel()
+		if w, ok := dest.(*writer); ok {
+			w.abort()
+		} else {
+			dest.Close()
+		}
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if item != nil {
+			item = b.newItem(item)
+		}
+
+		return walkFunc(item, err)
+	})
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	l, ok := b.bucket.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+// copyCompressed copies an item of the bucket without decompressing it.
+func (b *Bucket) copyCompressed(ctx context.Context, from bucketly.Item, to string, co *bucketly.CopyOptions, opts []bucketly.CopyOption) error {
+	item, err := b.bucket.Stat(ctx, from.Name())
+	if err != nil {
+		return err
+	}
+
+	metadata, err := item.Metadata()
+	if err != nil {
+		return err
+	}
+
+	if co.Metadata != nil {
+		metadata = replaceMetadata(metadata, co.Metadata)
+	}
+
+	opts = append(opts, bucketly.WithCopyMetadata(metadata))
+
+	return b.bucket.Copy(ctx, item, to, opts...)
+}
+
+// newItem rebinds an item of the wrapped bucket, so it is decompressed when opened.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	item := bucketly.RebindItem(b, from.Name(), from)
+	item.SetMetadata(bucketly.Metadata{})
+	if from.IsDir() {
+		return item
+	}
+
+	metadata, err := from.Metadata()
+	if err != nil {
+		return item
+	}
+
+	item.SetMetadata(metadata.Without(metaPrefix))
+	if _, size, ok := parseCodec(metadata); ok && size >= 0 {
+		item.SetSize(size)
+	}
+
+	return item
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.bucket.newItem(item), nil
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
@@ -0,0 +1,251 @@
+package compress_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/blobadapter"
+	"github.com/vcraescu/bucketly/compress"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"gocloud.dev/blob/memblob"
+	"io"
+	"testing"
+)
+
+// countingBucket counts the copies.
+type countingBucket struct {
+	*memory.Bucket
+	copies int
+}
+
+func (b *countingBucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	b.copies++
+
+	return b.Bucket.Copy(ctx, from, to, opts...)
+}
+
+// failingBucket returns readers failing after the first byte.
+type failingBucket struct {
+	*memory.Bucket
+}
+
+type failingReader struct {
+	io.ReadCloser
+	read bool
+}
+
+func (b *failingBucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := b.Bucket.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failingReader{ReadCloser: r}, nil
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.read {
+		return 0, errors.New("read failed")
+	}
+	r.read = true
+
+	return r.ReadCloser.Read(p[:1])
+}
+
+func newBucket(t *testing.T, b bucketly.Bucket, opts ...compress.Option) *compress.Bucket {
+	bucket, err := compress.NewBucket(b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func TestBucket_RoundTrip(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("GET /index.html 200\n"), 100)
+
+	for _, codec := range []compress.Codec{compress.Gzip, compress.Zstd} {
+		parent := memory.NewBucket("parent")
+		bucket := newBucket(t, parent, compress.WithCodec(codec))
+
+		_, err := bucket.Write(ctx, "logs/access.log", content, bucketly.WithWriteMetadata(bucketly.Metadata{"owner": "foo"}))
+		a.NoError(err, codec)
+
+		actual, err := bucket.Read(ctx, "logs/access.log")
+		if a.NoError(err, codec) {
+			a.Equal(content, actual, codec)
+		}
+
+		item, err := bucket.Stat(ctx, "logs/access.log")
+		if a.NoError(err, codec) {
+			a.Equal(int64(len(content)), item.Size(), codec)
+
+			metadata, err := item.Metadata()
+			if a.NoError(err, codec) {
+				a.Equal(bucketly.Metadata{"owner": "foo"}, metadata, codec)
+			}
+		}
+
+		item, err = parent.Stat(ctx, "logs/access.log")
+		if a.NoError(err, codec) {
+			a.Less(item.Size(), int64(len(content)), codec)
+
+			metadata, err := item.Metadata()
+			if a.NoError(err, codec) {
+				a.Equal(string(codec), metadata["compress_codec"], codec)
+				a.Equal("2000", metadata["compress_size"], codec)
+			}
+		}
+	}
+}
+
+func TestBucket_NewWriter(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := &countingBucket{Bucket: memory.NewBucket("parent")}
+	bucket := newBucket(t, parent)
+
+	w, err := bucket.NewWriter(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := w.Write([]byte("12345"))
+		a.NoError(err)
+	}
+	a.NoError(w.Close())
+
+	// the original size is stored without copying the item onto itself
+	a.Equal(0, parent.copies)
+
+	item, err := bucket.Stat(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal(int64(50), item.Size())
+	}
+
+	content, err := bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal(bytes.Repeat([]byte("12345"), 10), content)
+	}
+}
+
+func TestBucket_SkipCompressed(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent, compress.WithSkipExtensions(".Parquet"))
+
+	for name, metadata := range map[string]bucketly.Metadata{
+		"archive.tar.gz": nil,
+		"photo.JPG":      nil,
+		"data.parquet":   nil,
+		"blob":           {"Content-Type": "application/zip"},
+		"video":          {"content_type": "video/mp4"},
+		"encoded.txt":    {"Content-Encoding": "br"},
+	} {
+		_, err := bucket.Write(ctx, name, []byte("12345"), bucketly.WithWriteMetadata(metadata))
+		a.NoError(err, name)
+
+		raw, err := parent.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte("12345"), raw, name)
+		}
+
+		content, err := bucket.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte("12345"), content, name)
+		}
+	}
+}
+
+func TestBucket_Copy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	src := memory.NewBucket("src")
+	_, err := src.Write(ctx, "docs/a.txt", []byte("12345"))
+	a.NoError(err)
+
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent)
+	a.NoError(bucket.CopyAll(ctx, bucketly.NewItem(src, "docs/"), "docs/"))
+	a.NoError(bucket.Copy2(ctx, "docs/a.txt", "copy.txt"))
+
+	for _, name := range []string{"docs/a.txt", "copy.txt"} {
+		content, err := bucket.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte("12345"), content, name)
+		}
+
+		raw, err := parent.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.NotEqual([]byte("12345"), raw, name)
+		}
+	}
+
+	dest := memory.NewBucket("dest")
+	a.NoError(dest.CopyAll(ctx, bucketly.NewItem(bucket, "docs/"), "plain/"))
+
+	content, err := dest.Read(ctx, "plain/a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+}
+
+func TestBucket_FailedCopy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	src := &failingBucket{Bucket: memory.NewBucket("src")}
+	_, err := src.Write(ctx, "foo.txt", []byte("12345"))
+	a.NoError(err)
+
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent)
+	a.Error(bucket.Copy(ctx, bucketly.NewItem(src, "foo.txt"), "foo.txt"))
+
+	exists, err := parent.Exists(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+}
+
+func TestBucket_Rename(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, blobadapter.NewBucket("parent", memblob.OpenBucket(nil)))
+	_, err := bucket.Write(ctx, "foo.txt", []byte("12345"))
+	a.NoError(err)
+
+	a.NoError(bucket.Rename(ctx, "foo.txt", "bar.txt", bucketly.WithCopyMetadata(bucketly.Metadata{"foo": "bar"})))
+
+	content, err := bucket.Read(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	item, err := bucket.Stat(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.Equal(int64(5), item.Size())
+
+		metadata, err := item.Metadata()
+		if a.NoError(err) {
+			a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+		}
+	}
+}
+
+func TestNewBucket_Invalid(t *testing.T) {
+	_, err := compress.NewBucket(memory.NewBucket("parent"), compress.WithCodec("lz4"))
+	assert.Error(t, err)
+
+	_, err = compress.NewBucket(memory.NewBucket("parent"), compress.WithLevel(10))
+	assert.Error(t, err)
+
+	_, err = compress.NewBucket(local.NewBucket("parent"))
+	assert.True(t, errors.Is(err, bucketly.ErrNotSupported))
+}
@@ -0,0 +1,128 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+)
+
+const (
+	Gzip Codec = "gzip"
+	Zstd Codec = "zstd"
+)
+
+type (
+	// Codec is the compression format stored in the metadata of the compressed items.
+	Codec string
+
+	reader struct {
+		r io.ReadCloser
+		d io.Reader
+		// close releases the decoder, the zstd one runs its own goroutines
+		close func()
+	}
+)
+
+func (c Codec) validLevel(level int) bool {
+	switch c {
+	case Gzip:
+		return level == 0 || (level >= gzip.HuffmanOnly && level <= gzip.BestCompression)
+	case Zstd:
+		return level >= 0 && level <= 22
+	}
+
+	return false
+}
+
+func (c Codec) newEncoder(w io.Writer, level int) (io.WriteCloser, error) {
+	var (
+		cw  io.WriteCloser
+		err error
+	)
+
+	switch c {
+	case Gzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		cw, err = gzip.NewWriterLevel(w, level)
+	case Zstd:
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+
+		cw, err = zstd.NewWriter(w, opts...)
+	default:
+		err = fmt.Errorf("unsupported codec %s", c)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+// compress returns the compressed content.
+func (c Codec) compress(data []byte, level int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	cw, err := c.newEncoder(buf, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := cw.Write(data); err != nil {
+		cw.Close()
+
+		return nil, err
+	}
+
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c Codec) newReader(r io.ReadCloser) (*reader, error) {
+	switch c {
+	case Gzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return &reader{
+			r:     r,
+			d:     gr,
+			close: func() { gr.Close() },
+		}, nil
+	case Zstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return &reader{
+			r:     r,
+			d:     zr,
+			close: zr.Close,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported codec %s", c)
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	return r.d.Read(p)
+}
+
+func (r *reader) Close() error {
+	r.close()
+
+	return r.r.Close()
+}
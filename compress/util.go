@@ -0,0 +1,129 @@
+package compress
+
+import (
+	"github.com/vcraescu/bucketly"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// The metadata keys are looked up with bucketly.Metadata.Get, which ignores their case.
+const (
+	metaPrefix = "compress_"
+	metaCodec  = metaPrefix + "codec"
+	metaSize   = metaPrefix + "size"
+)
+
+var (
+	// compressedExtensions are the extensions of the content that is already compressed.
+	compressedExtensions = []string{
+		".gz", ".tgz", ".zst", ".bz2", ".xz", ".lz4", ".lz", ".br", ".z", ".zip", ".7z", ".rar", ".jar",
+		".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".avif",
+		".mp3", ".aac", ".ogg", ".opus", ".flac", ".m4a",
+		".mp4", ".m4v", ".mkv", ".webm", ".mov", ".avi",
+		".woff", ".woff2", ".docx", ".xlsx", ".pptx", ".odt", ".epub",
+	}
+
+	compressedMediaTypes = []string{
+		"application/gzip",
+		"application/x-gzip",
+		"application/zstd",
+		"application/x-bzip2",
+		"application/x-xz",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+		"application/zip",
+		"image/jpeg",
+		"image/png",
+		"image/gif",
+		"image/webp",
+		"font/woff",
+		"font/woff2",
+	}
+)
+
+// codecMetadata returns the user metadata with the compression keys. A negative size is left out.
+func codecMetadata(user bucketly.Metadata, codec Codec, size int64) bucketly.Metadata {
+	m := user.Without(metaPrefix)
+	m[metaCodec] = string(codec)
+	if size >= 0 {
+		m[metaSize] = strconv.FormatInt(size, 10)
+	}
+
+	return m
+}
+
+// replaceMetadata returns the user metadata with the codec and the original size of the current
+// metadata of a compressed item.
+func replaceMetadata(current bucketly.Metadata, user bucketly.Metadata) bucketly.Metadata {
+	if codec, size, ok := parseCodec(current); ok {
+		return codecMetadata(user, codec, size)
+	}
+
+	return user.Without(metaPrefix)
+}
+
+// parseCodec returns the codec and the original size stored in the metadata. The size is -1 when
+// it is missing.
+func parseCodec(metadata bucketly.Metadata) (Codec, int64, bool) {
+	value, ok := metadata.Get(metaCodec)
+	if !ok {
+		return "", 0, false
+	}
+
+	size := int64(-1)
+	if value, ok := metadata.Get(metaSize); ok {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			size = n
+		}
+	}
+
+	return Codec(value), size, true
+}
+
+// isCompressed tells whether the content is already compressed from its extension, its content
+// type or its content encoding.
+func isCompressed(name string, metadata bucketly.Metadata, extensions []string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	for k, v := range metadata {
+		k = strings.ToLower(strings.Replace(k, "_", "-", -1))
+		switch k {
+		case "content-encoding":
+			if v != "" && !strings.EqualFold(v, "identity") {
+				return true
+			}
+		case "content-type":
+			if isCompressedMediaType(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isCompressedMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/") {
+		return true
+	}
+
+	for _, t := range compressedMediaTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package compress
+
+import (
+	"context"
+	"errors"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/internal/spool"
+	"io"
+)
+
+// writer compresses the content in a temporary file. The original size is only known once all the
+// content is written, so Close writes the compressed content to the wrapped bucket, with the size
+// in its metadata. Nothing reaches the wrapped bucket when the writer is aborted.
+type writer struct {
+	ctx      context.Context
+	bucket   *Bucket
+	name     string
+	opts     []bucketly.WriteOption
+	metadata bucketly.Metadata
+	file     *spool.File
+	c        io.WriteCloser
+	size     int64
+	closed   bool
+}
+
+func (b *Bucket) newWriter(ctx context.Context, name string, opts []bucketly.WriteOption, metadata bucketly.Metadata) (*writer, error) {
+	file, err := spool.New("bucketly-compress-")
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := b.config.codec.newEncoder(file, b.config.level)
+	if err != nil {
+		file.Remove()
+
+		return nil, err
+	}
+
+	return &writer{
+		ctx:      ctx,
+		bucket:   b,
+		name:     name,
+		opts:     opts,
+		metadata: metadata,
+		file:     file,
+		c:        c,
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("writer is closed")
+	}
+
+	n, err := w.c.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.file.Remove()
+
+	if err := w.c.Close(); err != nil {
+		return err
+	}
+
+	metadata := codecMetadata(w.metadata, w.bucket.config.codec, w.size)
+	opts := append(append([]bucketly.WriteOption(nil), w.opts...), bucketly.WithWriteMetadata(metadata))
+
+	return w.file.Upload(w.ctx, w.bucket.bucket, w.name, opts...)
+}
+
+func (w *writer) abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	w.c.Close()
+	w.file.Remove()
+}
@@ -0,0 +1,561 @@
+package encrypt
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// Algorithm is the content encryption stored in the metadata of the encrypted items.
+	Algorithm = "AES256-GCM-CHUNKED"
+
+	keySize          = 32
+	defaultChunkSize = 64 * 1024
+)
+
+var errNotEncrypted = errors.New("content is not encrypted")
+
+type (
+	// Bucket encrypts the content written to the wrapped bucket with a random data key per item.
+	// The data key is encrypted, or wrapped, with the current key and stored in the item metadata
+	// together with the id of that key, so older keys can still decrypt the items written with them
+	// until Rotate wraps the data keys again with the current key. The wrapped bucket must keep the
+	// metadata of the items.
+	Bucket struct {
+		bucket bucketly.Bucket
+		config Config
+	}
+
+	Config struct {
+		keyID     string
+		keys      map[string][]byte
+		chunkSize int
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		bucket *Bucket
+		it     bucketly.ListIterator
+	}
+)
+
+// WithKey sets the 32 bytes key used to wrap the data keys of the written items.
+func WithKey(id string, key []byte) Option {
+	return func(cfg *Config) {
+		cfg.keyID = id
+		cfg.keys[id] = key
+	}
+}
+
+// WithDecryptionKey adds a key, e.g. a previous one, only used to unwrap data keys.
+func WithDecryptionKey(id string, key []byte) Option {
+	return func(cfg *Config) {
+		cfg.keys[id] = key
+	}
+}
+
+// WithChunkSize sets the size of the plaintext chunks sealed separately.
+func WithChunkSize(size int) Option {
+	return func(cfg *Config) {
+		cfg.chunkSize = size
+	}
+}
+
+func NewBucket(b bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		keys:      make(map[string][]byte),
+		chunkSize: defaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.keyID == "" {
+		return nil, errors.New("encryption key is missing")
+	}
+
+	for id, key := range cfg.keys {
+		if len(key) != keySize {
+			return nil, fmt.Errorf("key %s must be %d bytes long", id, keySize)
+		}
+	}
+
+	if cfg.chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", cfg.chunkSize)
+	}
+
+	// the wrapped data key is stored in the metadata, it would be lost with it
+	if !bucketly.StoresMetadata(b) {
+		return nil, fmt.Errorf("bucket %s does not store the item metadata: %w", b.Name(), bucketly.ErrNotSupported)
+	}
+
+	return &Bucket{
+		bucket: b,
+		config: cfg,
+	}, nil
+}
+
+func (b *Bucket) Parent() bucketly.Bucket {
+	return b.bucket
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.bucket)
+}
+
+func (b *Bucket) Name() string {
+	return b.bucket.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.bucket.PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	metadata, err := item.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := parseHeader(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	aead, err := b.dataAEAD(h)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	r, err := b.bucket.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newReader(r, aead, h.chunkSize), nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.(*writer).abort()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	dataKey, err := randomBytes(keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := wrapKey(b.config.keys[b.config.keyID], b.config.keyID, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := randomBytes(prefixSize)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &header{
+		algorithm:  Algorithm,
+		keyID:      b.config.keyID,
+		wrappedKey: wrappedKey,
+		chunkSize:  b.config.chunkSize,
+	}
+
+	// the writer cancels the parent writer on a failed chunk, so no truncated ciphertext is stored
+	ctx, cancel := context.WithCancel(ctx)
+	opts = append(opts, bucketly.WithWriteMetadata(h.metadata(wo.Metadata)))
+	w, err := b.bucket.NewWriter(ctx, name, opts...)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	return newWriter(w, cancel, aead, prefix, h.chunkSize), nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bucket.Exists(ctx, name)
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	return b.bucket.Remove(ctx, name)
+}
+
+// Stat returns the item with its plaintext size and without the encryption metadata.
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.bucket.Mkdir(ctx, name, opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.bucket.MkdirAll(ctx, name, opts...)
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	return b.bucket.Chmod(ctx, name, mode)
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	return b.bucket.RemoveAll(ctx, name)
+}
+
+// Rename keeps the encryption header of the file when its metadata is replaced.
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if co.Metadata != nil {
+		item, err := b.bucket.Stat(ctx, from)
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			metadata, err := headerMetadata(item, co.Metadata)
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, bucketly.WithCopyMetadata(metadata))
+		}
+	}
+
+	return b.bucket.Rename(ctx, from, to, opts...)
+}
+
+// Copy copies the encrypted content as is when the item belongs to the bucket and encrypts it
+// otherwise.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.bucket.Copy(ctx, from, to, opts...)
+	}
+
+	if from.Bucket() == bucketly.Bucket(b) {
+		return b.copyEncrypted(ctx, from, to, co, opts)
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	if co.Mode == 0 {
+		co.Mode = from.Mode().Perm()
+	}
+
+	writeOpts := []bucketly.WriteOption{bucketly.WithWriteMetadata(co.Metadata)}
+	if co.Mode != 0 {
+		writeOpts = append(writeOpts, bucketly.WithWriteMode(co.Mode))
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := b.NewWriter(ctx, to, writeOpts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.(*writer).abort()
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if item != nil {
+			item = b.newItem(item)
+		}
+
+		return walkFunc(item, err)
+	})
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	l, ok := b.bucket.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+// Rotate wraps the data key of the item with the current key. The content is not encrypted again,
+// only the metadata of the item is replaced.
+func (b *Bucket) Rotate(ctx context.Context, name string) error {
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return b.rotate(ctx, item)
+}
+
+// RotateAll wraps the data keys of all the items under the directory with the current key.
+func (b *Bucket) RotateAll(ctx context.Context, dir string) error {
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	var items []bucketly.Item
+	err := w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			items = append(items, item)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := b.rotate(ctx, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) rotate(ctx context.Context, item bucketly.Item) error {
+	if item.IsDir() {
+		return nil
+	}
+
+	metadata, err := item.Metadata()
+	if err != nil {
+		return err
+	}
+
+	h, err := parseHeader(metadata)
+	if err != nil {
+		return fmt.Errorf("%s: %w", item.Name(), err)
+	}
+
+	if h.keyID == b.config.keyID {
+		return nil
+	}
+
+	dataKey, err := b.dataKey(h)
+	if err != nil {
+		return fmt.Errorf("%s: %w", item.Name(), err)
+	}
+
+	h.keyID = b.config.keyID
+	h.wrappedKey, err = wrapKey(b.config.keys[h.keyID], h.keyID, dataKey)
+	if err != nil {
+		return err
+	}
+
+	return b.bucket.Copy(ctx, item, item.Name(), bucketly.WithCopyMetadata(h.metadata(metadata)))
+}
+
+// copyEncrypted copies an item of the bucket without decrypting it, keeping its data key.
+func (b *Bucket) copyEncrypted(ctx context.Context, from bucketly.Item, to string, co *bucketly.CopyOptions, opts []bucketly.CopyOption) error {
+	item, err := b.bucket.Stat(ctx, from.Name())
+	if err != nil {
+		return err
+	}
+
+	metadata, err := item.Metadata()
+	if err != nil {
+		return err
+	}
+
+	if co.Metadata != nil {
+		metadata, err = headerMetadata(item, co.Metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts = append(opts, bucketly.WithCopyMetadata(metadata))
+
+	return b.bucket.Copy(ctx, item, to, opts...)
+}
+
+// headerMetadata returns the metadata with the encryption header of the encrypted item.
+func headerMetadata(item bucketly.Item, metadata bucketly.Metadata) (bucketly.Metadata, error) {
+	current, err := item.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := parseHeader(current)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", item.Name(), err)
+	}
+
+	return h.metadata(metadata), nil
+}
+
+func (b *Bucket) dataKey(h *header) ([]byte, error) {
+	key, ok := b.config.keys[h.keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", h.keyID)
+	}
+
+	return unwrapKey(key, h.keyID, h.wrappedKey)
+}
+
+func (b *Bucket) dataAEAD(h *header) (cipher.AEAD, error) {
+	dataKey, err := b.dataKey(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAEAD(dataKey)
+}
+
+// newItem rebinds an item of the wrapped bucket, so it is decrypted when opened.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	item := bucketly.RebindItem(b, from.Name(), from)
+	item.SetMetadata(bucketly.Metadata{})
+	if from.IsDir() {
+		return item
+	}
+
+	metadata, err := from.Metadata()
+	if err != nil {
+		return item
+	}
+
+	item.SetMetadata(metadata.Without(metaPrefix))
+	if h, err := parseHeader(metadata); err == nil {
+		item.SetSize(plainSize(from.Size(), h.chunkSize))
+	}
+
+	return item
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.bucket.newItem(item), nil
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
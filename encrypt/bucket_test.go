@@ -0,0 +1,266 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/blobadapter"
+	"github.com/vcraescu/bucketly/encrypt"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"gocloud.dev/blob/memblob"
+	"io"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// failingBucket returns writers failing their write number failAt once.
+type failingBucket struct {
+	*memory.Bucket
+	failAt int
+}
+
+type failingWriter struct {
+	io.WriteCloser
+	writes int
+	failAt int
+}
+
+func (b *failingBucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	w, err := b.Bucket.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failingWriter{WriteCloser: w, failAt: b.failAt}, nil
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes == w.failAt {
+		return 0, errors.New("write failed")
+	}
+
+	return w.WriteCloser.Write(p)
+}
+
+func newBucket(t *testing.T, b bucketly.Bucket, opts ...encrypt.Option) *encrypt.Bucket {
+	bucket, err := encrypt.NewBucket(b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func TestBucket_RoundTrip(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent, encrypt.WithKey("v1", newKey(t)), encrypt.WithChunkSize(16))
+
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 100} {
+		content := bytes.Repeat([]byte("x"), size)
+		_, err := bucket.Write(ctx, "foo.txt", content, bucketly.WithWriteMetadata(bucketly.Metadata{"owner": "foo"}))
+		if !a.NoError(err, size) {
+			continue
+		}
+
+		actual, err := bucket.Read(ctx, "foo.txt")
+		if a.NoError(err, size) {
+			a.Equal(content, actual, size)
+		}
+
+		item, err := bucket.Stat(ctx, "foo.txt")
+		if a.NoError(err, size) {
+			a.Equal(int64(size), item.Size(), size)
+
+			metadata, err := item.Metadata()
+			if a.NoError(err) {
+				a.Equal(bucketly.Metadata{"owner": "foo"}, metadata)
+			}
+		}
+
+		// a short plain text can show up in the random cipher text by chance
+		raw, err := parent.Read(ctx, "foo.txt")
+		if a.NoError(err, size) && size >= 8 {
+			a.False(bytes.Contains(raw, content), size)
+		}
+	}
+
+	item, err := parent.Stat(ctx, "foo.txt")
+	if a.NoError(err) {
+		metadata, err := item.Metadata()
+		if a.NoError(err) {
+			a.Equal(encrypt.Algorithm, metadata["encrypt_alg"])
+			a.Equal("v1", metadata["encrypt_key_id"])
+			a.NotEmpty(metadata["encrypt_key"])
+		}
+	}
+}
+
+func TestBucket_Tampering(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent, encrypt.WithKey("v1", newKey(t)), encrypt.WithChunkSize(16))
+
+	_, err := bucket.Write(ctx, "foo.txt", bytes.Repeat([]byte("x"), 40))
+	a.NoError(err)
+
+	item, err := parent.Stat(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, _ := item.Metadata()
+	raw, err := parent.Read(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-1] ^= 1
+
+	for name, content := range map[string][]byte{
+		"tampered":    tampered,
+		"truncated":   raw[:7+32],
+		"chunk_drop":  append(append([]byte(nil), raw[:7]...), raw[7+32:]...),
+		"header_only": raw[:7],
+	} {
+		_, err := parent.Write(ctx, name, content, bucketly.WithWriteMetadata(metadata))
+		a.NoError(err)
+
+		_, err = bucket.Read(ctx, name)
+		a.Error(err, name)
+	}
+
+	other := newBucket(t, parent, encrypt.WithKey("v1", newKey(t)))
+	_, err = other.Read(ctx, "foo.txt")
+	a.Error(err)
+}
+
+func TestBucket_Rotate(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	v1, v2 := newKey(t), newKey(t)
+	bucket := newBucket(t, parent, encrypt.WithKey("v1", v1))
+
+	for _, name := range []string{"foo/a.txt", "foo/b/c.txt"} {
+		_, err := bucket.Write(ctx, name, []byte(name))
+		a.NoError(err)
+	}
+
+	rawBefore, _ := parent.Read(ctx, "foo/a.txt")
+
+	rotated := newBucket(t, parent, encrypt.WithKey("v2", v2), encrypt.WithDecryptionKey("v1", v1))
+	a.NoError(rotated.RotateAll(ctx, "foo"))
+
+	rawAfter, _ := parent.Read(ctx, "foo/a.txt")
+	a.Equal(rawBefore, rawAfter)
+
+	current := newBucket(t, parent, encrypt.WithKey("v2", v2))
+	for _, name := range []string{"foo/a.txt", "foo/b/c.txt"} {
+		content, err := current.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte(name), content)
+		}
+	}
+
+	_, err := bucket.Read(ctx, "foo/a.txt")
+	a.Error(err)
+}
+
+func TestBucket_Copy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	src := memory.NewBucket("src")
+	_, err := src.Write(ctx, "docs/a.txt", []byte("12345"))
+	a.NoError(err)
+
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent, encrypt.WithKey("v1", newKey(t)))
+	a.NoError(bucket.CopyAll(ctx, bucketly.NewItem(src, "docs/"), "docs/"))
+	a.NoError(bucket.Copy2(ctx, "docs/a.txt", "copy.txt"))
+
+	for _, name := range []string{"docs/a.txt", "copy.txt"} {
+		content, err := bucket.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte("12345"), content, name)
+		}
+	}
+
+	dest := memory.NewBucket("dest")
+	a.NoError(dest.CopyAll(ctx, bucketly.NewItem(bucket, "docs/"), "plain/"))
+
+	content, err := dest.Read(ctx, "plain/a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+}
+
+func TestBucket_Rename(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, blobadapter.NewBucket("parent", memblob.OpenBucket(nil)), encrypt.WithKey("v1", newKey(t)))
+	_, err := bucket.Write(ctx, "foo.txt", []byte("12345"))
+	a.NoError(err)
+
+	a.NoError(bucket.Rename(ctx, "foo.txt", "bar.txt", bucketly.WithCopyMetadata(bucketly.Metadata{"foo": "bar"})))
+
+	content, err := bucket.Read(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	item, err := bucket.Stat(ctx, "bar.txt")
+	if a.NoError(err) {
+		metadata, err := item.Metadata()
+		if a.NoError(err) {
+			a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+		}
+	}
+}
+
+func TestNewBucket_InvalidKey(t *testing.T) {
+	_, err := encrypt.NewBucket(memory.NewBucket("parent"), encrypt.WithKey("v1", []byte("short")))
+	assert.Error(t, err)
+
+	_, err = encrypt.NewBucket(memory.NewBucket("parent"))
+	assert.Error(t, err)
+}
+
+func TestBucket_FailedWrite(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	// the prefix is the first write and the first chunk the second one
+	parent := &failingBucket{Bucket: memory.NewBucket("parent"), failAt: 3}
+	bucket := newBucket(t, parent, encrypt.WithKey("v1", newKey(t)), encrypt.WithChunkSize(16))
+
+	_, err := bucket.Write(ctx, "foo.txt", bytes.Repeat([]byte("x"), 40))
+	a.Error(err)
+
+	// the content committed by the wrapped bucket lacks its last chunk
+	_, err = bucket.Read(ctx, "foo.txt")
+	a.Error(err)
+}
+
+func TestNewBucket_WithoutMetadata(t *testing.T) {
+	_, err := encrypt.NewBucket(local.NewBucket("parent"), encrypt.WithKey("v1", newKey(t)))
+	assert.True(t, errors.Is(err, bucketly.ErrNotSupported))
+
+	_, err = encrypt.NewBucket(bucketly.Sub(local.NewBucket("parent"), "foo"), encrypt.WithKey("v1", newKey(t)))
+	assert.True(t, errors.Is(err, bucketly.ErrNotSupported))
+}
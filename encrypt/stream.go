@@ -0,0 +1,244 @@
+package encrypt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// The content is split in chunks sealed with the data key. The nonce of a chunk is made of a random
+// prefix, written at the start of the content, the index of the chunk and a flag set for the last
+// chunk, so reordered, dropped or truncated chunks are detected.
+const (
+	prefixSize = 7
+	nonceSize  = prefixSize + 4 + 1
+	tagSize    = 16
+)
+
+var (
+	errTruncated = errors.New("encrypted content is truncated")
+	errTooLarge  = errors.New("encrypted content is too large")
+)
+
+type (
+	writer struct {
+		w         io.WriteCloser
+		cancel    func()
+		aead      cipher.AEAD
+		prefix    []byte
+		counter   uint32
+		chunkSize int
+		buf       []byte
+		out       []byte
+		started   bool
+		closed    bool
+	}
+
+	reader struct {
+		r         io.ReadCloser
+		aead      cipher.AEAD
+		prefix    []byte
+		counter   uint32
+		chunkSize int
+		buf       []byte
+		carry     int
+		out       []byte
+		plain     []byte
+		last      bool
+		err       error
+	}
+)
+
+func newWriter(w io.WriteCloser, cancel func(), aead cipher.AEAD, prefix []byte, chunkSize int) *writer {
+	return &writer{
+		w:         w,
+		cancel:    cancel,
+		aead:      aead,
+		prefix:    prefix,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+	}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("writer is closed")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is sealed only once more data comes, the last one is sealed by Close
+		if len(w.buf) == w.chunkSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):w.chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.cancel()
+
+	if err := w.seal(true); err != nil {
+		w.cancel()
+		w.w.Close()
+
+		return err
+	}
+
+	return w.w.Close()
+}
+
+// abort closes the writer without sealing the last chunk, so the content written so far is
+// rejected as truncated when the wrapped bucket commits it anyway.
+func (w *writer) abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	w.cancel()
+	w.w.Close()
+}
+
+func (w *writer) seal(last bool) error {
+	if !w.started {
+		if _, err := w.w.Write(w.prefix); err != nil {
+			return err
+		}
+		w.started = true
+	}
+
+	if w.counter == math.MaxUint32 {
+		return errTooLarge
+	}
+
+	w.out = w.aead.Seal(w.out[:0], nonce(w.prefix, w.counter, last), w.buf, nil)
+	if _, err := w.w.Write(w.out); err != nil {
+		return err
+	}
+
+	w.counter++
+	w.buf = w.buf[:0]
+
+	return nil
+}
+
+func newReader(r io.ReadCloser, aead cipher.AEAD, chunkSize int) *reader {
+	return &reader{
+		r:         r,
+		aead:      aead,
+		chunkSize: chunkSize,
+		// one more byte tells whether the chunk is the last one
+		buf: make([]byte, chunkSize+tagSize+1),
+		out: make([]byte, 0, chunkSize),
+	}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		if r.last {
+			return 0, io.EOF
+		}
+
+		r.err = r.open()
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+
+	return n, nil
+}
+
+func (r *reader) Close() error {
+	return r.r.Close()
+}
+
+// open reads and decrypts the next chunk.
+func (r *reader) open() error {
+	if r.prefix == nil {
+		r.prefix = make([]byte, prefixSize)
+		if _, err := io.ReadFull(r.r, r.prefix); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errTruncated
+			}
+
+			return err
+		}
+	}
+
+	n, err := io.ReadFull(r.r, r.buf[r.carry:])
+	n += r.carry
+	r.carry = 0
+
+	chunk := r.buf[:n]
+	switch err {
+	case nil:
+		chunk = r.buf[:r.chunkSize+tagSize]
+	case io.EOF, io.ErrUnexpectedEOF:
+		r.last = true
+	default:
+		return err
+	}
+
+	if len(chunk) < tagSize {
+		return errTruncated
+	}
+
+	r.out, err = r.aead.Open(r.out[:0], nonce(r.prefix, r.counter, r.last), chunk, nil)
+	if err != nil {
+		return err
+	}
+
+	if !r.last {
+		// the extra byte starts the next chunk
+		r.buf[0] = r.buf[r.chunkSize+tagSize]
+		r.carry = 1
+	}
+
+	r.plain = r.out
+	r.counter++
+
+	return nil
+}
+
+func nonce(prefix []byte, counter uint32, last bool) []byte {
+	n := make([]byte, nonceSize)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], counter)
+	if last {
+		n[nonceSize-1] = 1
+	}
+
+	return n
+}
+
+// plainSize returns the size of the content encrypted in chunks of chunkSize bytes.
+func plainSize(size int64, chunkSize int) int64 {
+	size -= prefixSize
+	if size <= 0 {
+		return 0
+	}
+
+	sealed := int64(chunkSize + tagSize)
+	chunks := (size + sealed - 1) / sealed
+
+	return size - chunks*tagSize
+}
@@ -0,0 +1,123 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"strconv"
+)
+
+// The metadata keys are looked up with bucketly.Metadata.Get, which ignores their case.
+const (
+	metaPrefix    = "encrypt_"
+	metaAlgorithm = metaPrefix + "alg"
+	metaKeyID     = metaPrefix + "key_id"
+	metaKey       = metaPrefix + "key"
+	metaChunkSize = metaPrefix + "chunk_size"
+)
+
+type header struct {
+	algorithm  string
+	keyID      string
+	wrappedKey []byte
+	chunkSize  int
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// wrapKey encrypts the data key with the key encryption key. The key id is authenticated too.
+func wrapKey(kek []byte, keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+func unwrapKey(kek []byte, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+
+	nonce := wrapped[:aead.NonceSize()]
+	dataKey, err := aead.Open(nil, nonce, wrapped[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %w", err)
+	}
+
+	return dataKey, nil
+}
+
+func parseHeader(metadata bucketly.Metadata) (*header, error) {
+	algorithm, ok := metadata.Get(metaAlgorithm)
+	if !ok {
+		return nil, errNotEncrypted
+	}
+
+	if algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported encryption algorithm %s", algorithm)
+	}
+
+	keyID, _ := metadata.Get(metaKeyID)
+	encoded, _ := metadata.Get(metaKey)
+	wrappedKey, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key: %w", err)
+	}
+
+	value, _ := metadata.Get(metaChunkSize)
+	chunkSize, err := strconv.Atoi(value)
+	if err != nil || chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %s", value)
+	}
+
+	return &header{
+		algorithm:  algorithm,
+		keyID:      keyID,
+		wrappedKey: wrappedKey,
+		chunkSize:  chunkSize,
+	}, nil
+}
+
+// metadata returns the user metadata with the encryption keys of the header.
+func (h *header) metadata(user bucketly.Metadata) bucketly.Metadata {
+	m := user.Without(metaPrefix)
+	m[metaAlgorithm] = h.algorithm
+	m[metaKeyID] = h.keyID
+	m[metaKey] = base64.StdEncoding.EncodeToString(h.wrappedKey)
+	m[metaChunkSize] = strconv.Itoa(h.chunkSize)
+
+	return m
+}
@@ -0,0 +1,733 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/jlaffaye/ftp"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	pathSeparator       rune = '/'
+	defaultUser              = "anonymous"
+	defaultPassword          = "anonymous"
+	defaultTimeout           = 30 * time.Second
+	defaultMaxIdleConns      = 4
+)
+
+type (
+	Bucket struct {
+		name   string
+		config Config
+		pool   *connPool
+	}
+
+	Config struct {
+		addr         string
+		user         string
+		password     string
+		timeout      time.Duration
+		maxIdleConns int
+		tlsConfig    *tls.Config
+		disableEPSV  bool
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+
+	reader struct {
+		*ftp.Response
+		conn   *ftp.ServerConn
+		pool   *connPool
+		closed bool
+	}
+
+	writer struct {
+		pw     *io.PipeWriter
+		conn   *ftp.ServerConn
+		bucket *Bucket
+		path   string
+		done   chan error
+		closed bool
+	}
+)
+
+func WithAddress(addr string) Option {
+	return func(cfg *Config) {
+		cfg.addr = addr
+	}
+}
+
+func WithUser(user string) Option {
+	return func(cfg *Config) {
+		cfg.user = user
+	}
+}
+
+func WithPassword(password string) Option {
+	return func(cfg *Config) {
+		cfg.password = password
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.timeout = timeout
+	}
+}
+
+func WithMaxIdleConns(maxIdleConns int) Option {
+	return func(cfg *Config) {
+		cfg.maxIdleConns = maxIdleConns
+	}
+}
+
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(cfg *Config) {
+		cfg.tlsConfig = tlsConfig
+	}
+}
+
+// WithDisabledEPSV forces the legacy PASV command for opening passive data connections.
+func WithDisabledEPSV(disabled bool) Option {
+	return func(cfg *Config) {
+		cfg.disableEPSV = disabled
+	}
+}
+
+func NewBucket(name string, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		user:         defaultUser,
+		password:     defaultPassword,
+		timeout:      defaultTimeout,
+		maxIdleConns: defaultMaxIdleConns,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.addr == "" {
+		return nil, errors.New("ftp server address is missing")
+	}
+
+	return &Bucket{
+		name:   name,
+		config: cfg,
+		pool:   newConnPool(cfg),
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+// StoresMetadata reports false, the metadata of the items is not kept.
+func (b *Bucket) StoresMetadata() bool {
+	return false
+}
+
+func (b *Bucket) Close() error {
+	return b.pool.close()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	conn, err := b.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := conn.Retr(b.realPath(name))
+	if err != nil {
+		b.pool.put(conn, err)
+
+		return nil, err
+	}
+
+	return &reader{
+		Response: resp,
+		conn:     conn,
+		pool:     b.pool,
+	}, nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, name)); err != nil {
+		return 0, err
+	}
+
+	w, err := b.newWriter(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.abort(err)
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	return b.newWriter(ctx, name)
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		if item.IsDir() {
+			return conn.RemoveDir(b.realPath(name))
+		}
+
+		return conn.Delete(b.realPath(name))
+	})
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var item bucketly.Item
+	err = b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		item, err = b.stat(conn, name)
+
+		return err
+	})
+
+	return item, err
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	if name == string(b.PathSeparator()) {
+		return nil
+	}
+
+	return b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		return b.mkdir(conn, name)
+	})
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	if name == string(b.PathSeparator()) {
+		return nil
+	}
+
+	return b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		var current []string
+		for _, token := range strings.Split(name, string(b.PathSeparator())) {
+			current = append(current, token)
+			if err := b.mkdir(conn, strings.Join(current, string(b.PathSeparator()))); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	return b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		if name == string(b.PathSeparator()) {
+			return b.removeDirContents(conn, b.realPath(name))
+		}
+
+		item, err := b.stat(conn, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			return conn.Delete(b.realPath(name))
+		}
+
+		return b.removeDir(conn, b.realPath(name))
+	})
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, _ ...bucketly.CopyOption) error {
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, strings.TrimRight(to, string(b.PathSeparator())))); err != nil {
+		return err
+	}
+
+	return b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		return conn.Rename(b.realPath(from), b.realPath(to))
+	})
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, _ ...bucketly.CopyOption) error {
+	if from.IsDir() || isDirPath(from.Name()) {
+		return b.MkdirAll(ctx, to)
+	}
+
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, to)); err != nil {
+		return err
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := b.newWriter(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.abort(err)
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, strings.TrimRight(to, string(b.PathSeparator())))); err != nil {
+		return err
+	}
+
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	var items []bucketly.Item
+	err := b.withConn(ctx, func(conn *ftp.ServerConn) (err error) {
+		items, err = b.readDir(conn, dir)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) withConn(ctx context.Context, fn func(conn *ftp.ServerConn) error) error {
+	conn, err := b.pool.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(conn)
+	b.pool.put(conn, err)
+
+	return err
+}
+
+func (b *Bucket) newWriter(ctx context.Context, name string) (*writer, error) {
+	if isDirPath(name) {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	conn, err := b.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	w := &writer{
+		pw:     pw,
+		conn:   conn,
+		bucket: b,
+		path:   b.realPath(name),
+		done:   make(chan error, 1),
+	}
+
+	go func() {
+		err := conn.Stor(w.path, pr)
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+// stat finds the item without listing its parent directory: a directory is one the connection can
+// change to, a file is one the server tells the size of. The FTP client has no MLST support, so the
+// modification time of the files is only known from the listings.
+func (b *Bucket) stat(conn *ftp.ServerConn, name string) (bucketly.Item, error) {
+	p := b.realPath(name)
+	item := bucketly.NewItem(b, name)
+	if p == string(b.PathSeparator()) {
+		item.SetDir(true)
+		item.SetMode(os.ModeDir)
+
+		return item, nil
+	}
+
+	err := conn.ChangeDir(p)
+	if err == nil {
+		item.SetDir(true)
+		item.SetMode(os.ModeDir)
+
+		return item, nil
+	}
+
+	if !isProtocolError(err) {
+		return nil, err
+	}
+
+	size, err := conn.FileSize(p)
+	if err != nil {
+		if isProtocolError(err) {
+			return nil, os.ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	item.SetSize(size)
+
+	return item, nil
+}
+
+func (b *Bucket) readDir(conn *ftp.ServerConn, dir string) ([]bucketly.Item, error) {
+	entries, err := conn.List(b.realPath(dir))
+	if err != nil {
+		if isNotExists(err) {
+			return nil, os.ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	items := make([]bucketly.Item, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		name := strings.TrimLeft(bucketly.Join(b, dir, entry.Name), string(b.PathSeparator()))
+		items = append(items, b.entryToItem(name, entry))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name() < items[j].Name()
+	})
+
+	return items, nil
+}
+
+func (b *Bucket) mkdir(conn *ftp.ServerConn, name string) error {
+	item, err := b.stat(conn, name)
+	if err == nil {
+		if !item.IsDir() {
+			return fmt.Errorf("%s is not a directory", name)
+		}
+
+		return nil
+	}
+
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := conn.MakeDir(b.realPath(name)); err != nil {
+		// the directory might have been created in the meantime by a concurrent call
+		if item, err2 := b.stat(conn, name); err2 == nil && item.IsDir() {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) removeDir(conn *ftp.ServerConn, p string) error {
+	if err := b.removeDirContents(conn, p); err != nil {
+		return err
+	}
+
+	return conn.RemoveDir(p)
+}
+
+func (b *Bucket) removeDirContents(conn *ftp.ServerConn, p string) error {
+	entries, err := conn.List(p)
+	if err != nil {
+		if isNotExists(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		child := bucketly.Join(b, p, entry.Name)
+		if entry.Type == ftp.EntryTypeFolder {
+			err = b.removeDir(conn, child)
+		} else {
+			err = conn.Delete(child)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) realPath(name string) string {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return ""
+	}
+
+	return bucketly.Join(b, string(b.PathSeparator()), b.name, name)
+}
+
+func (b *Bucket) entryToItem(name string, entry *ftp.Entry) bucketly.Item {
+	item := bucketly.NewItem(b, name)
+	item.SetDir(entry.Type == ftp.EntryTypeFolder)
+	item.SetSize(int64(entry.Size))
+	item.SetModeTime(entry.Time)
+	item.SetSys(entry)
+	if entry.Type == ftp.EntryTypeFolder {
+		item.SetMode(os.ModeDir)
+	}
+
+	return item
+}
+
+func (r *reader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	err := r.Response.Close()
+	r.pool.put(r.conn, err)
+
+	return err
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	w.pw.Close()
+	err := <-w.done
+	w.bucket.pool.put(w.conn, err)
+
+	return err
+}
+
+// abort fails the upload with the error. The server can't tell an aborted upload from a complete one
+// once the data connection is closed, so the partially stored file is removed, whatever the state of
+// the context which might have caused the failure.
+func (w *writer) abort(err error) {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	w.pw.CloseWithError(err)
+	w.bucket.pool.put(w.conn, <-w.done)
+	w.bucket.withConn(context.Background(), func(conn *ftp.ServerConn) error {
+		return conn.Delete(w.path)
+	})
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		err = i.bucket.withConn(ctx, func(conn *ftp.ServerConn) (err error) {
+			i.queue, err = i.bucket.readDir(conn, i.name)
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package ftp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/ftp"
+	"github.com/vcraescu/bucketly/internal/ftptest"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newServer(t *testing.T) *ftptest.Server {
+	root, err := ioutil.TempDir("", "bucketly-ftp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := ftptest.NewServer(root)
+	t.Cleanup(func() {
+		server.Close()
+		os.RemoveAll(root)
+	})
+
+	return server
+}
+
+func newBucket(t *testing.T, server *ftptest.Server, opts ...ftp.Option) *ftp.Bucket {
+	opts = append([]ftp.Option{ftp.WithAddress(server.Addr)}, opts...)
+	bucket, err := ftp.NewBucket("/bucket", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		bucket.Close()
+	})
+
+	if err := ftp.NewBucketManager(bucket).Create(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func TestNewBucket_MissingAddress(t *testing.T) {
+	_, err := ftp.NewBucket("/bucket")
+	assert.Error(t, err)
+}
+
+func TestBucket_ReadWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ftp.Option
+	}{
+		{
+			name: "epsv",
+		},
+		{
+			name: "pasv",
+			opts: []ftp.Option{ftp.WithDisabledEPSV(true)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			server := newServer(t)
+			bucket := newBucket(t, server, test.opts...)
+
+			n, err := bucket.Write(ctx, "foo/bar.txt", []byte("12345"))
+			if a.NoError(err) {
+				a.Equal(5, n)
+			}
+
+			content, err := ioutil.ReadFile(filepath.Join(server.Root, "bucket", "foo", "bar.txt"))
+			if a.NoError(err) {
+				a.Equal([]byte("12345"), content)
+			}
+
+			w, err := bucket.NewWriter(ctx, "foo/baz.txt")
+			if a.NoError(err) {
+				_, err = w.Write([]byte("123"))
+				a.NoError(err)
+				a.NoError(w.Close())
+			}
+
+			r, err := bucket.NewReader(ctx, "foo/baz.txt")
+			if a.NoError(err) {
+				content, err := ioutil.ReadAll(r)
+				a.NoError(err)
+				a.NoError(r.Close())
+				a.Equal([]byte("123"), content)
+			}
+
+			item, err := bucket.Stat(ctx, "foo/bar.txt")
+			if a.NoError(err) {
+				a.False(item.IsDir())
+				a.Equal(int64(5), item.Size())
+			}
+
+			item, err = bucket.Stat(ctx, "foo")
+			if a.NoError(err) {
+				a.True(item.IsDir())
+			}
+
+			_, err = bucket.Read(ctx, "missing.txt")
+			a.True(os.IsNotExist(err))
+		})
+	}
+}
+
+func TestBucket_FailedCopy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	server := newServer(t)
+	bucket := newBucket(t, server)
+
+	err := bucket.Copy(ctx, &failingItem{Item: bucketly.NewItem(bucket, "src.txt")}, "foo.txt")
+	a.Equal(errFailed, err)
+
+	_, err = os.Stat(filepath.Join(server.Root, "bucket", "foo.txt"))
+	a.True(os.IsNotExist(err))
+}
+
+func TestBucket_Walk(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, newServer(t))
+
+	for _, name := range []string{"foo/a.txt", "foo/bar/b.txt", "c.txt"} {
+		if _, err := bucket.Write(ctx, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	err := bucket.Walk(ctx, "/", func(item bucketly.Item, err error) error {
+		names = append(names, item.Name())
+
+		return err
+	})
+	if a.NoError(err) {
+		a.Equal([]string{"c.txt", "foo", "foo/a.txt", "foo/bar", "foo/bar/b.txt"}, names)
+	}
+
+	a.NoError(bucket.Rename(ctx, "foo/bar", "baz"))
+	exists, err := bucket.Exists(ctx, "baz/b.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	a.NoError(bucket.RemoveAll(ctx, "foo"))
+	exists, err = bucket.Exists(ctx, "foo/a.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+}
+
+func TestBucket_ConnPool(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, newServer(t), ftp.WithMaxIdleConns(1))
+
+	// the connections are returned to the pool by the readers, so reading more files than idle
+	// connections must not exhaust it
+	for i := 0; i < 3; i++ {
+		_, err := bucket.Write(ctx, "foo.txt", []byte("foo"))
+		a.NoError(err)
+
+		r, err := bucket.NewReader(ctx, "foo.txt")
+		if a.NoError(err) {
+			content, err := ioutil.ReadAll(r)
+			a.NoError(err)
+			a.Equal([]byte("foo"), content)
+			a.NoError(r.Close())
+		}
+	}
+}
+
+var errFailed = errors.New("failed")
+
+type (
+	// failingItem is a file whose content fails after a few bytes.
+	failingItem struct {
+		bucketly.Item
+	}
+
+	failingReader struct{}
+)
+
+func (i *failingItem) Open(_ context.Context) (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.MultiReader(strings.NewReader("123"), failingReader{})), nil
+}
+
+func (failingReader) Read(_ []byte) (int, error) {
+	return 0, errFailed
+}
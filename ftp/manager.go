@@ -0,0 +1,64 @@
+package ftp
+
+import (
+	"context"
+	"github.com/jlaffaye/ftp"
+	"strings"
+)
+
+type (
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+func (m *BucketManager) Create(ctx context.Context) error {
+	b := m.bucket
+
+	return b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		current := ""
+		for _, token := range strings.Split(strings.Trim(b.name, string(b.PathSeparator())), string(b.PathSeparator())) {
+			if token == "" {
+				continue
+			}
+
+			current += string(b.PathSeparator()) + token
+			if err := conn.MakeDir(current); err != nil {
+				if _, err2 := conn.List(current); err2 != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *BucketManager) Remove(ctx context.Context) error {
+	b := m.bucket
+
+	return b.withConn(ctx, func(conn *ftp.ServerConn) error {
+		p := b.realPath(string(b.PathSeparator()))
+		if p == string(b.PathSeparator()) {
+			return b.removeDirContents(conn, p)
+		}
+
+		if _, err := conn.List(p); err != nil {
+			if isNotExists(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		return b.removeDir(conn, p)
+	})
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, string(m.bucket.PathSeparator()))
+}
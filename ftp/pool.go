@@ -0,0 +1,82 @@
+package ftp
+
+import (
+	"context"
+	"github.com/jlaffaye/ftp"
+)
+
+type connPool struct {
+	config Config
+	idle   chan *ftp.ServerConn
+}
+
+func newConnPool(cfg Config) *connPool {
+	return &connPool{
+		config: cfg,
+		idle:   make(chan *ftp.ServerConn, cfg.maxIdleConns),
+	}
+}
+
+func (p *connPool) get(ctx context.Context) (*ftp.ServerConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+		return p.dial(ctx)
+	}
+}
+
+// put hands the connection back to the pool. Connections which failed with anything else than
+// an FTP reply are in an unknown state and therefore they are dropped.
+func (p *connPool) put(conn *ftp.ServerConn, err error) {
+	if err != nil && !isProtocolError(err) {
+		conn.Quit()
+
+		return
+	}
+
+	select {
+	case p.idle <- conn:
+	default:
+		conn.Quit()
+	}
+}
+
+func (p *connPool) close() error {
+	for {
+		select {
+		case conn := <-p.idle:
+			conn.Quit()
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *connPool) dial(ctx context.Context) (*ftp.ServerConn, error) {
+	opts := []ftp.DialOption{
+		ftp.DialWithContext(ctx),
+		ftp.DialWithTimeout(p.config.timeout),
+		ftp.DialWithDisabledEPSV(p.config.disableEPSV),
+	}
+	if p.config.tlsConfig != nil {
+		opts = append(opts, ftp.DialWithTLS(p.config.tlsConfig))
+	}
+
+	conn, err := ftp.Dial(p.config.addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Login(p.config.user, p.config.password); err != nil {
+		conn.Quit()
+
+		return nil, err
+	}
+
+	return conn, nil
+}
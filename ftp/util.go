@@ -0,0 +1,23 @@
+package ftp
+
+import (
+	"github.com/jlaffaye/ftp"
+	"net/textproto"
+	"strings"
+)
+
+func isNotExists(err error) bool {
+	err1, ok := err.(*textproto.Error)
+
+	return ok && err1.Code == ftp.StatusFileUnavailable
+}
+
+func isProtocolError(err error) bool {
+	_, ok := err.(*textproto.Error)
+
+	return ok
+}
+
+func isDirPath(name string) bool {
+	return strings.HasSuffix(strings.TrimSpace(name), string(pathSeparator))
+}
@@ -0,0 +1,744 @@
+package gcs
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const pathSeparator rune = '/'
+
+type (
+	Bucket struct {
+		name   string
+		config Config
+		client *storage.Client
+		bucket *storage.BucketHandle
+	}
+
+	Config struct {
+		projectID       string
+		endpoint        string
+		credentialsFile string
+		credentialsJSON []byte
+		httpClient      *http.Client
+		noAuth          bool
+		client          *storage.Client
+		clientOptions   []option.ClientOption
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+		loaded bool
+	}
+)
+
+// WithProjectID sets the project the bucket is created in by the BucketManager.
+func WithProjectID(projectID string) Option {
+	return func(cfg *Config) {
+		cfg.projectID = projectID
+	}
+}
+
+func WithEndpoint(endpoint string) Option {
+	return func(cfg *Config) {
+		cfg.endpoint = endpoint
+	}
+}
+
+func WithCredentialsFile(filename string) Option {
+	return func(cfg *Config) {
+		cfg.credentialsFile = filename
+	}
+}
+
+func WithCredentialsJSON(json []byte) Option {
+	return func(cfg *Config) {
+		cfg.credentialsJSON = json
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *Config) {
+		cfg.httpClient = client
+	}
+}
+
+func WithoutAuthentication() Option {
+	return func(cfg *Config) {
+		cfg.noAuth = true
+	}
+}
+
+func WithClient(client *storage.Client) Option {
+	return func(cfg *Config) {
+		cfg.client = client
+	}
+}
+
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(cfg *Config) {
+		cfg.clientOptions = append(cfg.clientOptions, opts...)
+	}
+}
+
+func NewBucket(name string, opts ...Option) (*Bucket, error) {
+	cfg := Config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	client := cfg.client
+	if client == nil {
+		var err error
+		client, err = storage.NewClient(context.Background(), cfg.options()...)
+		if err != nil {
+			return nil, fmt.Errorf(`error creating client for bucket "%s": %w`, name, err)
+		}
+	}
+
+	return &Bucket{
+		name:   name,
+		config: cfg,
+		client: client,
+		bucket: client.Bucket(name),
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+func (b *Bucket) Close() error {
+	return b.client.Close()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	r, err := b.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return r, nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.Close()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return b.newWriter(ctx, key, wo), nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		item := bucketly.NewItem(b, string(pathSeparator))
+		item.SetDir(true)
+		item.SetMetadata(bucketly.Metadata{})
+
+		return item, nil
+	}
+
+	if !dir {
+		attrs, err := b.bucket.Object(key).Attrs(ctx)
+		if err == nil {
+			return b.attrsToItem(attrs), nil
+		}
+
+		if err != storage.ErrObjectNotExist {
+			return nil, err
+		}
+	}
+
+	attrs, err := b.bucket.Object(dirKey(key)).Attrs(ctx)
+	if err == nil {
+		return b.attrsToItem(attrs), nil
+	}
+
+	if err != storage.ErrObjectNotExist {
+		return nil, err
+	}
+
+	// there is no marker, the directory still exists if there are objects under its prefix
+	attrs, err = b.bucket.Objects(ctx, &storage.Query{Prefix: dirKey(key)}).Next()
+	if err == iterator.Done {
+		return nil, os.ErrNotExist
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	item := bucketly.NewItem(b, dirKey(key))
+	item.SetDir(true)
+	item.SetModeTime(attrs.Updated)
+	item.SetMetadata(bucketly.Metadata{})
+
+	return item, nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, _, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	w := b.newWriter(ctx, dirKey(key), wo)
+	w.ContentType = "application/x-directory"
+
+	return w.Close()
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	key, _, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	var current []string
+	for _, token := range strings.Split(key, string(pathSeparator)) {
+		current = append(current, token)
+		if err := b.Mkdir(ctx, strings.Join(current, string(pathSeparator)), opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	if !dir {
+		err := b.bucket.Object(key).Delete(ctx)
+		if err != storage.ErrObjectNotExist {
+			return err
+		}
+	}
+
+	return convertError(b.bucket.Object(dirKey(key)).Delete(ctx))
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	key, dir, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if !dir {
+		if err := b.bucket.Object(key).Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+			return err
+		}
+	}
+
+	prefix := ""
+	if key != "" {
+		prefix = dirKey(key)
+	}
+
+	return b.listAll(ctx, prefix, func(attrs *storage.ObjectAttrs) error {
+		if err := b.bucket.Object(attrs.Name).Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	item, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	fromKey, _, err := b.key(item.Name())
+	if err != nil {
+		return err
+	}
+
+	toKey, _, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if fromKey == "" || toKey == "" {
+		return fmt.Errorf("cannot rename %s to %s", from, to)
+	}
+
+	if !item.IsDir() {
+		if err := b.rewrite(ctx, b.bucket.Object(fromKey), toKey, co.Metadata); err != nil {
+			return err
+		}
+
+		return b.bucket.Object(fromKey).Delete(ctx)
+	}
+
+	if strings.HasPrefix(dirKey(toKey), dirKey(fromKey)) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	err = b.listAll(ctx, dirKey(fromKey), func(attrs *storage.ObjectAttrs) error {
+		dest := dirKey(toKey) + strings.TrimPrefix(attrs.Name, dirKey(fromKey))
+
+		// markers are empty, writing a new one is cheaper than a rewrite
+		if isDirPath(attrs.Name) {
+			metadata := co.Metadata
+			if metadata == nil {
+				metadata = attrs.Metadata
+			}
+
+			return b.Mkdir(ctx, dest, bucketly.WithWriteMetadata(metadata))
+		}
+
+		return b.rewrite(ctx, b.bucket.Object(attrs.Name), dest, co.Metadata)
+	})
+	if err != nil {
+		return err
+	}
+
+	// implicit directories have no marker, the destination still needs to show up as a directory
+	if err := b.MkdirAll(ctx, toKey); err != nil {
+		return err
+	}
+
+	return b.RemoveAll(ctx, dirKey(fromKey))
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.MkdirAll(ctx, to, bucketly.WithWriteMetadata(co.Metadata))
+	}
+
+	toKey, dir, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if dir {
+		return fmt.Errorf("%s is a directory", to)
+	}
+
+	// objects reachable by the same client are rewritten server side
+	if src, ok := from.Bucket().(*Bucket); ok && src.client == b.client {
+		fromKey, _, err := src.key(from.Name())
+		if err != nil {
+			return err
+		}
+
+		return b.rewrite(ctx, src.bucket.Object(fromKey), toKey, co.Metadata)
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	r, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// cancelling the context is the only way to abort an upload without committing the object
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := b.newWriter(ctx, toKey, &bucketly.WriteOptions{Metadata: co.Metadata})
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		w.Close()
+
+		return err
+	}
+
+	return w.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, name string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	if _, _, err := b.key(name); err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	key, _, err := b.key(dir)
+	if err != nil {
+		return err
+	}
+
+	items, err := b.readDir(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDir returns the children of the key directory sorted by name. GCS lists the objects and the
+// prefixes separately, so the whole directory has to be read before it can be sorted.
+func (b *Bucket) readDir(ctx context.Context, key string) ([]bucketly.Item, error) {
+	prefix := ""
+	if key != "" {
+		prefix = dirKey(key)
+	}
+
+	iter := b.bucket.Objects(ctx, &storage.Query{
+		Prefix:    prefix,
+		Delimiter: string(pathSeparator),
+	})
+
+	var items []bucketly.Item
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if attrs.Prefix != "" {
+			item := bucketly.NewItem(b, attrs.Prefix)
+			item.SetDir(true)
+			items = append(items, item)
+
+			continue
+		}
+
+		// the marker of the directory itself
+		if attrs.Name == prefix {
+			continue
+		}
+
+		items = append(items, b.attrsToItem(attrs))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name() < items[j].Name()
+	})
+
+	return items, nil
+}
+
+func (b *Bucket) listAll(ctx context.Context, prefix string, fn func(attrs *storage.ObjectAttrs) error) error {
+	iter := b.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(attrs); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *Bucket) attrsToItem(attrs *storage.ObjectAttrs) bucketly.Item {
+	item := bucketly.NewItem(b, attrs.Name)
+	item.SetDir(isDirPath(attrs.Name))
+	item.SetSize(attrs.Size)
+	item.SetModeTime(attrs.Updated)
+	item.SetETag(strconv.FormatInt(attrs.Generation, 10))
+	item.SetSys(attrs)
+
+	metadata := make(bucketly.Metadata, len(attrs.Metadata))
+	for k, v := range attrs.Metadata {
+		metadata[k] = v
+	}
+	item.SetMetadata(metadata)
+
+	return item
+}
+
+func (b *Bucket) newWriter(ctx context.Context, key string, wo *bucketly.WriteOptions) *storage.Writer {
+	w := b.bucket.Object(key).NewWriter(ctx)
+	w.Metadata = wo.Metadata
+	if wo.BufferSize > 0 {
+		w.ChunkSize = wo.BufferSize
+	}
+
+	return w
+}
+
+// rewrite copies the source object server side. The metadata of the source is kept unless a new
+// one is given.
+func (b *Bucket) rewrite(ctx context.Context, src *storage.ObjectHandle, toKey string, metadata bucketly.Metadata) error {
+	copier := b.bucket.Object(toKey).CopierFrom(src)
+	copier.Metadata = metadata
+
+	_, err := copier.Run(ctx)
+
+	return convertError(err)
+}
+
+// key turns a bucket path into an object name. The root directory has the empty key and dir reports
+// whether the path explicitly refers to a directory.
+func (b *Bucket) key(name string) (key string, dir bool, err error) {
+	dir = isDirPath(name)
+	name, err = bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", false, err
+	}
+
+	key = strings.Trim(name, string(pathSeparator))
+
+	return key, dir || key == "", nil
+}
+
+func (cfg Config) options() []option.ClientOption {
+	var opts []option.ClientOption
+	if cfg.endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.endpoint))
+	}
+
+	if cfg.credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.credentialsFile))
+	}
+
+	if len(cfg.credentialsJSON) > 0 {
+		opts = append(opts, option.WithCredentialsJSON(cfg.credentialsJSON))
+	}
+
+	if cfg.httpClient != nil {
+		opts = append(opts, option.WithHTTPClient(cfg.httpClient))
+	}
+
+	if cfg.noAuth {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+
+	return append(opts, cfg.clientOptions...)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if !i.loaded {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		i.loaded = true
+		if !item.IsDir() {
+			return item, nil
+		}
+
+		key, _, err := i.bucket.key(item.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		i.queue, err = i.bucket.readDir(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+	i.loaded = true
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package gcs_test
+
+import (
+	"context"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/gcs"
+	"strconv"
+	"testing"
+)
+
+func TestBucket_MetadataAndETag(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	server := fakestorage.NewServer(nil)
+	defer server.Stop()
+	server.CreateBucket("test")
+
+	bucket, err := gcs.NewBucket("test", gcs.WithClient(server.Client()))
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = bucket.Write(ctx, "foo/bar.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"foo": "bar"}))
+	if !a.NoError(err) {
+		return
+	}
+
+	object, err := server.GetObject("test", "foo/bar.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err := bucket.Stat(ctx, "foo/bar.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	etag, err := item.ETag()
+	if a.NoError(err) {
+		a.Equal(strconv.FormatInt(object.Generation, 10), etag)
+	}
+
+	a.NoError(bucket.Copy2(ctx, "foo/bar.txt", "baz.txt"))
+	item, err = bucket.Stat(ctx, "baz.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err := item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+	}
+
+	a.NoError(bucket.Copy2(ctx, "foo/bar.txt", "qux.txt", bucketly.WithCopyMetadata(bucketly.Metadata{"foo": "baz"})))
+	item, err = bucket.Stat(ctx, "qux.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err = item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "baz"}, metadata)
+	}
+}
+
+func TestBucketManager_CreateWithoutProjectID(t *testing.T) {
+	a := assert.New(t)
+
+	server := fakestorage.NewServer(nil)
+	defer server.Stop()
+
+	bucket, err := gcs.NewBucket("test", gcs.WithClient(server.Client()))
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Error(gcs.NewBucketManager(bucket).Create(context.Background()))
+}
@@ -0,0 +1,37 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+)
+
+type (
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+func (m *BucketManager) Create(ctx context.Context) error {
+	if m.bucket.config.projectID == "" {
+		return errors.New("bucket cannot be created because project id is missing")
+	}
+
+	err := m.bucket.bucket.Create(ctx, m.bucket.config.projectID, nil)
+	if err != nil && !isConflict(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (m *BucketManager) Remove(ctx context.Context) error {
+	return m.bucket.bucket.Delete(ctx)
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, "/")
+}
@@ -0,0 +1,46 @@
+package gcs
+
+import (
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func isNotExists(err error) bool {
+	if err == storage.ErrObjectNotExist || err == storage.ErrBucketNotExist {
+		return true
+	}
+
+	gerr, ok := err.(*googleapi.Error)
+
+	return ok && gerr.Code == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+
+	return ok && gerr.Code == http.StatusConflict
+}
+
+func convertError(err error) error {
+	if isNotExists(err) {
+		return os.ErrNotExist
+	}
+
+	return err
+}
+
+func isDirPath(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return true
+	}
+
+	return strings.HasSuffix(name, string(pathSeparator))
+}
+
+func dirKey(key string) string {
+	return key + string(pathSeparator)
+}
@@ -3,11 +3,20 @@ module github.com/vcraescu/bucketly
 go 1.14
 
 require (
+	cloud.google.com/go/storage v1.9.0
+	github.com/Azure/azure-pipeline-go v0.2.1
+	github.com/Azure/azure-storage-blob-go v0.8.0
 	github.com/aws/aws-sdk-go v1.30.9
 	github.com/davecgh/go-spew v1.1.1
+	github.com/fsouza/fake-gcs-server v1.19.4
 	github.com/google/uuid v1.1.1
 	github.com/jlaffaye/ftp v0.0.0-20200331144919-d4caf6ffcab8
+	github.com/klauspost/compress v1.10.10
+	github.com/pkg/sftp v1.11.0
 	github.com/stretchr/testify v1.6.1
+	go.etcd.io/bbolt v1.3.5
 	gocloud.dev v0.19.0
-	golang.org/x/sys v0.0.0-20200413165638-669c56c373c4 // indirect
+	golang.org/x/crypto v0.0.0-20200414173820-0848c9571904
+	golang.org/x/net v0.0.0-20200520182314-0ba52f642ac2
+	google.golang.org/api v0.26.0
 )
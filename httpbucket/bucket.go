@@ -0,0 +1,446 @@
+package httpbucket
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	pathSeparator rune = '/'
+	acceptHeader       = "application/json, text/html;q=0.9, */*;q=0.8"
+)
+
+type (
+	// Bucket is a read-only bucket over a plain HTTP server. Directories are listed by parsing the
+	// index the server returns for them, either an autoindex HTML page or a JSON listing.
+	Bucket struct {
+		name   string
+		config Config
+		base   *url.URL
+		client *http.Client
+	}
+
+	Config struct {
+		user       string
+		password   string
+		header     http.Header
+		httpClient *http.Client
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+)
+
+func WithUser(user string) Option {
+	return func(cfg *Config) {
+		cfg.user = user
+	}
+}
+
+func WithPassword(password string) Option {
+	return func(cfg *Config) {
+		cfg.password = password
+	}
+}
+
+// WithHeader adds a header sent with every request, e.g. an Authorization token.
+func WithHeader(key, value string) Option {
+	return func(cfg *Config) {
+		cfg.header.Add(key, value)
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *Config) {
+		cfg.httpClient = client
+	}
+}
+
+// NewBucket returns a bucket rooted at the given base URL.
+func NewBucket(name string, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		header: http.Header{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	base, err := url.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf(`error parsing url "%s": %w`, name, err)
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf(`unsupported url scheme "%s"`, base.Scheme)
+	}
+
+	client := cfg.httpClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Bucket{
+		name:   name,
+		config: cfg,
+		base:   base,
+		client: client,
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+// StoresMetadata reports false, the metadata of the items is not kept.
+func (b *Bucket) StoresMetadata() bool {
+	return false
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if isDirPath(name) {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == string(pathSeparator) {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	resp, err := b.do(ctx, http.MethodGet, b.url(name, false), "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		drain(resp)
+
+		return nil, responseError(resp)
+	}
+
+	if isDirURL(resp.Request.URL) {
+		drain(resp)
+
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return resp.Body, nil
+}
+
+func (b *Bucket) Write(_ context.Context, _ string, _ []byte, _ ...bucketly.WriteOption) (int, error) {
+	return 0, bucketly.ErrNotSupported
+}
+
+func (b *Bucket) NewWriter(_ context.Context, _ string, _ ...bucketly.WriteOption) (io.WriteCloser, error) {
+	return nil, bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(_ context.Context, _ string) error {
+	return bucketly.ErrNotSupported
+}
+
+// Stat issues a HEAD request for the name. Names whose request ends up on a URL with a trailing
+// slash, usually after the server redirected to it, are reported as directories.
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	dir := isDirPath(name)
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == string(pathSeparator) {
+		dir = true
+	}
+
+	u := b.url(name, dir)
+	resp, err := b.do(ctx, http.MethodHead, u, "")
+	if err != nil {
+		return nil, err
+	}
+	drain(resp)
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		// the server does not support HEAD requests, fetch only the headers of a GET instead, the
+		// body is closed unread so it isn't downloaded
+		resp, err = b.do(ctx, http.MethodGet, u, "")
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	item := bucketly.NewItem(b, name)
+	item.SetDir(isDirURL(resp.Request.URL))
+	item.SetETag(resp.Header.Get("ETag"))
+	item.SetMetadata(bucketly.Metadata{})
+	if !item.IsDir() && resp.ContentLength >= 0 {
+		item.SetSize(resp.ContentLength)
+	}
+
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			item.SetModeTime(t)
+		}
+	}
+
+	return item, nil
+}
+
+func (b *Bucket) Mkdir(_ context.Context, _ string, _ ...bucketly.WriteOption) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) MkdirAll(_ context.Context, _ string, _ ...bucketly.WriteOption) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) RemoveAll(_ context.Context, _ string) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Rename(_ context.Context, _ string, _ string, _ ...bucketly.CopyOption) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Copy(_ context.Context, _ bucketly.Item, _ string, _ ...bucketly.CopyOption) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) CopyAll(_ context.Context, _ bucketly.Item, _ string, _ ...bucketly.CopyOption) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Copy2(_ context.Context, _ string, _ string, _ ...bucketly.CopyOption) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) CopyAll2(_ context.Context, _ string, _ string, _ ...bucketly.CopyOption) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	items, err := b.readDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) readDir(ctx context.Context, dir string) ([]bucketly.Item, error) {
+	dir, err := bucketly.Sanitize(b, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.do(ctx, http.MethodGet, b.url(dir, true), acceptHeader)
+	if err != nil {
+		return nil, err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	var entries []indexEntry
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		entries, err = parseJSONIndex(resp.Body)
+	case "text/html":
+		entries, err = parseHTMLIndex(resp.Body, resp.Request.URL)
+	default:
+		return nil, fmt.Errorf(`unsupported directory index content type "%s"`, mediaType)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	items := make([]bucketly.Item, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimLeft(bucketly.Join(b, dir, entry.name), string(b.PathSeparator()))
+		item := bucketly.NewItem(b, name)
+		item.SetDir(entry.dir)
+		item.SetSize(entry.size)
+		item.SetModeTime(entry.modTime)
+		item.SetMetadata(bucketly.Metadata{})
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (b *Bucket) do(ctx context.Context, method string, u string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	for k, v := range b.config.header {
+		req.Header[k] = v
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	if b.config.user != "" || b.config.password != "" {
+		req.SetBasicAuth(b.config.user, b.config.password)
+	}
+
+	return b.client.Do(req)
+}
+
+func (b *Bucket) url(name string, dir bool) string {
+	u := *b.base
+	u.Path = path.Join("/", b.base.Path, name)
+	u.RawPath = ""
+	if dir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	return u.String()
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		i.queue, err = i.bucket.readDir(ctx, item.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package httpbucket_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/httpbucket"
+	"github.com/vcraescu/bucketly/memory"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func walk(ctx context.Context, bucket bucketly.Walkable, name string) ([]string, error) {
+	var names []string
+	err := bucket.Walk(ctx, name, func(item bucketly.Item, err error) error {
+		names = append(names, item.Name())
+
+		return nil
+	})
+
+	return names, err
+}
+
+func TestBucket_HTMLIndex(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "bucketly-http-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.txt":             "12345",
+		"sub/b.txt":         "123",
+		"sub/deeper/c.html": "<html></html>",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := httptest.NewServer(http.StripPrefix("/pub", http.FileServer(http.Dir(dir))))
+	defer server.Close()
+
+	ctx := context.Background()
+	bucket, err := httpbucket.NewBucket(server.URL + "/pub")
+	if !a.NoError(err) {
+		return
+	}
+
+	names, err := walk(ctx, bucket, "/")
+	if a.NoError(err) {
+		a.Equal([]string{"a.txt", "sub", "sub/b.txt", "sub/deeper", "sub/deeper/c.html"}, names)
+	}
+
+	item, err := bucket.Stat(ctx, "a.txt")
+	if a.NoError(err) {
+		a.False(item.IsDir())
+		a.Equal(int64(5), item.Size())
+		a.False(item.ModTime().IsZero())
+	}
+
+	item, err = bucket.Stat(ctx, "sub")
+	if a.NoError(err) {
+		a.True(item.IsDir())
+	}
+
+	_, err = bucket.Stat(ctx, "missing.txt")
+	a.True(os.IsNotExist(err))
+
+	content, err := bucket.Read(ctx, "sub/deeper/c.html")
+	if a.NoError(err) {
+		a.Equal([]byte("<html></html>"), content)
+	}
+
+	_, err = bucket.Read(ctx, "sub/")
+	a.Error(err)
+
+	dest := memory.NewBucket("dest")
+	if !a.NoError(dest.CopyAll(ctx, bucketly.NewItem(bucket, "sub/"), "copy/")) {
+		return
+	}
+
+	content, err = dest.Read(ctx, "copy/deeper/c.html")
+	if a.NoError(err) {
+		a.Equal([]byte("<html></html>"), content)
+	}
+}
+
+func TestBucket_JSONIndex(t *testing.T) {
+	a := assert.New(t)
+	modTime := time.Date(2020, 4, 1, 10, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `[
+				{"name": "docs", "type": "directory", "mtime": "%[1]s"},
+				{"name": "readme.md", "type": "file", "mtime": "%[1]s", "size": 5}
+			]`, modTime.Format(http.TimeFormat))
+		case "/docs/":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `[{"name": "guide.txt", "is_dir": false, "size": 3, "mod_time": "2020-04-01T10:00:00Z"}]`)
+		case "/readme.md":
+			w.Header().Set("ETag", `"abc"`)
+			http.ServeContent(w, r, "readme.md", modTime, strings.NewReader("12345"))
+		case "/docs/guide.txt":
+			http.ServeContent(w, r, "guide.txt", modTime, strings.NewReader("123"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	bucket, err := httpbucket.NewBucket(server.URL)
+	if !a.NoError(err) {
+		return
+	}
+
+	it, err := bucket.Items("")
+	if !a.NoError(err) {
+		return
+	}
+
+	first, err := it.Next(ctx)
+	if a.NoError(err) {
+		a.Equal("docs", first.Name())
+		a.True(first.IsDir())
+		a.Equal(modTime, first.ModTime())
+	}
+
+	second, err := it.Next(ctx)
+	if a.NoError(err) {
+		a.Equal("readme.md", second.Name())
+		a.Equal(int64(5), second.Size())
+
+		etag, err := second.ETag()
+		if a.NoError(err) {
+			a.Equal(`"abc"`, etag)
+		}
+	}
+
+	names, err := walk(ctx, bucket, "docs/")
+	if a.NoError(err) {
+		a.Equal([]string{"docs/guide.txt"}, names)
+	}
+}
+
+func TestBucket_StatWithoutHead(t *testing.T) {
+	a := assert.New(t)
+	const size = 64 << 20
+
+	written := make(chan int64, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprint(size))
+		w.Header().Set("ETag", `"big"`)
+		chunk := make([]byte, 1<<20)
+		var n int64
+		for n < size {
+			m, err := w.Write(chunk)
+			n += int64(m)
+			if err != nil {
+				break
+			}
+		}
+		written <- n
+	}))
+	defer server.Close()
+
+	bucket, err := httpbucket.NewBucket(server.URL)
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err := bucket.Stat(context.Background(), "big.bin")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(int64(size), item.Size())
+	etag, err := item.ETag()
+	if a.NoError(err) {
+		a.Equal(`"big"`, etag)
+	}
+
+	// the body is not downloaded
+	select {
+	case n := <-written:
+		a.True(n < size)
+	case <-time.After(5 * time.Second):
+		a.Fail("the server is still writing the body")
+	}
+}
+
+func TestBucket_ReadOnly(t *testing.T) {
+	a := assert.New(t)
+	bucket, err := httpbucket.NewBucket("http://127.0.0.1")
+	if !a.NoError(err) {
+		return
+	}
+
+	ctx := context.Background()
+	_, err = bucket.Write(ctx, "foo.txt", []byte("12345"))
+	a.Equal(bucketly.ErrNotSupported, err)
+	a.Equal(bucketly.ErrNotSupported, bucket.MkdirAll(ctx, "foo/"))
+	a.Equal(bucketly.ErrNotSupported, bucket.RemoveAll(ctx, "foo/"))
+	a.Equal(bucketly.ErrNotSupported, bucket.Rename(ctx, "foo.txt", "bar.txt"))
+}
+
+func TestNewBucket_InvalidScheme(t *testing.T) {
+	_, err := httpbucket.NewBucket("ftp://127.0.0.1/pub")
+	assert.Error(t, err)
+}
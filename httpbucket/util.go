@@ -0,0 +1,165 @@
+package httpbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type (
+	indexEntry struct {
+		name    string
+		dir     bool
+		size    int64
+		modTime time.Time
+	}
+
+	// jsonIndexEntry covers both the nginx autoindex_format json and the caddy browse listings.
+	jsonIndexEntry struct {
+		Name    string    `json:"name"`
+		Type    string    `json:"type"`
+		Size    int64     `json:"size"`
+		MTime   string    `json:"mtime"`
+		IsDir   bool      `json:"is_dir"`
+		ModTime time.Time `json:"mod_time"`
+	}
+)
+
+func parseJSONIndex(r io.Reader) ([]indexEntry, error) {
+	var list []jsonIndexEntry
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, fmt.Errorf("error parsing json directory index: %w", err)
+	}
+
+	entries := make([]indexEntry, 0, len(list))
+	for _, e := range list {
+		name := strings.Trim(e.Name, string(pathSeparator))
+		if name == "" || name == "." || name == ".." || strings.ContainsRune(name, pathSeparator) {
+			continue
+		}
+
+		entry := indexEntry{
+			name:    name,
+			dir:     e.IsDir || e.Type == "directory" || strings.HasSuffix(e.Name, string(pathSeparator)),
+			modTime: e.ModTime,
+		}
+
+		if !entry.dir {
+			entry.size = e.Size
+		}
+
+		if e.MTime != "" {
+			if t, err := http.ParseTime(e.MTime); err == nil {
+				entry.modTime = t
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// parseHTMLIndex collects the links of the page pointing to direct children of the directory at
+// dirURL. Links to parents, other hosts, deeper paths or sorting queries are skipped.
+func parseHTMLIndex(r io.Reader, dirURL *url.URL) ([]indexEntry, error) {
+	base := *dirURL
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	seen := make(map[string]bool)
+	var entries []indexEntry
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return entries, nil
+			}
+
+			return nil, fmt.Errorf("error parsing html directory index: %w", z.Err())
+		}
+
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		tn, hasAttr := z.TagName()
+		if string(tn) != "a" || !hasAttr {
+			continue
+		}
+
+		for {
+			key, val, more := z.TagAttr()
+			if string(key) == "href" {
+				if entry, ok := childEntry(&base, string(val)); ok && !seen[entry.name] {
+					seen[entry.name] = true
+					entries = append(entries, entry)
+				}
+
+				break
+			}
+
+			if !more {
+				break
+			}
+		}
+	}
+}
+
+func childEntry(base *url.URL, href string) (indexEntry, bool) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || ref.RawQuery != "" {
+		return indexEntry{}, false
+	}
+
+	u := base.ResolveReference(ref)
+	if u.Scheme != base.Scheme || u.Host != base.Host || !strings.HasPrefix(u.Path, base.Path) {
+		return indexEntry{}, false
+	}
+
+	rel := strings.TrimPrefix(u.Path, base.Path)
+	dir := strings.HasSuffix(rel, string(pathSeparator))
+	rel = strings.TrimSuffix(rel, string(pathSeparator))
+	if rel == "" || strings.ContainsRune(rel, pathSeparator) {
+		return indexEntry{}, false
+	}
+
+	return indexEntry{name: rel, dir: dir}, true
+}
+
+func isDirPath(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return true
+	}
+
+	return strings.HasSuffix(name, string(pathSeparator))
+}
+
+func isDirURL(u *url.URL) bool {
+	return strings.HasSuffix(u.Path, "/")
+}
+
+func responseError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return os.ErrNotExist
+	}
+
+	return fmt.Errorf(`%s "%s" failed: %s`, resp.Request.Method, resp.Request.URL, resp.Status)
+}
+
+// drain discards the rest of the body so the connection can be reused.
+func drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,441 @@
+package ftptest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mlsdTimeFormat = "20060102150405"
+
+type (
+	Server struct {
+		Addr string
+		Root string
+
+		listener net.Listener
+		mu       sync.Mutex
+		conns    map[net.Conn]struct{}
+		wg       sync.WaitGroup
+	}
+
+	session struct {
+		server     *Server
+		conn       *textproto.Conn
+		dir        string
+		pasv       net.Listener
+		renameFrom string
+	}
+)
+
+func NewServer(root string) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("ftptest: failed to listen on a port: %v", err))
+	}
+
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Root:     root,
+		listener: l,
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+			}()
+
+			sess := &session{
+				server: s,
+				conn:   textproto.NewConn(conn),
+				dir:    "/",
+			}
+			sess.serve()
+		}()
+	}
+}
+
+func (s *session) serve() {
+	defer s.conn.Close()
+	defer s.closePasv()
+
+	s.reply(220, "ftptest ready")
+
+	for {
+		line, err := s.conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+
+		if !s.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (s *session) handle(cmd, arg string) bool {
+	switch cmd {
+	case "USER":
+		s.reply(331, "password required")
+	case "PASS":
+		s.reply(230, "logged in")
+	case "FEAT":
+		s.conn.PrintfLine("211-Features:\r\n MLST type*;size*;modify*;unix.mode*;\r\n UTF8\r\n EPSV\r\n PASV\r\n211 End")
+	case "OPTS", "TYPE", "NOOP", "MODE", "STRU":
+		s.reply(200, "ok")
+	case "SYST":
+		s.reply(215, "UNIX Type: L8")
+	case "PWD":
+		s.reply(257, fmt.Sprintf("%q is the current directory", s.dir))
+	case "CWD":
+		s.cwd(arg)
+	case "CDUP":
+		s.cwd("..")
+	case "EPSV":
+		s.epsv()
+	case "PASV":
+		s.pasvCmd()
+	case "MLSD":
+		s.mlsd(arg)
+	case "RETR":
+		s.retr(arg)
+	case "STOR":
+		s.stor(arg)
+	case "SIZE":
+		s.size(arg)
+	case "DELE":
+		s.fsOp(os.Remove(s.realPath(arg)), 250, "file removed")
+	case "MKD":
+		if err := os.Mkdir(s.realPath(arg), 0755); err != nil {
+			s.fail(err)
+		} else {
+			s.reply(257, fmt.Sprintf("%q created", s.abs(arg)))
+		}
+	case "RMD":
+		s.rmd(arg)
+	case "RNFR":
+		if _, err := os.Stat(s.realPath(arg)); err != nil {
+			s.fail(err)
+		} else {
+			s.renameFrom = arg
+			s.reply(350, "ready for RNTO")
+		}
+	case "RNTO":
+		if s.renameFrom == "" {
+			s.reply(503, "bad sequence of commands")
+			break
+		}
+		err := os.Rename(s.realPath(s.renameFrom), s.realPath(arg))
+		s.renameFrom = ""
+		s.fsOp(err, 250, "file renamed")
+	case "QUIT":
+		s.reply(221, "goodbye")
+		return false
+	default:
+		s.reply(502, "command not implemented")
+	}
+
+	return true
+}
+
+func (s *session) reply(code int, msg string) {
+	s.conn.PrintfLine("%d %s", code, msg)
+}
+
+func (s *session) fail(err error) {
+	s.reply(550, err.Error())
+}
+
+func (s *session) fsOp(err error, code int, msg string) {
+	if err != nil {
+		s.fail(err)
+
+		return
+	}
+
+	s.reply(code, msg)
+}
+
+func (s *session) abs(name string) string {
+	if !path.IsAbs(name) {
+		name = path.Join(s.dir, name)
+	}
+
+	return path.Clean("/" + name)
+}
+
+func (s *session) realPath(name string) string {
+	return filepath.Join(s.server.Root, filepath.FromSlash(s.abs(name)))
+}
+
+func (s *session) cwd(arg string) {
+	fi, err := os.Stat(s.realPath(arg))
+	if err != nil {
+		s.fail(err)
+
+		return
+	}
+
+	if !fi.IsDir() {
+		s.reply(550, "not a directory")
+
+		return
+	}
+
+	s.dir = s.abs(arg)
+	s.reply(250, "directory changed")
+}
+
+func (s *session) rmd(arg string) {
+	fi, err := os.Stat(s.realPath(arg))
+	if err != nil {
+		s.fail(err)
+
+		return
+	}
+
+	if !fi.IsDir() {
+		s.reply(550, "not a directory")
+
+		return
+	}
+
+	s.fsOp(os.Remove(s.realPath(arg)), 250, "directory removed")
+}
+
+func (s *session) size(arg string) {
+	fi, err := os.Stat(s.realPath(arg))
+	if err != nil {
+		s.fail(err)
+
+		return
+	}
+
+	if fi.IsDir() {
+		s.reply(550, "not a plain file")
+
+		return
+	}
+
+	s.reply(213, strconv.FormatInt(fi.Size(), 10))
+}
+
+func (s *session) listenPasv() (int, error) {
+	s.closePasv()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	s.pasv = l
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (s *session) closePasv() {
+	if s.pasv != nil {
+		s.pasv.Close()
+		s.pasv = nil
+	}
+}
+
+func (s *session) epsv() {
+	port, err := s.listenPasv()
+	if err != nil {
+		s.reply(425, err.Error())
+
+		return
+	}
+
+	s.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+}
+
+func (s *session) pasvCmd() {
+	port, err := s.listenPasv()
+	if err != nil {
+		s.reply(425, err.Error())
+
+		return
+	}
+
+	s.reply(227, fmt.Sprintf("Entering Passive Mode (127,0,0,1,%d,%d)", port/256, port%256))
+}
+
+func (s *session) transfer(fn func(conn net.Conn) error) {
+	if s.pasv == nil {
+		s.reply(425, "use PASV or EPSV first")
+
+		return
+	}
+	defer s.closePasv()
+
+	if l, ok := s.pasv.(*net.TCPListener); ok {
+		l.SetDeadline(time.Now().Add(10 * time.Second))
+	}
+
+	conn, err := s.pasv.Accept()
+	if err != nil {
+		s.reply(425, err.Error())
+
+		return
+	}
+
+	s.reply(150, "opening data connection")
+	err = fn(conn)
+	conn.Close()
+	if err != nil {
+		s.reply(451, err.Error())
+
+		return
+	}
+
+	s.reply(226, "transfer complete")
+}
+
+func (s *session) mlsd(arg string) {
+	fi, err := os.Stat(s.realPath(arg))
+	if err != nil {
+		s.closePasv()
+		s.fail(err)
+
+		return
+	}
+
+	if !fi.IsDir() {
+		s.closePasv()
+		s.reply(501, "not a directory")
+
+		return
+	}
+
+	infos, err := ioutil.ReadDir(s.realPath(arg))
+	if err != nil {
+		s.closePasv()
+		s.fail(err)
+
+		return
+	}
+
+	s.transfer(func(conn net.Conn) error {
+		if _, err := io.WriteString(conn, mlsxEntry("cdir", fi, ".")); err != nil {
+			return err
+		}
+
+		for _, info := range infos {
+			typ := "file"
+			if info.IsDir() {
+				typ = "dir"
+			}
+
+			if _, err := io.WriteString(conn, mlsxEntry(typ, info, info.Name())); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *session) retr(arg string) {
+	f, err := os.Open(s.realPath(arg))
+	if err != nil {
+		s.closePasv()
+		s.fail(err)
+
+		return
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err != nil || fi.IsDir() {
+		s.closePasv()
+		s.reply(550, "not a regular file")
+
+		return
+	}
+
+	s.transfer(func(conn net.Conn) error {
+		_, err := io.Copy(conn, f)
+
+		return err
+	})
+}
+
+func (s *session) stor(arg string) {
+	f, err := os.OpenFile(s.realPath(arg), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		s.closePasv()
+		s.fail(err)
+
+		return
+	}
+	defer f.Close()
+
+	s.transfer(func(conn net.Conn) error {
+		_, err := io.Copy(f, conn)
+
+		return err
+	})
+}
+
+func mlsxEntry(typ string, info os.FileInfo, name string) string {
+	return fmt.Sprintf(
+		"type=%s;size=%d;modify=%s;unix.mode=%04o; %s\r\n",
+		typ,
+		info.Size(),
+		info.ModTime().UTC().Format(mlsdTimeFormat),
+		info.Mode().Perm(),
+		name,
+	)
+}
@@ -0,0 +1,186 @@
+package sftptest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"sync"
+)
+
+type Server struct {
+	Addr     string
+	User     string
+	Password string
+	HostKey  ssh.PublicKey
+
+	listener       net.Listener
+	config         *ssh.ServerConfig
+	mu             sync.Mutex
+	authorizedKeys []ssh.PublicKey
+	conns          map[net.Conn]struct{}
+	wg             sync.WaitGroup
+}
+
+func NewServer(user, password string, authorizedKeys ...ssh.PublicKey) *Server {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("sftptest: failed to generate host key: %v", err))
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		panic(fmt.Sprintf("sftptest: failed to create host key signer: %v", err))
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("sftptest: failed to listen on a port: %v", err))
+	}
+
+	s := &Server{
+		Addr:           l.Addr().String(),
+		User:           user,
+		Password:       password,
+		HostKey:        signer.PublicKey(),
+		listener:       l,
+		authorizedKeys: authorizedKeys,
+		conns:          make(map[net.Conn]struct{}),
+	}
+
+	s.config = &ssh.ServerConfig{
+		PasswordCallback:  s.checkPassword,
+		PublicKeyCallback: s.checkPublicKey,
+	}
+	s.config.AddHostKey(signer)
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+func (s *Server) AddAuthorizedKey(key ssh.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authorizedKeys = append(s.authorizedKeys, key)
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) checkPassword(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	if s.Password != "" && meta.User() == s.User && string(password) == s.Password {
+		return nil, nil
+	}
+
+	return nil, errors.New("invalid credentials")
+}
+
+func (s *Server) checkPublicKey(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if meta.User() != s.User {
+		return nil, errors.New("invalid credentials")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.authorizedKeys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return nil, nil
+		}
+	}
+
+	return nil, errors.New("unknown public key")
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+			}()
+
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer channel.Close()
+
+			for req := range requests {
+				// the payload of a subsystem request is a length prefixed string
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					return
+				}
+				server.Serve()
+
+				return
+			}
+		}()
+	}
+}
@@ -0,0 +1,56 @@
+// Package spool holds the content of the writers which need all of it before writing to a bucket.
+package spool
+
+import (
+	"context"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// File is a temporary file whose content is written to a bucket at once.
+type File struct {
+	*os.File
+}
+
+// New creates a temporary file, its name starts with the prefix.
+func New(prefix string) (*File, error) {
+	file, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{File: file}, nil
+}
+
+// Upload writes the whole content of the file to the bucket. The writer of the bucket has its
+// context canceled when the copy fails, so the buckets supporting it discard the partial content.
+func (f *File) Upload(ctx context.Context, b bucketly.Bucket, name string, opts ...bucketly.WriteOption) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dest, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, f); err != nil {
+		cancel()
+		dest.Close()
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+// Remove closes and deletes the file.
+func (f *File) Remove() {
+	f.Close()
+	os.Remove(f.Name())
+}
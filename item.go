@@ -175,3 +175,21 @@ func (i *BucketItem) stat() (err error) {
 
 	return err
 }
+
+// RebindItem copies the item as an item of another bucket, e.g. a bucket wrapping the original one.
+func RebindItem(bucket Bucket, name string, from Item) *BucketItem {
+	item := NewItem(bucket, name)
+	item.SetDir(from.IsDir())
+	item.SetSize(from.Size())
+	item.SetMode(from.Mode())
+	item.SetModeTime(from.ModTime())
+
+	// avoid the lazy stat of the original item, the one of the new bucket is used if needed
+	if bi, ok := from.(*BucketItem); ok {
+		item.etag = bi.etag
+		item.metadata = bi.metadata
+		item.sys = bi.sys
+	}
+
+	return item
+}
@@ -36,6 +36,11 @@ func (b *Bucket) PathSeparator() rune {
 	return os.PathSeparator
 }
 
+// StoresMetadata reports false, the metadata of the items is not kept.
+func (b *Bucket) StoresMetadata() bool {
+	return false
+}
+
 func (b *Bucket) Name() string {
 	return b.name
 }
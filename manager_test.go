@@ -2,9 +2,14 @@ package bucketly_test
 
 import (
 	"context"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/suite"
 	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/blobadapter"
 	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"gocloud.dev/blob/memblob"
 	"os"
 	"testing"
 )
@@ -35,6 +40,98 @@ func TestLocalBucketManagerTestSuite(t *testing.T) {
 	suite.Run(t, s)
 }
 
+func TestFTPBucketManagerTestSuite(t *testing.T) {
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return newFTPBucket(fmt.Sprintf("bucketly-%s", uuid.New().String()))
+	}
+
+	s.newManager = newFTPBucketManager
+
+	suite.Run(t, s)
+}
+
+func TestSFTPBucketManagerTestSuite(t *testing.T) {
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return newSFTPBucket(fmt.Sprintf("bucketly-%s", uuid.New().String()))
+	}
+
+	s.newManager = newSFTPBucketManager
+
+	suite.Run(t, s)
+}
+
+func TestMemoryBucketManagerTestSuite(t *testing.T) {
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return memory.NewBucket(name)
+	}
+
+	s.newManager = newMemoryBucketManager
+
+	suite.Run(t, s)
+}
+
+func TestBlobAdapterBucketManagerTestSuite(t *testing.T) {
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return blobadapter.NewBucket(name, memblob.OpenBucket(nil))
+	}
+
+	s.newManager = newBlobAdapterBucketManager
+
+	suite.Run(t, s)
+}
+
+func TestAzureBucketManagerTestSuite(t *testing.T) {
+	if os.Getenv("AZURE_STORAGE_ACCOUNT") == "" {
+		t.Skip("AZURE_STORAGE_ACCOUNT is not set")
+	}
+
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return newAzureBucket(fmt.Sprintf("bucketly-%s", uuid.New().String()))
+	}
+
+	s.newManager = newAzureBucketManager
+
+	suite.Run(t, s)
+}
+
+func TestGCSBucketManagerTestSuite(t *testing.T) {
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return newGCSBucket(fmt.Sprintf("bucketly-%s", uuid.New().String()))
+	}
+
+	s.newManager = newGCSBucketManager
+
+	suite.Run(t, s)
+}
+
+func TestWebDAVBucketManagerTestSuite(t *testing.T) {
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return newWebDAVBucket(fmt.Sprintf("bucketly-%s", uuid.New().String()))
+	}
+
+	s.newManager = newWebDAVBucketManager
+
+	suite.Run(t, s)
+}
+
+func TestBoltBucketManagerTestSuite(t *testing.T) {
+	s := new(BucketManagerTestSuite)
+	s.newBucket = func(name string) bucketly.Bucket {
+		return newBoltBucket(fmt.Sprintf("bucketly-%s", uuid.New().String()))
+	}
+
+	s.newManager = newBoltBucketManager
+
+	suite.Run(t, s)
+}
+
 func (suite *BucketManagerTestSuite) TestCreateAndRemove() {
 	ctx := context.Background()
 	bucket := suite.newBucket(os.Getenv("AWS_S3_BUCKET"))
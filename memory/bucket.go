@@ -0,0 +1,717 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pathSeparator   rune        = '/'
+	defaultDirMode  os.FileMode = 0744
+	defaultFileMode os.FileMode = 0666
+)
+
+var errWriterClosed = errors.New("writer is closed")
+
+type (
+	Bucket struct {
+		name  string
+		mu    sync.RWMutex
+		nodes map[string]*node
+	}
+
+	node struct {
+		dir      bool
+		data     []byte
+		mode     os.FileMode
+		modTime  time.Time
+		metadata bucketly.Metadata
+		etag     string
+	}
+
+	writer struct {
+		bucket   *Bucket
+		name     string
+		mode     os.FileMode
+		metadata bucketly.Metadata
+		buf      bytes.Buffer
+		closed   bool
+	}
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+)
+
+func NewBucket(name string) *Bucket {
+	return &Bucket{
+		name:  name,
+		nodes: make(map[string]*node),
+	}
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(_ context.Context, name string) (io.ReadCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	n, err := b.get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	// the content of a node is never modified in place, it is safe to hand it out
+	return ioutil.NopCloser(bytes.NewReader(n.data)), nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.Close()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+func (b *Bucket) NewWriter(_ context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultFileMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return &writer{
+		bucket:   b,
+		name:     key,
+		mode:     wo.Mode,
+		metadata: copyMetadata(wo.Metadata),
+	}, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(_ context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := b.get(key)
+	if err != nil {
+		return err
+	}
+
+	if n.dir && len(b.children(key)) > 0 {
+		return fmt.Errorf("%s: directory not empty", name)
+	}
+
+	delete(b.nodes, key)
+
+	return nil
+}
+
+func (b *Bucket) Stat(_ context.Context, name string) (bucketly.Item, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.stat(key)
+}
+
+func (b *Bucket) Mkdir(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n, ok := b.nodes[key]; ok {
+		if !n.dir {
+			return fmt.Errorf("%s is not a directory", name)
+		}
+
+		return nil
+	}
+
+	parent, err := b.get(parentKey(key))
+	if err != nil {
+		return err
+	}
+
+	if !parent.dir {
+		return fmt.Errorf("%s is not a directory", parentKey(key))
+	}
+
+	b.nodes[key] = newDirNode(wo.Mode)
+
+	return nil
+}
+
+func (b *Bucket) MkdirAll(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.mkdirAll(key, wo.Mode)
+}
+
+func (b *Bucket) Chmod(_ context.Context, name string, mode os.FileMode) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := b.get(key)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	n.mode = mode.Perm()
+	n.modTime = time.Now()
+
+	return nil
+}
+
+func (b *Bucket) RemoveAll(_ context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if key == "" {
+		b.nodes = make(map[string]*node)
+
+		return nil
+	}
+
+	delete(b.nodes, key)
+	for k := range b.nodes {
+		if strings.HasPrefix(k, key+string(pathSeparator)) {
+			delete(b.nodes, k)
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Rename(_ context.Context, from string, to string, _ ...bucketly.CopyOption) error {
+	fromKey, err := b.key(from)
+	if err != nil {
+		return err
+	}
+
+	toKey, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if fromKey == "" || toKey == "" {
+		return fmt.Errorf("cannot rename %s to %s", from, to)
+	}
+
+	if strings.HasPrefix(toKey+string(pathSeparator), fromKey+string(pathSeparator)) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := b.get(fromKey)
+	if err != nil {
+		return err
+	}
+
+	// like os.Rename, an existing directory is only replaced by another directory and only when empty,
+	// a file would orphan its children and a directory would merge with them
+	if dest, ok := b.nodes[toKey]; ok && dest.dir && (!n.dir || len(b.children(toKey)) > 0) {
+		return fmt.Errorf("cannot rename %s to %s: %w", from, to, os.ErrExist)
+	}
+
+	if err := b.mkdirAll(parentKey(toKey), defaultDirMode); err != nil {
+		return err
+	}
+
+	delete(b.nodes, fromKey)
+	b.nodes[toKey] = n
+
+	if !n.dir {
+		return nil
+	}
+
+	prefix := fromKey + string(pathSeparator)
+	for k, child := range b.nodes {
+		if strings.HasPrefix(k, prefix) {
+			delete(b.nodes, k)
+			b.nodes[toKey+string(pathSeparator)+strings.TrimPrefix(k, prefix)] = child
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{
+		Mode: from.Mode().Perm(),
+	}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		if co.Mode == 0 {
+			co.Mode = defaultDirMode
+		}
+
+		return b.MkdirAll(ctx, to, bucketly.WithWriteMode(co.Mode))
+	}
+
+	if co.Mode == 0 {
+		co.Mode = defaultFileMode
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := b.NewWriter(ctx, to, bucketly.WithWriteMode(co.Mode), bucketly.WithWriteMetadata(co.Metadata))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	key, err := b.key(dir)
+	if err != nil {
+		return err
+	}
+
+	item, err := b.stat(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, key, walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   key,
+		bucket: b,
+	}, nil
+}
+
+// walk walks the directory of the key, the keys of the subdirectories are walked as they are.
+func (b *Bucket) walk(ctx context.Context, key string, walkFunc bucketly.WalkFunc) error {
+	for _, item := range b.readDir(key) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) readDir(key string) []bucketly.Item {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	keys := b.children(key)
+	sort.Strings(keys)
+
+	items := make([]bucketly.Item, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, b.nodeToItem(k, b.nodes[k]))
+	}
+
+	return items
+}
+
+// key turns a bucket path into the key of its node. The root directory has the empty key.
+func (b *Bucket) key(name string) (string, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(name, string(pathSeparator)), nil
+}
+
+// stat returns the item of the key, which is not sanitized again so its leading dots are kept.
+func (b *Bucket) stat(key string) (bucketly.Item, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	n, err := b.get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.nodeToItem(key, n), nil
+}
+
+func (b *Bucket) get(key string) (*node, error) {
+	if key == "" {
+		return newDirNode(defaultDirMode), nil
+	}
+
+	n, ok := b.nodes[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return n, nil
+}
+
+func (b *Bucket) children(key string) []string {
+	prefix := ""
+	if key != "" {
+		prefix = key + string(pathSeparator)
+	}
+
+	var keys []string
+	for k := range b.nodes {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		if strings.ContainsRune(strings.TrimPrefix(k, prefix), pathSeparator) {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+func (b *Bucket) mkdirAll(key string, mode os.FileMode) error {
+	if key == "" {
+		return nil
+	}
+
+	var current string
+	for _, token := range strings.Split(key, string(pathSeparator)) {
+		if current != "" {
+			current += string(pathSeparator)
+		}
+		current += token
+
+		n, ok := b.nodes[current]
+		if !ok {
+			b.nodes[current] = newDirNode(mode)
+
+			continue
+		}
+
+		if !n.dir {
+			return fmt.Errorf("%s is not a directory", current)
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) nodeToItem(key string, n *node) bucketly.Item {
+	name := key
+	if name == "" {
+		name = string(pathSeparator)
+	}
+
+	item := bucketly.NewItem(b, name)
+	item.SetDir(n.dir)
+	item.SetSize(int64(len(n.data)))
+	item.SetModeTime(n.modTime)
+	item.SetETag(n.etag)
+	item.SetMetadata(copyMetadata(n.metadata))
+
+	mode := n.mode
+	if n.dir {
+		mode |= os.ModeDir
+	}
+	item.SetMode(mode)
+
+	return item
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	data := w.buf.Bytes()
+	n := &node{
+		data:     data,
+		mode:     w.mode.Perm(),
+		modTime:  time.Now(),
+		metadata: w.metadata,
+		etag:     fmt.Sprintf(`"%x"`, md5.Sum(data)),
+	}
+
+	b := w.bucket
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.nodes[w.name]; ok && existing.dir {
+		return fmt.Errorf("%s is a directory", w.name)
+	}
+
+	if err := b.mkdirAll(parentKey(w.name), defaultDirMode); err != nil {
+		return err
+	}
+
+	b.nodes[w.name] = n
+
+	return nil
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.stat(i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		i.queue = i.bucket.readDir(i.name)
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
+
+func newDirNode(mode os.FileMode) *node {
+	return &node{
+		dir:     true,
+		mode:    mode.Perm(),
+		modTime: time.Now(),
+	}
+}
+
+func parentKey(key string) string {
+	i := strings.LastIndexByte(key, byte(pathSeparator))
+	if i < 0 {
+		return ""
+	}
+
+	return key[:i]
+}
+
+func copyMetadata(metadata bucketly.Metadata) bucketly.Metadata {
+	c := make(bucketly.Metadata, len(metadata))
+	for k, v := range metadata {
+		c[k] = v
+	}
+
+	return c
+}
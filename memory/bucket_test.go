@@ -0,0 +1,197 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestBucket_MetadataAndETag(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("test")
+
+	_, err := bucket.Write(ctx, "foo/bar.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"foo": "bar"}))
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err := bucket.Stat(ctx, "foo/bar.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err := item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+	}
+
+	etag, err := item.ETag()
+	if a.NoError(err) {
+		a.Equal(`"827ccb0eea8a706c4c34a16891f84e7b"`, etag)
+	}
+
+	a.NoError(bucket.Copy2(ctx, "foo/bar.txt", "baz.txt"))
+	item, err = bucket.Stat(ctx, "baz.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	metadata, err = item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"foo": "bar"}, metadata)
+	}
+}
+
+func TestBucket_Mode(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("test")
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("12345"), bucketly.WithWriteMode(0600))
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err := bucket.Stat(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0600), item.Mode())
+	}
+
+	a.NoError(bucket.MkdirAll(ctx, "foo/bar", bucketly.WithWriteMode(0700)))
+	item, err = bucket.Stat(ctx, "foo/bar")
+	if a.NoError(err) {
+		a.Equal(os.ModeDir|0700, item.Mode())
+	}
+}
+
+func TestBucket_Remove(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("test")
+
+	_, err := bucket.Write(ctx, "foo/bar.txt", []byte("12345"))
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Error(bucket.Remove(ctx, "foo"))
+	a.NoError(bucket.Remove(ctx, "foo/bar.txt"))
+	a.NoError(bucket.Remove(ctx, "foo"))
+
+	_, err = bucket.Stat(ctx, "foo")
+	a.True(os.IsNotExist(err))
+}
+
+func TestBucket_DotDir(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("test")
+
+	_, err := bucket.Write(ctx, "/.hidden/foo.txt", []byte("12345"))
+	if !a.NoError(err) {
+		return
+	}
+
+	items, err := bucketly.ListDir(ctx, bucket, "/.hidden")
+	if a.NoError(err) && a.Len(items, 1) {
+		a.Equal(".hidden/foo.txt", items[0].Name())
+	}
+
+	var names []string
+	err = bucket.Walk(ctx, "/", func(item bucketly.Item, err error) error {
+		names = append(names, item.Name())
+
+		return err
+	})
+	if a.NoError(err) {
+		a.Equal([]string{".hidden", ".hidden/foo.txt"}, names)
+	}
+}
+
+func TestBucket_Rename(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := memory.NewBucket("test")
+
+	for _, name := range []string{"foo.txt", "bar/baz.txt"} {
+		if _, err := bucket.Write(ctx, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := bucket.Rename(ctx, "foo.txt", "bar")
+	a.True(errors.Is(err, os.ErrExist))
+
+	content, err := bucket.Read(ctx, "bar/baz.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("bar/baz.txt"), content)
+	}
+
+	a.NoError(bucket.Rename(ctx, "foo.txt", "bar/foo.txt"))
+	exists, err := bucket.Exists(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	if _, err := bucket.Write(ctx, "qux/quux.txt", []byte("qux/quux.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = bucket.Rename(ctx, "qux", "bar")
+	a.True(errors.Is(err, os.ErrExist))
+
+	exists, err = bucket.Exists(ctx, "bar/quux.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	a.NoError(bucket.Mkdir(ctx, "empty"))
+	a.NoError(bucket.Rename(ctx, "qux", "empty"))
+	exists, err = bucket.Exists(ctx, "empty/quux.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+}
+
+func TestBucket_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	bucket := memory.NewBucket("test")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("dir%d/file%d.txt", i%5, i)
+			if _, err := bucket.Write(ctx, name, []byte(name)); err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if _, err := bucket.Read(ctx, name); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	err := bucket.Walk(ctx, "/", func(item bucketly.Item, err error) error {
+		if !item.IsDir() {
+			count++
+		}
+
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 50, count)
+}
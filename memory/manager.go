@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"context"
+)
+
+type (
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+func (m *BucketManager) Create(_ context.Context) error {
+	m.bucket.mu.Lock()
+	defer m.bucket.mu.Unlock()
+
+	if m.bucket.nodes == nil {
+		m.bucket.nodes = make(map[string]*node)
+	}
+
+	return nil
+}
+
+func (m *BucketManager) Remove(_ context.Context) error {
+	m.bucket.mu.Lock()
+	defer m.bucket.mu.Unlock()
+
+	m.bucket.nodes = make(map[string]*node)
+
+	return nil
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, string(m.bucket.PathSeparator()))
+}
@@ -0,0 +1,752 @@
+package bucketly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	errMirrorMissing   = errors.New("item is missing")
+	errMirrorUnknown   = errors.New("item is not in the primary")
+	errMirrorMismatch  = errors.New("item differs from the primary")
+	errMirrorNoMembers = errors.New("no member supports the operation")
+)
+
+type (
+	// QuorumError is returned by a mirror when fewer members than the write quorum applied a change.
+	// The members which applied it are not rolled back.
+	QuorumError struct {
+		Op        string
+		Name      string
+		Quorum    int
+		Succeeded int
+		// Errors holds the error of every member, in the mirror order, nil for the successful ones.
+		Errors []error
+	}
+
+	// Divergence is an item which differs on a member of a mirror, either because the member failed
+	// to apply a change, or because Diff found it different from the primary.
+	Divergence struct {
+		// Member is the index of the member, 0 being the primary.
+		Member int
+		Bucket Bucket
+		Op     string
+		Name   string
+		Err    error
+	}
+
+	// Mirror replicates the changes to a primary bucket and its replicas. A change succeeds when at
+	// least the write quorum of members applied it, the members that failed are reported as
+	// divergent for the item. Reads go to the first healthy member not divergent for the item and
+	// fall back to the next ones on errors.
+	Mirror struct {
+		members []Bucket
+		mu      sync.RWMutex
+		quorum  int
+		healthy []bool
+		// divergences are indexed by member and item name.
+		divergences []map[string]Divergence
+	}
+
+	mirrorWriter struct {
+		mirror  *Mirror
+		name    string
+		writers []io.WriteCloser
+		errs    []error
+		// cancel cancels the context of the member writers.
+		cancel context.CancelFunc
+		closed bool
+	}
+
+	mirrorListIterator struct {
+		mirror *Mirror
+		it     ListIterator
+	}
+
+	mirrorEntry struct {
+		dir  bool
+		size int64
+	}
+
+	// mirrorWalkError wraps the error of a walk which visited items, so it is not retried on
+	// another member.
+	mirrorWalkError struct {
+		err error
+	}
+)
+
+func (e *QuorumError) Error() string {
+	var errs []string
+	for i, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("member %d: %s", i, err))
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s %s: %d of %d members succeeded, quorum is %d: %s",
+		e.Op,
+		e.Name,
+		e.Succeeded,
+		len(e.Errors),
+		e.Quorum,
+		strings.Join(errs, "; "),
+	)
+}
+
+// Unwrap returns the error of the first failed member.
+func (e *QuorumError) Unwrap() error {
+	for _, err := range e.Errors {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewMirror returns a mirror of the primary bucket and its replicas. All the members must apply a
+// change until SetWriteQuorum lowers the quorum.
+func NewMirror(primary Bucket, replicas ...Bucket) *Mirror {
+	members := append([]Bucket{primary}, replicas...)
+	m := &Mirror{
+		members:     members,
+		quorum:      len(members),
+		healthy:     make([]bool, len(members)),
+		divergences: make([]map[string]Divergence, len(members)),
+	}
+
+	for i := range members {
+		m.healthy[i] = true
+		m.divergences[i] = make(map[string]Divergence)
+	}
+
+	return m
+}
+
+// SetWriteQuorum sets the number of members which must apply a change, between 1 and all of them.
+func (m *Mirror) SetWriteQuorum(quorum int) {
+	if quorum < 1 {
+		quorum = 1
+	}
+
+	if quorum > len(m.members) {
+		quorum = len(m.members)
+	}
+
+	m.mu.Lock()
+	m.quorum = quorum
+	m.mu.Unlock()
+}
+
+func (m *Mirror) Primary() Bucket {
+	return m.members[0]
+}
+
+func (m *Mirror) Replicas() []Bucket {
+	return append([]Bucket(nil), m.members[1:]...)
+}
+
+// Divergences returns the items the members failed to change, sorted by member and name.
+func (m *Mirror) Divergences() []Divergence {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var divergences []Divergence
+	for _, d := range m.divergences {
+		for _, divergence := range d {
+			divergences = append(divergences, divergence)
+		}
+	}
+
+	sortDivergences(divergences)
+
+	return divergences
+}
+
+// ClearDivergences forgets the divergent items, e.g. once the members have been repaired.
+func (m *Mirror) ClearDivergences() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.divergences {
+		m.divergences[i] = make(map[string]Divergence)
+	}
+}
+
+// Diff walks the directory on every member and reports the items of the replicas which are
+// missing, unknown to the primary or of a different size.
+func (m *Mirror) Diff(ctx context.Context, dir string) ([]Divergence, error) {
+	entries := make([]map[string]mirrorEntry, len(m.members))
+	for i, b := range m.members {
+		w, ok := b.(Walkable)
+		if !ok {
+			return nil, ErrNotSupported
+		}
+
+		entries[i] = make(map[string]mirrorEntry)
+		err := w.Walk(ctx, dir, func(item Item, err error) error {
+			if err != nil {
+				return err
+			}
+
+			entries[i][strings.TrimSuffix(item.Name(), string(b.PathSeparator()))] = mirrorEntry{
+				dir:  item.IsDir(),
+				size: item.Size(),
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var divergences []Divergence
+	for i := 1; i < len(m.members); i++ {
+		diverge := func(name string, err error) {
+			divergences = append(divergences, Divergence{
+				Member: i,
+				Bucket: m.members[i],
+				Op:     "diff",
+				Name:   name,
+				Err:    err,
+			})
+		}
+
+		for name, want := range entries[0] {
+			got, ok := entries[i][name]
+			switch {
+			case !ok:
+				diverge(name, errMirrorMissing)
+			case got.dir != want.dir || (!want.dir && got.size != want.size):
+				diverge(name, errMirrorMismatch)
+			}
+		}
+
+		for name := range entries[i] {
+			if _, ok := entries[0][name]; !ok {
+				diverge(name, errMirrorUnknown)
+			}
+		}
+	}
+
+	sortDivergences(divergences)
+
+	return divergences, nil
+}
+
+func (m *Mirror) Name() string {
+	return m.members[0].Name()
+}
+
+func (m *Mirror) PathSeparator() rune {
+	return m.members[0].PathSeparator()
+}
+
+// StoresMetadata reports whether every member keeps the metadata of the items.
+func (m *Mirror) StoresMetadata() bool {
+	for _, member := range m.members {
+		if !StoresMetadata(member) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *Mirror) Read(ctx context.Context, name string) ([]byte, error) {
+	var content []byte
+	err := m.read(name, func(b Bucket) error {
+		var err error
+		content, err = b.Read(ctx, name)
+
+		return err
+	})
+
+	return content, err
+}
+
+func (m *Mirror) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	err := m.read(name, func(b Bucket) error {
+		var err error
+		r, err = b.NewReader(ctx, name)
+
+		return err
+	})
+
+	return r, err
+}
+
+func (m *Mirror) Write(ctx context.Context, name string, data []byte, opts ...WriteOption) (int, error) {
+	err := m.apply("write", []string{name}, func(b Bucket) error {
+		_, err := b.Write(ctx, name, data, opts...)
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// NewWriter opens a writer on every member. The content is written to all of them and the writer
+// fails as soon as fewer members than the write quorum are still written. The content is then
+// aborted on the members supporting it, instead of being committed on the members still written.
+func (m *Mirror) NewWriter(ctx context.Context, name string, opts ...WriteOption) (io.WriteCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &mirrorWriter{
+		mirror:  m,
+		name:    name,
+		writers: make([]io.WriteCloser, len(m.members)),
+		errs:    make([]error, len(m.members)),
+		cancel:  cancel,
+	}
+
+	for i, b := range m.members {
+		w.writers[i], w.errs[i] = b.NewWriter(ctx, name, opts...)
+	}
+
+	if err := w.check(); err != nil {
+		w.Close()
+
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (m *Mirror) Exists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := m.read(name, func(b Bucket) error {
+		var err error
+		exists, err = b.Exists(ctx, name)
+
+		return err
+	})
+
+	return exists, err
+}
+
+func (m *Mirror) Remove(ctx context.Context, name string) error {
+	return m.apply("remove", []string{name}, func(b Bucket) error {
+		return b.Remove(ctx, name)
+	})
+}
+
+func (m *Mirror) Stat(ctx context.Context, name string) (Item, error) {
+	var item Item
+	err := m.read(name, func(b Bucket) error {
+		var err error
+		item, err = b.Stat(ctx, name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return RebindItem(m, item.Name(), item), nil
+}
+
+func (m *Mirror) Mkdir(ctx context.Context, name string, opts ...WriteOption) error {
+	return m.apply("mkdir", []string{name}, func(b Bucket) error {
+		return b.Mkdir(ctx, name, opts...)
+	})
+}
+
+func (m *Mirror) MkdirAll(ctx context.Context, name string, opts ...WriteOption) error {
+	return m.apply("mkdir", []string{name}, func(b Bucket) error {
+		return b.MkdirAll(ctx, name, opts...)
+	})
+}
+
+func (m *Mirror) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	return m.apply("chmod", []string{name}, func(b Bucket) error {
+		return b.Chmod(ctx, name, mode)
+	})
+}
+
+func (m *Mirror) RemoveAll(ctx context.Context, name string) error {
+	return m.apply("remove", []string{name}, func(b Bucket) error {
+		return b.RemoveAll(ctx, name)
+	})
+}
+
+func (m *Mirror) Rename(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	return m.apply("rename", []string{from, to}, func(b Bucket) error {
+		return b.Rename(ctx, from, to, opts...)
+	})
+}
+
+// Copy copies the item on every member. An item of the mirror is copied by every member from its
+// own copy of the item.
+func (m *Mirror) Copy(ctx context.Context, from Item, to string, opts ...CopyOption) error {
+	m.loadItem(from)
+
+	return m.apply("copy", []string{to}, func(b Bucket) error {
+		return b.Copy(ctx, m.memberItem(from, b), to, opts...)
+	})
+}
+
+func (m *Mirror) CopyAll(ctx context.Context, from Item, to string, opts ...CopyOption) error {
+	m.loadItem(from)
+
+	return m.apply("copy", []string{to}, func(b Bucket) error {
+		return b.CopyAll(ctx, m.memberItem(from, b), to, opts...)
+	})
+}
+
+func (m *Mirror) Copy2(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	fromItem, err := m.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return m.Copy(ctx, fromItem, to, opts...)
+}
+
+func (m *Mirror) CopyAll2(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	fromItem, err := m.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return m.CopyAll(ctx, fromItem, to, opts...)
+}
+
+// Walk walks the first healthy member. It falls back to the next member when the walk fails
+// before visiting any item.
+func (m *Mirror) Walk(ctx context.Context, dir string, walkFunc WalkFunc) error {
+	return m.read(dir, func(b Bucket) error {
+		w, ok := b.(Walkable)
+		if !ok {
+			return errMirrorNoMembers
+		}
+
+		visited := false
+		err := w.Walk(ctx, dir, func(item Item, err error) error {
+			visited = true
+			if item != nil {
+				item = RebindItem(m, item.Name(), item)
+			}
+
+			return walkFunc(item, err)
+		})
+		if err != nil && visited {
+			return &mirrorWalkError{err: err}
+		}
+
+		return err
+	})
+}
+
+func (m *Mirror) Items(name string) (ListIterator, error) {
+	var it ListIterator
+	err := m.read(name, func(b Bucket) error {
+		l, ok := b.(Listable)
+		if !ok {
+			return errMirrorNoMembers
+		}
+
+		var err error
+		it, err = l.Items(name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &mirrorListIterator{
+		mirror: m,
+		it:     it,
+	}, nil
+}
+
+// read runs the read on the members in order until one succeeds. A missing item is reported as it
+// is, the members are expected to have the same items.
+func (m *Mirror) read(name string, fn func(b Bucket) error) error {
+	var first error
+	for _, i := range m.readOrder(name) {
+		err := fn(m.members[i])
+		switch {
+		case err == nil:
+			m.setHealthy(i, true)
+
+			return nil
+		case os.IsNotExist(err):
+			m.setHealthy(i, true)
+
+			return err
+		}
+
+		var walkErr *mirrorWalkError
+		if errors.As(err, &walkErr) {
+			return walkErr.err
+		}
+
+		if err != errMirrorNoMembers {
+			m.setHealthy(i, false)
+		}
+
+		if first == nil || first == errMirrorNoMembers {
+			first = err
+		}
+	}
+
+	if first == errMirrorNoMembers {
+		return ErrNotSupported
+	}
+
+	return first
+}
+
+// readOrder returns the healthy members which are not divergent for the item first.
+func (m *Mirror) readOrder(name string) []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var preferred, others []int
+	for i := range m.members {
+		if m.healthy[i] && !m.divergent(i, name) {
+			preferred = append(preferred, i)
+
+			continue
+		}
+
+		others = append(others, i)
+	}
+
+	return append(preferred, others...)
+}
+
+// divergent tells whether the item, or one of its parents, is divergent on the member.
+func (m *Mirror) divergent(member int, name string) bool {
+	key := m.key(name)
+	sep := string(m.PathSeparator())
+	for k := range m.divergences[member] {
+		if k == "" || k == key || strings.HasPrefix(key, k+sep) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Mirror) setHealthy(member int, healthy bool) {
+	m.mu.Lock()
+	m.healthy[member] = healthy
+	m.mu.Unlock()
+}
+
+// apply runs the change on all the members concurrently and settles the result.
+func (m *Mirror) apply(op string, names []string, fn func(b Bucket) error) error {
+	errs := make([]error, len(m.members))
+	wg := sync.WaitGroup{}
+	for i, b := range m.members {
+		wg.Add(1)
+		go func(i int, b Bucket) {
+			defer wg.Done()
+			errs[i] = fn(b)
+		}(i, b)
+	}
+	wg.Wait()
+
+	return m.settle(op, names, errs)
+}
+
+// settle records the members which failed to apply a change applied by others as divergent. A
+// change which failed on every member leaves them consistent, so the error of the primary is
+// returned as it is.
+func (m *Mirror) settle(op string, names []string, errs []error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+
+	if succeeded == 0 {
+		return errs[0]
+	}
+
+	for i, err := range errs {
+		for _, name := range names {
+			key := m.key(name)
+			if err == nil {
+				delete(m.divergences[i], key)
+
+				continue
+			}
+
+			m.divergences[i][key] = Divergence{
+				Member: i,
+				Bucket: m.members[i],
+				Op:     op,
+				Name:   key,
+				Err:    err,
+			}
+		}
+
+		if err != nil && !os.IsNotExist(err) && !os.IsExist(err) {
+			m.healthy[i] = false
+		}
+	}
+
+	if succeeded >= m.quorum {
+		return nil
+	}
+
+	return &QuorumError{
+		Op:        op,
+		Name:      names[len(names)-1],
+		Quorum:    m.quorum,
+		Succeeded: succeeded,
+		Errors:    errs,
+	}
+}
+
+// memberItem returns the copy of the item on the member when it belongs to the mirror.
+func (m *Mirror) memberItem(item Item, member Bucket) Item {
+	if item.Bucket() != Bucket(m) {
+		return item
+	}
+
+	return RebindItem(member, item.Name(), item)
+}
+
+// loadItem runs the lazy stat of an item of another bucket before the members use it concurrently.
+func (m *Mirror) loadItem(item Item) {
+	if item.Bucket() == Bucket(m) {
+		return
+	}
+
+	item.Metadata()
+	item.ETag()
+}
+
+func (m *Mirror) key(name string) string {
+	key, err := Sanitize(m, name)
+	if err != nil {
+		return name
+	}
+
+	return key
+}
+
+func (w *mirrorWriter) Write(p []byte) (int, error) {
+	for i, writer := range w.writers {
+		if w.errs[i] != nil {
+			continue
+		}
+
+		n, err := writer.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+
+		w.errs[i] = err
+	}
+
+	if err := w.check(); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *mirrorWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.cancel()
+
+	// below the quorum, the writers are canceled before being closed, so the members still written
+	// drop the content instead of committing it
+	failed := w.check() != nil
+	if failed {
+		w.cancel()
+	}
+
+	for i, writer := range w.writers {
+		if writer == nil {
+			continue
+		}
+
+		if err := writer.Close(); err != nil && w.errs[i] == nil && !failed {
+			w.errs[i] = err
+		}
+	}
+
+	return w.mirror.settle("write", []string{w.name}, w.errs)
+}
+
+// check fails when fewer members than the write quorum are still written.
+func (w *mirrorWriter) check() error {
+	succeeded := 0
+	for _, err := range w.errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+
+	w.mirror.mu.RLock()
+	quorum := w.mirror.quorum
+	w.mirror.mu.RUnlock()
+
+	if succeeded >= quorum {
+		return nil
+	}
+
+	if succeeded == 0 {
+		return w.errs[0]
+	}
+
+	return &QuorumError{
+		Op:        "write",
+		Name:      w.name,
+		Quorum:    quorum,
+		Succeeded: succeeded,
+		Errors:    append([]error(nil), w.errs...),
+	}
+}
+
+func (i *mirrorListIterator) Next(ctx context.Context) (Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return RebindItem(i.mirror, item.Name(), item), nil
+}
+
+func (i *mirrorListIterator) Close() error {
+	return i.it.Close()
+}
+
+func (e *mirrorWalkError) Error() string {
+	return e.err.Error()
+}
+
+func sortDivergences(divergences []Divergence) {
+	sort.Slice(divergences, func(i, j int) bool {
+		if divergences[i].Member != divergences[j].Member {
+			return divergences[i].Member < divergences[j].Member
+		}
+
+		return divergences[i].Name < divergences[j].Name
+	})
+}
@@ -0,0 +1,188 @@
+package bucketly_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"io"
+	"os"
+	"testing"
+)
+
+var errUnavailable = errors.New("bucket is unavailable")
+
+// unavailableBucket fails every read, like a bucket which can't be reached.
+type unavailableBucket struct {
+	bucketly.Bucket
+}
+
+func (b *unavailableBucket) Read(context.Context, string) ([]byte, error) {
+	return nil, errUnavailable
+}
+
+func (b *unavailableBucket) NewReader(context.Context, string) (io.ReadCloser, error) {
+	return nil, errUnavailable
+}
+
+func (b *unavailableBucket) Stat(context.Context, string) (bucketly.Item, error) {
+	return nil, errUnavailable
+}
+
+// abortingBucket only writes the content when the writer is closed with its context alive, like
+// the buckets aborting the canceled uploads.
+type abortingBucket struct {
+	*memory.Bucket
+}
+
+type abortingWriter struct {
+	ctx    context.Context
+	bucket *abortingBucket
+	name   string
+	buf    bytes.Buffer
+}
+
+func (b *abortingBucket) NewWriter(ctx context.Context, name string, _ ...bucketly.WriteOption) (io.WriteCloser, error) {
+	return &abortingWriter{ctx: ctx, bucket: b, name: name}, nil
+}
+
+func (w *abortingWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *abortingWriter) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := w.bucket.Bucket.Write(w.ctx, w.name, w.buf.Bytes())
+
+	return err
+}
+
+func TestMirror_Write(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	primary, replica := memory.NewBucket("primary"), memory.NewBucket("replica")
+	mirror := bucketly.NewMirror(primary, replica)
+
+	_, err := mirror.Write(ctx, "foo/a.txt", []byte("12345"))
+	a.NoError(err)
+
+	w, err := mirror.NewWriter(ctx, "foo/b.txt")
+	if a.NoError(err) {
+		_, err = io.WriteString(w, "123")
+		a.NoError(err)
+		a.NoError(w.Close())
+	}
+
+	a.NoError(mirror.Copy2(ctx, "foo/a.txt", "bar/a.txt"))
+	a.NoError(mirror.Rename(ctx, "foo/b.txt", "bar/b.txt"))
+	a.NoError(mirror.Remove(ctx, "foo/a.txt"))
+
+	for _, b := range []bucketly.Bucket{primary, replica} {
+		names, err := walkNames(ctx, b.(bucketly.Walkable), "/")
+		if a.NoError(err, b.Name()) {
+			a.Equal([]string{"bar", "bar/a.txt", "bar/b.txt", "foo"}, names, b.Name())
+		}
+	}
+
+	item, err := mirror.Stat(ctx, "bar/a.txt")
+	if a.NoError(err) {
+		a.Equal(mirror, item.Bucket())
+	}
+
+	a.True(os.IsNotExist(mirror.Remove(ctx, "foo/a.txt")))
+	a.Empty(mirror.Divergences())
+}
+
+func TestMirror_Quorum(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	primary := memory.NewBucket("primary")
+	replica := bucketly.ReadOnly(memory.NewBucket("replica"))
+	mirror := bucketly.NewMirror(primary, replica)
+
+	_, err := mirror.Write(ctx, "foo.txt", []byte("12345"))
+	var quorumErr *bucketly.QuorumError
+	if a.True(errors.As(err, &quorumErr)) {
+		a.Equal(1, quorumErr.Succeeded)
+		a.Equal(2, quorumErr.Quorum)
+		a.True(errors.Is(err, os.ErrPermission))
+	}
+
+	mirror.SetWriteQuorum(1)
+
+	w, err := mirror.NewWriter(ctx, "bar.txt")
+	if a.NoError(err) {
+		_, err = io.WriteString(w, "123")
+		a.NoError(err)
+		a.NoError(w.Close())
+	}
+
+	divergences := mirror.Divergences()
+	if a.Len(divergences, 2) {
+		a.Equal(1, divergences[0].Member)
+		a.Equal("bar.txt", divergences[0].Name)
+		a.Equal("foo.txt", divergences[1].Name)
+		a.Equal("write", divergences[1].Op)
+	}
+
+	diff, err := mirror.Diff(ctx, "/")
+	if a.NoError(err) && a.Len(diff, 2) {
+		a.Equal(replica, diff[0].Bucket)
+		a.Equal("bar.txt", diff[0].Name)
+	}
+
+	mirror.ClearDivergences()
+	a.Empty(mirror.Divergences())
+}
+
+func TestMirror_AbortedWrite(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	primary := &abortingBucket{Bucket: memory.NewBucket("primary")}
+	replica := bucketly.ReadOnly(memory.NewBucket("replica"))
+	mirror := bucketly.NewMirror(primary, replica)
+
+	_, err := mirror.NewWriter(ctx, "foo.txt")
+	a.True(errors.Is(err, os.ErrPermission))
+
+	exists, err := primary.Exists(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+}
+
+func TestMirror_ReadFallback(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	primary, replica := memory.NewBucket("primary"), memory.NewBucket("replica")
+	mirror := bucketly.NewMirror(&unavailableBucket{Bucket: primary}, replica)
+
+	_, err := mirror.Write(ctx, "foo.txt", []byte("12345"))
+	a.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		content, err := mirror.Read(ctx, "foo.txt")
+		if a.NoError(err) {
+			a.Equal([]byte("12345"), content)
+		}
+	}
+
+	_, err = mirror.Stat(ctx, "bar.txt")
+	a.True(os.IsNotExist(err))
+
+	// the primary missed the write, so it is read from the replica
+	mirror = bucketly.NewMirror(bucketly.ReadOnly(memory.NewBucket("primary")), memory.NewBucket("replica"))
+	mirror.SetWriteQuorum(1)
+	_, err = mirror.Write(ctx, "bar.txt", []byte("123"))
+	a.NoError(err)
+
+	content, err := mirror.Read(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("123"), content)
+	}
+}
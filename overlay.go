@@ -0,0 +1,809 @@
+package bucketly
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// whiteoutPrefix marks, in the upper layer, a removed item of the lower layer.
+	whiteoutPrefix = "~wh."
+	// opaqueMarker hides, in the upper layer, the whole content of a lower layer directory.
+	opaqueMarker = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+type (
+	// Overlay merges a read-only lower bucket with a writable upper bucket. Reads fall through
+	// to the lower bucket, writes go to the upper one and removed lower items are hidden by
+	// whiteout files written in the upper bucket.
+	Overlay struct {
+		lower Bucket
+		upper Bucket
+	}
+
+	overlayEntry struct {
+		item Item
+		// lower reports whether the lower layer content under a directory is visible.
+		lower bool
+	}
+
+	overlayListIterator struct {
+		name    string
+		overlay *Overlay
+		queue   []Item
+	}
+
+	// overlayWriter drops the whiteouts hiding the item once its content is committed.
+	overlayWriter struct {
+		io.WriteCloser
+		ctx     context.Context
+		overlay *Overlay
+		key     string
+	}
+)
+
+func NewOverlay(lower, upper Bucket) *Overlay {
+	return &Overlay{
+		lower: lower,
+		upper: upper,
+	}
+}
+
+func (o *Overlay) Lower() Bucket {
+	return o.lower
+}
+
+func (o *Overlay) Upper() Bucket {
+	return o.upper
+}
+
+func (o *Overlay) Name() string {
+	return o.upper.Name()
+}
+
+func (o *Overlay) PathSeparator() rune {
+	return o.upper.PathSeparator()
+}
+
+// StoresMetadata reports whether both layers keep the metadata of the items.
+func (o *Overlay) StoresMetadata() bool {
+	return StoresMetadata(o.lower) && StoresMetadata(o.upper)
+}
+
+func (o *Overlay) Read(ctx context.Context, name string) ([]byte, error) {
+	layer, key, err := o.layer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return layer.Read(ctx, key)
+}
+
+func (o *Overlay) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	layer, key, err := o.layer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return layer.NewReader(ctx, key)
+}
+
+func (o *Overlay) Write(ctx context.Context, name string, data []byte, opts ...WriteOption) (int, error) {
+	key, err := o.key(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := o.checkReserved(key); err != nil {
+		return 0, err
+	}
+
+	n, err := o.upper.Write(ctx, key, data, opts...)
+	if err != nil {
+		return n, err
+	}
+
+	return n, o.dropWhiteouts(ctx, key, false)
+}
+
+func (o *Overlay) NewWriter(ctx context.Context, name string, opts ...WriteOption) (io.WriteCloser, error) {
+	key, err := o.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.checkReserved(key); err != nil {
+		return nil, err
+	}
+
+	w, err := o.upper.NewWriter(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &overlayWriter{
+		WriteCloser: w,
+		ctx:         ctx,
+		overlay:     o,
+		key:         key,
+	}, nil
+}
+
+func (o *Overlay) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := o.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (o *Overlay) Remove(ctx context.Context, name string) error {
+	key, err := o.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	item, err := o.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if item.IsDir() {
+		entries, err := o.readDir(ctx, key, o.lowerDirVisible(ctx, key))
+		if err != nil {
+			return err
+		}
+
+		if len(entries) > 0 {
+			return fmt.Errorf("%s: directory not empty", name)
+		}
+	}
+
+	return o.remove(ctx, key)
+}
+
+func (o *Overlay) Stat(ctx context.Context, name string) (Item, error) {
+	key, err := o.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if isWhiteout(Base(o, key)) {
+		return nil, os.ErrNotExist
+	}
+
+	item, err := o.upper.Stat(ctx, o.layerName(key))
+	if err == nil {
+		return o.newItem(key, item), nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	visible, err := o.lowerVisible(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !visible {
+		return nil, os.ErrNotExist
+	}
+
+	item, err = o.lower.Stat(ctx, o.layerName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return o.newItem(key, item), nil
+}
+
+func (o *Overlay) Mkdir(ctx context.Context, name string, opts ...WriteOption) error {
+	key, err := o.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	if parent := o.parentKey(key); parent != "" {
+		item, err := o.Stat(ctx, parent)
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			return fmt.Errorf("%s is not a directory", parent)
+		}
+	}
+
+	if err := o.checkReserved(key); err != nil {
+		return err
+	}
+
+	if err := o.upper.MkdirAll(ctx, o.layerName(o.parentKey(key))); err != nil {
+		return err
+	}
+
+	if err := o.upper.Mkdir(ctx, key, opts...); err != nil {
+		return err
+	}
+
+	return o.dropWhiteouts(ctx, key, true)
+}
+
+func (o *Overlay) MkdirAll(ctx context.Context, name string, opts ...WriteOption) error {
+	key, err := o.key(name)
+	if err != nil {
+		return err
+	}
+
+	if err := o.checkReserved(key); err != nil {
+		return err
+	}
+
+	if err := o.upper.MkdirAll(ctx, o.layerName(key), opts...); err != nil {
+		return err
+	}
+
+	return o.dropWhiteouts(ctx, key, true)
+}
+
+// Chmod copies up an item of the lower layer before changing its mode.
+func (o *Overlay) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	key, err := o.key(name)
+	if err != nil {
+		return err
+	}
+
+	layer, key, err := o.layer(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if layer == o.lower {
+		item, err := o.lower.Stat(ctx, o.layerName(key))
+		if err != nil {
+			return err
+		}
+
+		if err := o.upper.Copy(ctx, item, o.layerName(key)); err != nil {
+			return err
+		}
+	}
+
+	return o.upper.Chmod(ctx, o.layerName(key), mode)
+}
+
+func (o *Overlay) RemoveAll(ctx context.Context, name string) error {
+	key, err := o.key(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := o.Stat(ctx, key); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return o.remove(ctx, key)
+}
+
+// Rename moves the item within the upper layer when the lower layer has nothing under it and
+// copies it otherwise.
+func (o *Overlay) Rename(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	fromKey, err := o.key(from)
+	if err != nil {
+		return err
+	}
+
+	toKey, err := o.key(to)
+	if err != nil {
+		return err
+	}
+
+	if fromKey == "" || toKey == "" {
+		return fmt.Errorf("cannot rename %s to %s", from, to)
+	}
+
+	ps := string(o.PathSeparator())
+	if strings.HasPrefix(toKey+ps, fromKey+ps) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	item, err := o.Stat(ctx, fromKey)
+	if err != nil {
+		return err
+	}
+
+	inLower, err := o.inLower(ctx, fromKey)
+	if err != nil {
+		return err
+	}
+
+	if err := o.RemoveAll(ctx, toKey); err != nil {
+		return err
+	}
+
+	if inLower {
+		if err := o.CopyAll(ctx, item, toKey, opts...); err != nil {
+			return err
+		}
+
+		return o.RemoveAll(ctx, fromKey)
+	}
+
+	if err := o.checkReserved(toKey); err != nil {
+		return err
+	}
+
+	if err := o.upper.Rename(ctx, o.layerName(fromKey), o.layerName(toKey), opts...); err != nil {
+		return err
+	}
+
+	return o.dropWhiteouts(ctx, toKey, item.IsDir())
+}
+
+func (o *Overlay) Copy(ctx context.Context, from Item, to string, opts ...CopyOption) error {
+	key, err := o.key(to)
+	if err != nil {
+		return err
+	}
+
+	if err := o.checkReserved(key); err != nil {
+		return err
+	}
+
+	if err := o.upper.Copy(ctx, from, o.layerName(key), opts...); err != nil {
+		return err
+	}
+
+	return o.dropWhiteouts(ctx, key, from.IsDir())
+}
+
+func (o *Overlay) CopyAll(ctx context.Context, from Item, to string, opts ...CopyOption) error {
+	return CopyAll(ctx, from, NewItem(o, to), opts...)
+}
+
+func (o *Overlay) Copy2(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	fromItem, err := o.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return o.Copy(ctx, fromItem, to, opts...)
+}
+
+func (o *Overlay) CopyAll2(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	fromItem, err := o.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return o.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (o *Overlay) Walk(ctx context.Context, dir string, walkFunc WalkFunc) error {
+	item, err := o.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		key, _ := o.key(dir)
+		err = o.walk(ctx, key, o.lowerDirVisible(ctx, key), walkFunc)
+	}
+
+	if err != nil && err != ErrStopWalk && err != ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (o *Overlay) Items(name string) (ListIterator, error) {
+	key, err := o.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &overlayListIterator{
+		name:    key,
+		overlay: o,
+	}, nil
+}
+
+func (o *Overlay) walk(ctx context.Context, key string, lower bool, walkFunc WalkFunc) error {
+	entries, err := o.readDir(ctx, key, lower)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := walkFunc(entry.item, nil); err != nil {
+			if err == ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !entry.item.IsDir() {
+			continue
+		}
+
+		if err := o.walk(ctx, entry.item.Name(), entry.lower, walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDir merges the content of the directory from both layers. The upper layer items win and the
+// lower layer items are skipped when whited out or when the directory is opaque.
+func (o *Overlay) readDir(ctx context.Context, key string, lower bool) ([]overlayEntry, error) {
+	upperItems, err := ListDir(ctx, o.upper, o.layerName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*overlayEntry)
+	whiteouts := make(map[string]bool)
+	for _, item := range upperItems {
+		base := o.base(item)
+		if base == opaqueMarker {
+			lower = false
+
+			continue
+		}
+
+		if isWhiteout(base) {
+			whiteouts[strings.TrimPrefix(base, whiteoutPrefix)] = true
+
+			continue
+		}
+
+		entries[base] = &overlayEntry{item: o.newItem(o.join(key, base), item)}
+	}
+
+	if lower {
+		lowerItems, err := ListDir(ctx, o.lower, o.layerName(key))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range lowerItems {
+			base := o.base(item)
+			if whiteouts[base] || isWhiteout(base) {
+				continue
+			}
+
+			if entry, ok := entries[base]; ok {
+				entry.lower = entry.item.IsDir() && item.IsDir()
+
+				continue
+			}
+
+			entries[base] = &overlayEntry{
+				item:  o.newItem(o.join(key, base), item),
+				lower: item.IsDir(),
+			}
+		}
+	}
+
+	result := make([]overlayEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].item.Name() < result[j].item.Name()
+	})
+
+	return result, nil
+}
+
+// layer returns the layer holding the item.
+func (o *Overlay) layer(ctx context.Context, name string) (Bucket, string, error) {
+	key, err := o.key(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if isWhiteout(Base(o, key)) {
+		return nil, "", os.ErrNotExist
+	}
+
+	exists, err := o.upper.Exists(ctx, o.layerName(key))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if exists {
+		return o.upper, key, nil
+	}
+
+	visible, err := o.lowerVisible(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !visible {
+		return nil, "", os.ErrNotExist
+	}
+
+	return o.lower, key, nil
+}
+
+// lowerVisible reports whether the item of the lower layer is not hidden by a whiteout, an opaque
+// directory or a file of the upper layer.
+func (o *Overlay) lowerVisible(ctx context.Context, key string) (bool, error) {
+	if key == "" {
+		return true, nil
+	}
+
+	ps := string(o.PathSeparator())
+	parts := strings.Split(key, ps)
+	for i := range parts {
+		parent := strings.Join(parts[:i], ps)
+		current := strings.Join(parts[:i+1], ps)
+
+		for _, marker := range []string{o.join(parent, opaqueMarker), o.whiteout(current)} {
+			exists, err := o.upper.Exists(ctx, marker)
+			if err != nil {
+				return false, err
+			}
+
+			if exists {
+				return false, nil
+			}
+		}
+
+		if i == len(parts)-1 {
+			break
+		}
+
+		item, err := o.upper.Stat(ctx, current)
+		if err == nil && !item.IsDir() {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (o *Overlay) lowerDirVisible(ctx context.Context, key string) bool {
+	visible, err := o.lowerVisible(ctx, key)
+	if err != nil || !visible {
+		return false
+	}
+
+	item, err := o.lower.Stat(ctx, o.layerName(key))
+
+	return err == nil && item.IsDir()
+}
+
+func (o *Overlay) inLower(ctx context.Context, key string) (bool, error) {
+	visible, err := o.lowerVisible(ctx, key)
+	if err != nil || !visible {
+		return false, err
+	}
+
+	return o.lower.Exists(ctx, o.layerName(key))
+}
+
+// remove deletes the item from the upper layer and whites it out when the lower layer has it.
+func (o *Overlay) remove(ctx context.Context, key string) error {
+	inLower, err := o.inLower(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		items, err := ListDir(ctx, o.lower, o.layerName(key))
+		if err != nil {
+			return err
+		}
+
+		inLower = len(items) > 0
+	}
+
+	if err := o.upper.RemoveAll(ctx, o.layerName(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if !inLower {
+		return nil
+	}
+
+	if key == "" {
+		_, err = o.upper.Write(ctx, opaqueMarker, []byte{})
+
+		return err
+	}
+
+	_, err = o.upper.Write(ctx, o.whiteout(key), []byte{})
+
+	return err
+}
+
+// checkReserved rejects the paths of items which would be taken for whiteouts.
+func (o *Overlay) checkReserved(key string) error {
+	if key == "" {
+		return nil
+	}
+
+	for _, part := range strings.Split(key, string(o.PathSeparator())) {
+		if isWhiteout(part) {
+			return fmt.Errorf("%s: %s is a reserved name", key, part)
+		}
+	}
+
+	return nil
+}
+
+// dropWhiteouts removes the whiteouts hiding the path of an item once it is created in the upper
+// layer, so a failed write leaves the removed lower items hidden. The directories which were whited
+// out become opaque first so the removed lower content stays hidden.
+func (o *Overlay) dropWhiteouts(ctx context.Context, key string, dir bool) error {
+	if key == "" {
+		return nil
+	}
+
+	ps := string(o.PathSeparator())
+	parts := strings.Split(key, ps)
+	for i := range parts {
+		current := strings.Join(parts[:i+1], ps)
+		exists, err := o.upper.Exists(ctx, o.whiteout(current))
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			continue
+		}
+
+		if i < len(parts)-1 || dir {
+			if _, err := o.upper.Write(ctx, o.join(current, opaqueMarker), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		if err := o.upper.Remove(ctx, o.whiteout(current)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// key turns a path into a key without leading or trailing separators. The root directory has the
+// empty key.
+func (o *Overlay) key(name string) (string, error) {
+	name, err := Sanitize(o, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(name, string(o.PathSeparator())), nil
+}
+
+func (o *Overlay) layerName(key string) string {
+	if key == "" {
+		return string(o.PathSeparator())
+	}
+
+	return key
+}
+
+func (o *Overlay) parentKey(key string) string {
+	i := strings.LastIndex(key, string(o.PathSeparator()))
+	if i < 0 {
+		return ""
+	}
+
+	return key[:i]
+}
+
+func (o *Overlay) join(dir, base string) string {
+	if dir == "" {
+		return base
+	}
+
+	return dir + string(o.PathSeparator()) + base
+}
+
+func (o *Overlay) whiteout(key string) string {
+	return o.join(o.parentKey(key), whiteoutPrefix+Base(o, key))
+}
+
+func (o *Overlay) base(item Item) string {
+	return Base(o, strings.TrimRight(item.Name(), string(o.PathSeparator())))
+}
+
+func (o *Overlay) newItem(key string, from Item) Item {
+	if key == "" {
+		key = string(o.PathSeparator())
+	}
+
+	return RebindItem(o, key, from)
+}
+
+func (i *overlayListIterator) Next(ctx context.Context) (Item, error) {
+	if i.queue == nil {
+		item, err := i.overlay.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		i.queue = make([]Item, 0)
+		if !item.IsDir() {
+			return item, nil
+		}
+
+		entries, err := i.overlay.readDir(ctx, i.name, i.overlay.lowerDirVisible(ctx, i.name))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			i.queue = append(i.queue, entry.item)
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *overlayListIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
+
+func (w *overlayWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	return w.overlay.dropWhiteouts(w.ctx, w.key, false)
+}
+
+func isWhiteout(base string) bool {
+	return strings.HasPrefix(base, whiteoutPrefix)
+}
@@ -0,0 +1,199 @@
+package bucketly_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"os"
+	"testing"
+)
+
+func newOverlay(t *testing.T) (*bucketly.Overlay, *memory.Bucket) {
+	ctx := context.Background()
+	lower := memory.NewBucket("lower")
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/sub/c.txt", "other/d.txt"} {
+		if _, err := lower.Write(ctx, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return bucketly.NewOverlay(lower, memory.NewBucket("upper")), lower
+}
+
+// failingBucket fails the writes while failing is set.
+type failingBucket struct {
+	*memory.Bucket
+	failing bool
+}
+
+func (b *failingBucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	if b.failing {
+		return 0, errors.New("write failed")
+	}
+
+	return b.Bucket.Write(ctx, name, data, opts...)
+}
+
+func walkNames(ctx context.Context, bucket bucketly.Walkable, name string) ([]string, error) {
+	var names []string
+	err := bucket.Walk(ctx, name, func(item bucketly.Item, err error) error {
+		names = append(names, item.Name())
+
+		return nil
+	})
+
+	return names, err
+}
+
+func TestOverlay_ReadFallThrough(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	overlay, lower := newOverlay(t)
+
+	_, err := overlay.Write(ctx, "a.txt", []byte("upper"))
+	a.NoError(err)
+	_, err = overlay.Write(ctx, "dir/e.txt", []byte("upper"))
+	a.NoError(err)
+
+	content, err := overlay.Read(ctx, "a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("upper"), content)
+	}
+
+	content, err = overlay.Read(ctx, "dir/b.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("dir/b.txt"), content)
+	}
+
+	content, err = lower.Read(ctx, "a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("a.txt"), content)
+	}
+
+	names, err := walkNames(ctx, overlay, "/")
+	if a.NoError(err) {
+		a.Equal([]string{"a.txt", "dir", "dir/b.txt", "dir/e.txt", "dir/sub", "dir/sub/c.txt", "other", "other/d.txt"}, names)
+	}
+
+	item, err := overlay.Stat(ctx, "dir/sub/c.txt")
+	if a.NoError(err) {
+		a.Equal(int64(len("dir/sub/c.txt")), item.Size())
+		a.Equal(overlay, item.Bucket())
+	}
+}
+
+func TestOverlay_Whiteouts(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	overlay, lower := newOverlay(t)
+
+	a.NoError(overlay.Remove(ctx, "a.txt"))
+	a.NoError(overlay.RemoveAll(ctx, "dir/sub"))
+	a.Error(overlay.Remove(ctx, "other"))
+
+	_, err := overlay.Stat(ctx, "a.txt")
+	a.Equal(os.ErrNotExist, err)
+
+	_, err = overlay.Stat(ctx, "dir/sub/c.txt")
+	a.Equal(os.ErrNotExist, err)
+
+	_, err = overlay.Read(ctx, "dir/sub/c.txt")
+	a.True(os.IsNotExist(err))
+
+	names, err := walkNames(ctx, overlay, "")
+	if a.NoError(err) {
+		a.Equal([]string{"dir", "dir/b.txt", "other", "other/d.txt"}, names)
+	}
+
+	items, err := getItemsArray(ctx, overlay, "dir")
+	if a.NoError(err) && a.Len(items, 1) {
+		a.Equal("dir/b.txt", items[0].Name())
+	}
+
+	exists, err := lower.Exists(ctx, "dir/sub/c.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	a.NoError(overlay.MkdirAll(ctx, "dir/sub"))
+	_, err = overlay.Write(ctx, "a.txt", []byte("new"))
+	a.NoError(err)
+
+	names, err = walkNames(ctx, overlay, "")
+	if a.NoError(err) {
+		a.Equal([]string{"a.txt", "dir", "dir/b.txt", "dir/sub", "other", "other/d.txt"}, names)
+	}
+
+	a.NoError(overlay.RemoveAll(ctx, "/"))
+
+	names, err = walkNames(ctx, overlay, "")
+	if a.NoError(err) {
+		a.Empty(names)
+	}
+
+	names, err = walkNames(ctx, lower, "")
+	if a.NoError(err) {
+		a.Len(names, 7)
+	}
+}
+
+func TestOverlay_Rename(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	overlay, lower := newOverlay(t)
+
+	a.NoError(overlay.Rename(ctx, "dir", "moved"))
+
+	names, err := walkNames(ctx, overlay, "")
+	if a.NoError(err) {
+		a.Equal([]string{"a.txt", "moved", "moved/b.txt", "moved/sub", "moved/sub/c.txt", "other", "other/d.txt"}, names)
+	}
+
+	exists, err := lower.Exists(ctx, "dir/b.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	_, err = overlay.Write(ctx, "~wh.a.txt", []byte("12345"))
+	a.Error(err)
+}
+
+func TestOverlay_FailedWrite(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	lower := memory.NewBucket("lower")
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		if _, err := lower.Write(ctx, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upper := &failingBucket{Bucket: memory.NewBucket("upper")}
+	overlay := bucketly.NewOverlay(lower, upper)
+
+	a.NoError(overlay.Remove(ctx, "a.txt"))
+	a.NoError(overlay.RemoveAll(ctx, "dir"))
+
+	// the removed lower items stay hidden when the upper layer rejects the write
+	upper.failing = true
+	_, err := overlay.Write(ctx, "a.txt", []byte("upper"))
+	a.Error(err)
+	_, err = overlay.Write(ctx, "dir/c.txt", []byte("upper"))
+	a.Error(err)
+
+	names, err := walkNames(ctx, overlay, "")
+	if a.NoError(err) {
+		a.Empty(names)
+	}
+
+	upper.failing = false
+	_, err = overlay.Write(ctx, "dir/c.txt", []byte("upper"))
+	a.NoError(err)
+
+	names, err = walkNames(ctx, overlay, "")
+	if a.NoError(err) {
+		a.Equal([]string{"dir", "dir/c.txt"}, names)
+	}
+}
@@ -0,0 +1,590 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrExceeded is wrapped by the errors returned when an operation would exceed a quota.
+var ErrExceeded = errors.New("quota exceeded")
+
+type (
+	// Bucket limits the bytes and the number of files stored in a bucket, or in some of its
+	// directories. The usage is loaded by walking the wrapped bucket on the first operation and kept
+	// up to date by the bucket, so the changes made directly to the wrapped bucket are only seen
+	// after Refresh.
+	Bucket struct {
+		bucket bucketly.Bucket
+		config Config
+		mu     sync.Mutex
+		// sizes holds the size of every file, it is nil until the usage is loaded.
+		sizes map[string]int64
+		usage map[string]Usage
+	}
+
+	Config struct {
+		limits map[string]Limit
+	}
+
+	Option func(cfg *Config)
+
+	// Limit is a quota, a zero value is unlimited.
+	Limit struct {
+		MaxBytes   int64
+		MaxObjects int64
+	}
+
+	Usage struct {
+		Bytes   int64
+		Objects int64
+	}
+
+	// ExceededError is returned when writing the item would exceed the quota of the prefix.
+	ExceededError struct {
+		Name   string
+		Prefix string
+		Limit  Limit
+		// Usage is what the usage of the prefix would have been.
+		Usage Usage
+	}
+
+	listIterator struct {
+		bucket *Bucket
+		it     bucketly.ListIterator
+	}
+)
+
+// WithLimit sets the quota of the whole bucket.
+func WithLimit(limit Limit) Option {
+	return WithPrefixLimit("", limit)
+}
+
+// WithPrefixLimit sets the quota of a directory.
+func WithPrefixLimit(prefix string, limit Limit) Option {
+	return func(cfg *Config) {
+		cfg.limits[prefix] = limit
+	}
+}
+
+func NewBucket(b bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		limits: make(map[string]Limit),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	limits := make(map[string]Limit, len(cfg.limits))
+	for prefix, limit := range cfg.limits {
+		if limit.MaxBytes < 0 || limit.MaxObjects < 0 {
+			return nil, fmt.Errorf("invalid limit of %s: %+v", prefix, limit)
+		}
+
+		key, err := bucketly.Sanitize(b, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		limits[strings.Trim(key, string(b.PathSeparator()))] = limit
+	}
+
+	cfg.limits = limits
+
+	return &Bucket{
+		bucket: b,
+		config: cfg,
+	}, nil
+}
+
+func (e *ExceededError) Error() string {
+	prefix := e.Prefix
+	if prefix == "" {
+		prefix = "bucket"
+	}
+
+	return fmt.Sprintf(
+		"%s: %s of %s: %d/%d bytes, %d/%d objects",
+		e.Name,
+		ErrExceeded,
+		prefix,
+		e.Usage.Bytes,
+		e.Limit.MaxBytes,
+		e.Usage.Objects,
+		e.Limit.MaxObjects,
+	)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrExceeded
+}
+
+func (b *Bucket) Parent() bucketly.Bucket {
+	return b.bucket
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.bucket)
+}
+
+func (b *Bucket) Name() string {
+	return b.bucket.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.bucket.PathSeparator()
+}
+
+// Usage returns the bytes and the number of files stored in the directory.
+func (b *Bucket) Usage(ctx context.Context, prefix string) (Usage, error) {
+	prefix, err := b.key(prefix)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	if err := b.load(ctx); err != nil {
+		return Usage{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var u Usage
+	for key, size := range b.sizes {
+		if within(b, key, prefix) {
+			u.Bytes += size
+			u.Objects++
+		}
+	}
+
+	return u, nil
+}
+
+// Refresh loads the usage again from the wrapped bucket.
+func (b *Bucket) Refresh(ctx context.Context) error {
+	b.mu.Lock()
+	b.sizes = nil
+	b.mu.Unlock()
+
+	return b.load(ctx)
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	return b.bucket.Read(ctx, name)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.bucket.NewReader(ctx, name)
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return 0, err
+	}
+
+	undo, err := b.reserve(ctx, name, map[string]int64{key: int64(len(data))})
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := b.bucket.Write(ctx, name, data, opts...)
+	if err != nil {
+		b.apply(undo)
+
+		return n, err
+	}
+
+	return n, nil
+}
+
+// NewWriter returns a writer failing with an ExceededError once the content written would exceed a
+// quota. The content only reaches the wrapped bucket when the writer is closed without such a
+// failure, an item replaced by the writer is left as it was otherwise.
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	return b.newWriter(ctx, name, opts...)
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bucket.Exists(ctx, name)
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.bucket.Remove(ctx, name); err != nil {
+		return err
+	}
+
+	b.apply(map[string]int64{key: -1})
+
+	return nil
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.bucket.Mkdir(ctx, name, opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.bucket.MkdirAll(ctx, name, opts...)
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	return b.bucket.Chmod(ctx, name, mode)
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.bucket.RemoveAll(ctx, name); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	changes := make(map[string]int64)
+	for k := range b.sizes {
+		if within(b, k, key) {
+			changes[k] = -1
+		}
+	}
+	b.mu.Unlock()
+
+	b.apply(changes)
+
+	return nil
+}
+
+// Rename moves the usage of the renamed files, it fails when the destination quotas would be
+// exceeded.
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromKey, err := b.key(from)
+	if err != nil {
+		return err
+	}
+
+	toKey, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if err := b.load(ctx); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	moved := make(map[string]int64)
+	for key, size := range b.sizes {
+		if within(b, key, fromKey) {
+			moved[key] = size
+		}
+	}
+
+	changes := make(map[string]int64, len(moved)*2)
+	for key := range moved {
+		changes[key] = -1
+	}
+
+	for key, size := range moved {
+		changes[toKey+strings.TrimPrefix(key, fromKey)] = size
+	}
+
+	undo, err := b.set(to, changes, true)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := b.bucket.Rename(ctx, from, to, opts...); err != nil {
+		b.apply(undo)
+
+		return err
+	}
+
+	return nil
+}
+
+// Copy fails when copying the file would exceed a quota, a directory is copied by the wrapped
+// bucket.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if from.Bucket() == bucketly.Bucket(b) {
+		item, err := b.bucket.Stat(ctx, from.Name())
+		if err != nil {
+			return err
+		}
+
+		from = item
+	}
+
+	if from.IsDir() {
+		return b.bucket.Copy(ctx, from, to, opts...)
+	}
+
+	key, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	undo, err := b.reserve(ctx, to, map[string]int64{key: from.Size()})
+	if err != nil {
+		return err
+	}
+
+	if err := b.bucket.Copy(ctx, from, to, opts...); err != nil {
+		b.apply(undo)
+
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if item == nil {
+			return walkFunc(item, err)
+		}
+
+		return walkFunc(b.newItem(item), err)
+	})
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	l, ok := b.bucket.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+// load walks the wrapped bucket for the size of the files, unless it was done already.
+func (b *Bucket) load(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sizes != nil {
+		return nil
+	}
+
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	sizes := make(map[string]int64)
+	err := w.Walk(ctx, string(b.PathSeparator()), func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if item.IsDir() {
+			return nil
+		}
+
+		key, err := b.key(item.Name())
+		if err != nil {
+			return err
+		}
+
+		sizes[key] = item.Size()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	usage := make(map[string]Usage, len(b.config.limits))
+	for prefix := range b.config.limits {
+		var u Usage
+		for key, size := range sizes {
+			if within(b, key, prefix) {
+				u.Bytes += size
+				u.Objects++
+			}
+		}
+
+		usage[prefix] = u
+	}
+
+	b.sizes = sizes
+	b.usage = usage
+
+	return nil
+}
+
+// reserve records the new sizes of the files, a negative size being a removed file, before they are
+// written. It returns the changes reverting it.
+func (b *Bucket) reserve(ctx context.Context, name string, changes map[string]int64) (map[string]int64, error) {
+	if err := b.load(ctx); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.set(name, changes, true)
+}
+
+// apply records the new sizes of the files without checking the quotas.
+func (b *Bucket) apply(changes map[string]int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.set("", changes, false)
+}
+
+// set must be called with the lock held. Nothing is recorded when the usage is not loaded yet.
+func (b *Bucket) set(name string, changes map[string]int64, check bool) (map[string]int64, error) {
+	if b.sizes == nil {
+		return nil, nil
+	}
+
+	prefixes := make([]string, 0, len(b.config.limits))
+	for prefix := range b.config.limits {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	usage := make(map[string]Usage, len(prefixes))
+	for _, prefix := range prefixes {
+		var delta Usage
+		for key, size := range changes {
+			if !within(b, key, prefix) {
+				continue
+			}
+
+			if old, ok := b.sizes[key]; ok {
+				delta.Bytes -= old
+				delta.Objects--
+			}
+
+			if size >= 0 {
+				delta.Bytes += size
+				delta.Objects++
+			}
+		}
+
+		u := b.usage[prefix]
+		u.Bytes += delta.Bytes
+		u.Objects += delta.Objects
+		limit := b.config.limits[prefix]
+		if check && exceeds(limit, u, delta) {
+			return nil, &ExceededError{
+				Name:   name,
+				Prefix: prefix,
+				Limit:  limit,
+				Usage:  u,
+			}
+		}
+
+		usage[prefix] = u
+	}
+
+	undo := make(map[string]int64, len(changes))
+	for key, size := range changes {
+		if old, ok := b.sizes[key]; ok {
+			undo[key] = old
+		} else {
+			undo[key] = -1
+		}
+
+		if size < 0 {
+			delete(b.sizes, key)
+		} else {
+			b.sizes[key] = size
+		}
+	}
+
+	for prefix, u := range usage {
+		b.usage[prefix] = u
+	}
+
+	return undo, nil
+}
+
+// key turns a path into a key without leading or trailing separators, the root directory has the
+// empty key.
+func (b *Bucket) key(name string) (string, error) {
+	key, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(key, string(b.PathSeparator())), nil
+}
+
+// newItem rebinds an item of the wrapped bucket.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	return bucketly.RebindItem(b, from.Name(), from)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.bucket.newItem(item), nil
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
@@ -0,0 +1,190 @@
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/quota"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func newBucket(t *testing.T, b bucketly.Bucket, opts ...quota.Option) *quota.Bucket {
+	bucket, err := quota.NewBucket(b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func usage(t *testing.T, bucket *quota.Bucket, prefix string) quota.Usage {
+	u, err := bucket.Usage(context.Background(), prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestBucket_Write(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	_, err := parent.Write(ctx, "foo.txt", []byte("12345"))
+	a.NoError(err)
+
+	bucket := newBucket(t, parent, quota.WithLimit(quota.Limit{MaxBytes: 10, MaxObjects: 2}))
+	a.Equal(quota.Usage{Bytes: 5, Objects: 1}, usage(t, bucket, "/"))
+
+	_, err = bucket.Write(ctx, "bar.txt", []byte("123456"))
+	a.True(errors.Is(err, quota.ErrExceeded))
+
+	var exceeded *quota.ExceededError
+	if a.True(errors.As(err, &exceeded)) {
+		a.Equal("", exceeded.Prefix)
+		a.Equal(quota.Usage{Bytes: 11, Objects: 2}, exceeded.Usage)
+	}
+
+	exists, err := parent.Exists(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	_, err = bucket.Write(ctx, "foo.txt", []byte("1234567890"))
+	a.NoError(err)
+	a.Equal(quota.Usage{Bytes: 10, Objects: 1}, usage(t, bucket, "/"))
+
+	_, err = bucket.Write(ctx, "foo.txt", []byte("123"))
+	a.NoError(err)
+	_, err = bucket.Write(ctx, "bar.txt", []byte("123"))
+	a.NoError(err)
+	_, err = bucket.Write(ctx, "baz.txt", []byte("1"))
+	a.True(errors.Is(err, quota.ErrExceeded))
+
+	item, err := bucket.Stat(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.True(errors.Is(bucket.Copy(ctx, item, "baz.txt"), quota.ErrExceeded))
+	}
+
+	a.NoError(bucket.Remove(ctx, "bar.txt"))
+	a.Equal(quota.Usage{Bytes: 3, Objects: 1}, usage(t, bucket, "/"))
+	a.NoError(bucket.Copy2(ctx, "foo.txt", "baz.txt"))
+	a.Equal(quota.Usage{Bytes: 6, Objects: 2}, usage(t, bucket, "/"))
+}
+
+func TestBucket_NewWriter(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent, quota.WithLimit(quota.Limit{MaxBytes: 8}))
+
+	w, err := bucket.NewWriter(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = w.Write([]byte("12345"))
+	a.NoError(err)
+	_, err = w.Write([]byte("12345"))
+	a.True(errors.Is(err, quota.ErrExceeded))
+	a.True(errors.Is(w.Close(), quota.ErrExceeded))
+
+	exists, err := parent.Exists(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+	a.Equal(quota.Usage{}, usage(t, bucket, "/"))
+
+	w, err = bucket.NewWriter(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = w.Write([]byte("12345678"))
+	a.NoError(err)
+	a.NoError(w.Close())
+	a.Equal(quota.Usage{Bytes: 8, Objects: 1}, usage(t, bucket, "/"))
+
+	// an overwrite exceeding the quota keeps the previous content
+	w, err = bucket.NewWriter(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = w.Write([]byte("123456789"))
+	a.True(errors.Is(err, quota.ErrExceeded))
+	a.True(errors.Is(w.Close(), quota.ErrExceeded))
+
+	content, err := parent.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345678"), content)
+	}
+	a.Equal(quota.Usage{Bytes: 8, Objects: 1}, usage(t, bucket, "/"))
+}
+
+func TestBucket_PrefixLimit(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, memory.NewBucket("parent"), quota.WithPrefixLimit("tenants/a", quota.Limit{MaxObjects: 1}))
+
+	_, err := bucket.Write(ctx, "tenants/a/foo.txt", []byte("foo"))
+	a.NoError(err)
+	_, err = bucket.Write(ctx, "tenants/ab/foo.txt", []byte("foo"))
+	a.NoError(err)
+	_, err = bucket.Write(ctx, "tenants/b/foo.txt", []byte("foo"))
+	a.NoError(err)
+
+	_, err = bucket.Write(ctx, "tenants/a/bar.txt", []byte("bar"))
+	var exceeded *quota.ExceededError
+	if a.True(errors.As(err, &exceeded)) {
+		a.Equal("tenants/a", exceeded.Prefix)
+	}
+
+	a.True(errors.Is(bucket.Rename(ctx, "tenants/b", "tenants/a/b"), quota.ErrExceeded))
+	a.NoError(bucket.Rename(ctx, "tenants/a", "tenants/c"))
+	a.Equal(quota.Usage{}, usage(t, bucket, "tenants/a"))
+	a.Equal(quota.Usage{Bytes: 3, Objects: 1}, usage(t, bucket, "tenants/c"))
+
+	a.NoError(bucket.RemoveAll(ctx, "tenants"))
+	a.Equal(quota.Usage{}, usage(t, bucket, "/"))
+}
+
+func TestBucket_Local(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "bucketly-quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	parent := local.NewBucket(dir)
+	_, err = parent.Write(ctx, "tenants/a/foo.txt", []byte("12345"))
+	a.NoError(err)
+
+	bucket := newBucket(t, parent, quota.WithPrefixLimit("tenants/a", quota.Limit{MaxBytes: 10}))
+	a.Equal(quota.Usage{Bytes: 5, Objects: 1}, usage(t, bucket, "tenants/a"))
+
+	_, err = bucket.Write(ctx, "tenants/a/bar/baz.txt", []byte("12345"))
+	a.NoError(err)
+	_, err = bucket.Write(ctx, "tenants/a/qux.txt", []byte("1"))
+	a.True(errors.Is(err, quota.ErrExceeded))
+
+	exists, err := parent.Exists(ctx, "tenants/a/qux.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	a.NoError(bucket.Rename(ctx, "tenants/a/bar", "tenants/b"))
+	a.Equal(quota.Usage{Bytes: 5, Objects: 1}, usage(t, bucket, "tenants/a"))
+
+	content, err := bucket.Read(ctx, "tenants/b/baz.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+}
@@ -0,0 +1,25 @@
+package quota
+
+import (
+	"github.com/vcraescu/bucketly"
+	"strings"
+)
+
+// within reports whether the key is the prefix or is in it, every key is within the empty prefix.
+func within(b bucketly.PathSeparable, key, prefix string) bool {
+	if prefix == "" || key == prefix {
+		return true
+	}
+
+	return strings.HasPrefix(key, prefix+string(b.PathSeparator()))
+}
+
+// exceeds reports whether the usage exceeds the limit because of the delta. A usage shrinking is
+// always allowed, even when it is still over the limit.
+func exceeds(limit Limit, u Usage, delta Usage) bool {
+	if limit.MaxBytes > 0 && delta.Bytes > 0 && u.Bytes > limit.MaxBytes {
+		return true
+	}
+
+	return limit.MaxObjects > 0 && delta.Objects > 0 && u.Objects > limit.MaxObjects
+}
@@ -0,0 +1,122 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/internal/spool"
+)
+
+// writer spools the content in a temporary file and only writes it to the wrapped bucket on Close,
+// so a write exceeding a quota leaves the replaced file as it was.
+type writer struct {
+	ctx    context.Context
+	bucket *Bucket
+	name   string
+	key    string
+	opts   []bucketly.WriteOption
+	file   *spool.File
+	// old is the size of the replaced file, -1 for a new one.
+	old int64
+	// reserved is the size recorded for the file while it is written.
+	reserved int64
+	size     int64
+	err      error
+	closed   bool
+}
+
+func (b *Bucket) newWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (*writer, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.load(ctx); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	old, ok := b.sizes[key]
+	if !ok {
+		old = -1
+	}
+
+	reserved := old
+	if reserved < 0 {
+		reserved = 0
+	}
+
+	_, err = b.set(name, map[string]int64{key: reserved}, true)
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := spool.New("bucketly-quota-")
+	if err != nil {
+		b.apply(map[string]int64{key: old})
+
+		return nil, err
+	}
+
+	return &writer{
+		ctx:      ctx,
+		bucket:   b,
+		name:     name,
+		key:      key,
+		opts:     opts,
+		file:     file,
+		old:      old,
+		reserved: reserved,
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("%s: writer is closed", w.name)
+	}
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if size := w.size + int64(len(p)); size > w.reserved {
+		if _, err := w.bucket.reserve(w.ctx, w.name, map[string]int64{w.key: size}); err != nil {
+			w.err = err
+
+			return 0, err
+		}
+
+		w.reserved = size
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.file.Remove()
+
+	b := w.bucket
+	if w.err != nil {
+		b.apply(map[string]int64{w.key: w.old})
+
+		return w.err
+	}
+
+	if err := w.file.Upload(w.ctx, b.bucket, w.name, w.opts...); err != nil {
+		b.apply(map[string]int64{w.key: w.old})
+
+		return err
+	}
+
+	b.apply(map[string]int64{w.key: w.size})
+
+	return nil
+}
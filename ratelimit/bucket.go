@@ -0,0 +1,386 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	OpRead      Op = "Read"
+	OpNewReader Op = "NewReader"
+	OpWrite     Op = "Write"
+	OpNewWriter Op = "NewWriter"
+	OpExists    Op = "Exists"
+	OpRemove    Op = "Remove"
+	OpStat      Op = "Stat"
+	OpMkdir     Op = "Mkdir"
+	OpMkdirAll  Op = "MkdirAll"
+	OpChmod     Op = "Chmod"
+	OpRemoveAll Op = "RemoveAll"
+	OpRename    Op = "Rename"
+	OpCopy      Op = "Copy"
+	OpWalk      Op = "Walk"
+	OpItems     Op = "Items"
+)
+
+type (
+	// Op is a bucket method limited by the request rate.
+	Op string
+
+	// Bucket limits the bandwidth of the content read and written, and the rate of the requests
+	// made to the wrapped bucket. The waiting stops, with the context error, once the context is
+	// done. Share the limiters between buckets to limit them together.
+	Bucket struct {
+		bucket bucketly.Bucket
+		config Config
+	}
+
+	Config struct {
+		read    *Limiter
+		write   *Limiter
+		ops     *Limiter
+		methods map[Op]*Limiter
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		bucket  *Bucket
+		it      bucketly.ListIterator
+		started bool
+	}
+)
+
+// WithBandwidth limits the bytes per second read and written with the same limiter.
+func WithBandwidth(l *Limiter) Option {
+	return func(cfg *Config) {
+		cfg.read = l
+		cfg.write = l
+	}
+}
+
+// WithReadBandwidth limits the bytes per second read.
+func WithReadBandwidth(l *Limiter) Option {
+	return func(cfg *Config) {
+		cfg.read = l
+	}
+}
+
+// WithWriteBandwidth limits the bytes per second written, copies included.
+func WithWriteBandwidth(l *Limiter) Option {
+	return func(cfg *Config) {
+		cfg.write = l
+	}
+}
+
+// WithRequestRate limits the requests per second of all the methods.
+func WithRequestRate(l *Limiter) Option {
+	return func(cfg *Config) {
+		cfg.ops = l
+	}
+}
+
+// WithMethodRate limits the requests per second of a method, on top of WithRequestRate.
+func WithMethodRate(op Op, l *Limiter) Option {
+	return func(cfg *Config) {
+		cfg.methods[op] = l
+	}
+}
+
+func NewBucket(b bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		methods: make(map[Op]*Limiter),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Bucket{
+		bucket: b,
+		config: cfg,
+	}, nil
+}
+
+func (b *Bucket) Parent() bucketly.Bucket {
+	return b.bucket
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.bucket)
+}
+
+func (b *Bucket) Name() string {
+	return b.bucket.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.bucket.PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	if err := b.wait(ctx, OpRead); err != nil {
+		return nil, err
+	}
+
+	if b.config.read == nil {
+		return b.bucket.Read(ctx, name)
+	}
+
+	// the content is streamed, so it is fetched at the rate of the read bandwidth
+	r, err := b.bucket.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(&reader{
+		ctx:     ctx,
+		r:       r,
+		limiter: b.config.read,
+	})
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.wait(ctx, OpNewReader); err != nil {
+		return nil, err
+	}
+
+	r, err := b.bucket.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.config.read == nil {
+		return r, nil
+	}
+
+	return &reader{
+		ctx:     ctx,
+		r:       r,
+		limiter: b.config.read,
+	}, nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	if err := b.wait(ctx, OpWrite); err != nil {
+		return 0, err
+	}
+
+	if err := b.config.write.WaitN(ctx, len(data)); err != nil {
+		return 0, err
+	}
+
+	return b.bucket.Write(ctx, name, data, opts...)
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	if err := b.wait(ctx, OpNewWriter); err != nil {
+		return nil, err
+	}
+
+	w, err := b.bucket.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.config.write == nil {
+		return w, nil
+	}
+
+	return &writer{
+		ctx:     ctx,
+		w:       w,
+		limiter: b.config.write,
+	}, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.wait(ctx, OpExists); err != nil {
+		return false, err
+	}
+
+	return b.bucket.Exists(ctx, name)
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	if err := b.wait(ctx, OpRemove); err != nil {
+		return err
+	}
+
+	return b.bucket.Remove(ctx, name)
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	if err := b.wait(ctx, OpStat); err != nil {
+		return nil, err
+	}
+
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	if err := b.wait(ctx, OpMkdir); err != nil {
+		return err
+	}
+
+	return b.bucket.Mkdir(ctx, name, opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	if err := b.wait(ctx, OpMkdirAll); err != nil {
+		return err
+	}
+
+	return b.bucket.MkdirAll(ctx, name, opts...)
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	if err := b.wait(ctx, OpChmod); err != nil {
+		return err
+	}
+
+	return b.bucket.Chmod(ctx, name, mode)
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	if err := b.wait(ctx, OpRemoveAll); err != nil {
+		return err
+	}
+
+	return b.bucket.RemoveAll(ctx, name)
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	if err := b.wait(ctx, OpRename); err != nil {
+		return err
+	}
+
+	return b.bucket.Rename(ctx, from, to, opts...)
+}
+
+// Copy copies an item of the bucket with the wrapped bucket, without using the bandwidth. The
+// content of the other items is read at the rate of the write bandwidth.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if err := b.wait(ctx, OpCopy); err != nil {
+		return err
+	}
+
+	if from.Bucket() == bucketly.Bucket(b) {
+		item, err := b.bucket.Stat(ctx, from.Name())
+		if err != nil {
+			return err
+		}
+
+		from = item
+	}
+
+	if from.Bucket() != b.bucket && !from.IsDir() && b.config.write != nil {
+		from = &item{
+			Item:    from,
+			limiter: b.config.write,
+		}
+	}
+
+	return b.bucket.Copy(ctx, from, to, opts...)
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	if err := b.wait(ctx, OpWalk); err != nil {
+		return err
+	}
+
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if item == nil {
+			return walkFunc(item, err)
+		}
+
+		return walkFunc(b.newItem(item), err)
+	})
+}
+
+// Items waits for the request rate on the first call of Next, which has a context.
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	l, ok := b.bucket.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+func (b *Bucket) wait(ctx context.Context, op Op) error {
+	if err := b.config.ops.Wait(ctx); err != nil {
+		return err
+	}
+
+	return b.config.methods[op].Wait(ctx)
+}
+
+// newItem rebinds an item of the wrapped bucket.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	return bucketly.RebindItem(b, from.Name(), from)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if !i.started {
+		i.started = true
+		if err := i.bucket.wait(ctx, OpItems); err != nil {
+			return nil, err
+		}
+	}
+
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.bucket.newItem(item), nil
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
@@ -0,0 +1,204 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/ratelimit"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newLocalBucket(t *testing.T) *local.Bucket {
+	dir, err := ioutil.TempDir("", "bucketly-ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return local.NewBucket(dir)
+}
+
+func newBucket(t *testing.T, b bucketly.Bucket, opts ...ratelimit.Option) *ratelimit.Bucket {
+	bucket, err := ratelimit.NewBucket(b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func TestLimiter_WaitN(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	l := ratelimit.NewLimiter(100, 10)
+
+	start := time.Now()
+	a.NoError(l.WaitN(ctx, 10))
+	a.True(time.Since(start) < 50*time.Millisecond)
+
+	a.NoError(l.WaitN(ctx, 20))
+	a.True(time.Since(start) >= 150*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	a.Equal(context.DeadlineExceeded, l.WaitN(ctx, 100))
+
+	var unlimited *ratelimit.Limiter
+	a.NoError(unlimited.WaitN(context.Background(), 1<<20))
+}
+
+func TestBucket_Bandwidth(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	l := ratelimit.NewLimiter(1000, 100)
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent, ratelimit.WithBandwidth(l))
+	data := bytes.Repeat([]byte("a"), 300)
+
+	start := time.Now()
+	w, err := bucket.NewWriter(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = w.Write(data)
+	a.NoError(err)
+	a.NoError(w.Close())
+	a.True(time.Since(start) >= 150*time.Millisecond)
+
+	start = time.Now()
+	r, err := bucket.NewReader(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	content, err := ioutil.ReadAll(r)
+	a.NoError(err)
+	a.NoError(r.Close())
+	a.Equal(data, content)
+	a.True(time.Since(start) >= 250*time.Millisecond)
+
+	other := newBucket(t, memory.NewBucket("other"), ratelimit.WithWriteBandwidth(l))
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	_, err = other.Write(ctx, "foo.txt", data)
+	a.Equal(context.DeadlineExceeded, err)
+}
+
+func TestBucket_RequestRate(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(
+		t,
+		memory.NewBucket("parent"),
+		ratelimit.WithMethodRate(ratelimit.OpStat, ratelimit.NewLimiter(20, 1)),
+	)
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("foo"))
+	a.NoError(err)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := bucket.Stat(ctx, "foo.txt")
+		a.NoError(err)
+		_, err = bucket.Exists(ctx, "foo.txt")
+		a.NoError(err)
+	}
+	a.True(time.Since(start) >= 90*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err = bucket.Stat(ctx, "foo.txt")
+	a.Equal(context.Canceled, err)
+}
+
+// recordingBucket records when the content of its items is first read.
+type recordingBucket struct {
+	*memory.Bucket
+	firstRead time.Time
+}
+
+type recordingReader struct {
+	io.ReadCloser
+	bucket *recordingBucket
+}
+
+func (b *recordingBucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := b.Bucket.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordingReader{ReadCloser: r, bucket: b}, nil
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	if r.bucket.firstRead.IsZero() {
+		r.bucket.firstRead = time.Now()
+	}
+
+	return r.ReadCloser.Read(p)
+}
+
+func TestBucket_Streaming(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("a"), 300)
+	src := &recordingBucket{Bucket: memory.NewBucket("src")}
+	_, err := src.Bucket.Write(ctx, "foo.txt", data)
+	a.NoError(err)
+
+	// the content is throttled while it is streamed instead of waiting for all of it upfront
+	bucket := newBucket(t, memory.NewBucket("parent"), ratelimit.WithBandwidth(ratelimit.NewLimiter(1000, 100)))
+	start := time.Now()
+	a.NoError(bucket.Copy(ctx, bucketly.NewItem(src, "foo.txt"), "foo.txt"))
+	a.True(time.Since(start) >= 150*time.Millisecond)
+	a.WithinDuration(start, src.firstRead, 100*time.Millisecond)
+
+	src.firstRead = time.Time{}
+	bucket = newBucket(t, src, ratelimit.WithBandwidth(ratelimit.NewLimiter(1000, 100)))
+	start = time.Now()
+	content, err := bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal(data, content)
+	}
+	a.True(time.Since(start) >= 150*time.Millisecond)
+	a.WithinDuration(start, src.firstRead, 100*time.Millisecond)
+}
+
+func TestBucket_LocalCopyAll(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("a"), 150)
+	src := newLocalBucket(t)
+	for _, name := range []string{"docs/a.txt", "docs/b/c.txt"} {
+		_, err := src.Write(ctx, name, data)
+		a.NoError(err)
+	}
+
+	parent := newLocalBucket(t)
+	bucket := newBucket(t, parent, ratelimit.WithBandwidth(ratelimit.NewLimiter(1000, 100)))
+	start := time.Now()
+	a.NoError(bucket.CopyAll(ctx, bucketly.NewItem(src, "docs"), "copy"))
+	a.True(time.Since(start) >= 150*time.Millisecond)
+
+	for _, name := range []string{"copy/a.txt", "copy/b/c.txt"} {
+		content, err := parent.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal(data, content, name)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket refilled at a steady rate, which can be shared by several buckets. A
+// nil limiter, or one with a rate not greater than zero, doesn't limit anything.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter allowing rate tokens per second and bursts of burst tokens. The burst
+// is at least one token, and defaults to the tokens of one second.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	return &Limiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (l *Limiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+
+	return l.rate
+}
+
+func (l *Limiter) Burst() int {
+	if l == nil {
+		return 0
+	}
+
+	return l.burst
+}
+
+// Wait blocks until a token is available or the context is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available or the context is done, in which case the tokens are
+// given back. More tokens than the burst are taken in several steps.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+
+	for n > 0 {
+		chunk := n
+		if chunk > l.burst {
+			chunk = l.burst
+		}
+
+		if err := l.wait(ctx, chunk); err != nil {
+			return err
+		}
+
+		n -= chunk
+	}
+
+	return nil
+}
+
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.advance(time.Now())
+	l.tokens -= float64(n)
+	delay := time.Duration(0)
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.advance(time.Now())
+		l.tokens = math.Min(float64(l.burst), l.tokens+float64(n))
+		l.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
+
+// advance must be called with the lock held.
+func (l *Limiter) advance(now time.Time) {
+	if now.After(l.last) {
+		l.tokens = math.Min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+	}
+}
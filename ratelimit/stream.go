@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/vcraescu/bucketly"
+	"io"
+)
+
+type (
+	reader struct {
+		ctx     context.Context
+		r       io.ReadCloser
+		limiter *Limiter
+	}
+
+	writer struct {
+		ctx     context.Context
+		w       io.WriteCloser
+		limiter *Limiter
+	}
+
+	// item throttles the content of an item copied from another bucket.
+	item struct {
+		bucketly.Item
+		limiter *Limiter
+	}
+)
+
+// Open returns a reader waiting for the bytes read, so the copy streams at the rate of the limiter.
+func (i *item) Open(ctx context.Context) (io.ReadCloser, error) {
+	r, err := i.Item.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{
+		ctx:     ctx,
+		r:       r,
+		limiter: i.limiter,
+	}, nil
+}
+
+// Read waits for the bytes read, so the reading pauses once the rate is exceeded.
+func (r *reader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if err := r.limiter.WaitN(r.ctx, n); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
+
+func (r *reader) Close() error {
+	return r.r.Close()
+}
+
+// Write waits for the bytes before writing them, a burst at a time.
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if burst := w.limiter.Burst(); burst > 0 && len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+func (w *writer) Close() error {
+	return w.w.Close()
+}
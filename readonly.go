@@ -0,0 +1,166 @@
+package bucketly
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+type (
+	// PermissionError is returned by a read-only bucket for every operation changing it.
+	PermissionError struct {
+		Op   string
+		Name string
+	}
+
+	// ReadOnlyBucket passes the reads through to the wrapped bucket and rejects everything else.
+	// The items it returns belong to it, so they can't be used to reach the wrapped bucket.
+	ReadOnlyBucket struct {
+		bucket Bucket
+	}
+
+	readOnlyListIterator struct {
+		bucket *ReadOnlyBucket
+		it     ListIterator
+	}
+)
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s %s: bucket is read-only", e.Op, e.Name)
+}
+
+func (e *PermissionError) Unwrap() error {
+	return os.ErrPermission
+}
+
+func ReadOnly(b Bucket) Bucket {
+	return &ReadOnlyBucket{bucket: b}
+}
+
+func (r *ReadOnlyBucket) Name() string {
+	return r.bucket.Name()
+}
+
+func (r *ReadOnlyBucket) PathSeparator() rune {
+	return r.bucket.PathSeparator()
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (r *ReadOnlyBucket) StoresMetadata() bool {
+	return StoresMetadata(r.bucket)
+}
+
+func (r *ReadOnlyBucket) Read(ctx context.Context, name string) ([]byte, error) {
+	return r.bucket.Read(ctx, name)
+}
+
+func (r *ReadOnlyBucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return r.bucket.NewReader(ctx, name)
+}
+
+func (r *ReadOnlyBucket) Write(_ context.Context, name string, _ []byte, _ ...WriteOption) (int, error) {
+	return 0, &PermissionError{Op: "write", Name: name}
+}
+
+func (r *ReadOnlyBucket) NewWriter(_ context.Context, name string, _ ...WriteOption) (io.WriteCloser, error) {
+	return nil, &PermissionError{Op: "write", Name: name}
+}
+
+func (r *ReadOnlyBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return r.bucket.Exists(ctx, name)
+}
+
+func (r *ReadOnlyBucket) Remove(_ context.Context, name string) error {
+	return &PermissionError{Op: "remove", Name: name}
+}
+
+func (r *ReadOnlyBucket) Stat(ctx context.Context, name string) (Item, error) {
+	item, err := r.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return RebindItem(r, item.Name(), item), nil
+}
+
+func (r *ReadOnlyBucket) Mkdir(_ context.Context, name string, _ ...WriteOption) error {
+	return &PermissionError{Op: "mkdir", Name: name}
+}
+
+func (r *ReadOnlyBucket) MkdirAll(_ context.Context, name string, _ ...WriteOption) error {
+	return &PermissionError{Op: "mkdir", Name: name}
+}
+
+func (r *ReadOnlyBucket) Chmod(_ context.Context, name string, _ os.FileMode) error {
+	return &PermissionError{Op: "chmod", Name: name}
+}
+
+func (r *ReadOnlyBucket) RemoveAll(_ context.Context, name string) error {
+	return &PermissionError{Op: "remove", Name: name}
+}
+
+func (r *ReadOnlyBucket) Rename(_ context.Context, from string, _ string, _ ...CopyOption) error {
+	return &PermissionError{Op: "rename", Name: from}
+}
+
+func (r *ReadOnlyBucket) Copy(_ context.Context, _ Item, to string, _ ...CopyOption) error {
+	return &PermissionError{Op: "copy", Name: to}
+}
+
+func (r *ReadOnlyBucket) CopyAll(_ context.Context, _ Item, to string, _ ...CopyOption) error {
+	return &PermissionError{Op: "copy", Name: to}
+}
+
+func (r *ReadOnlyBucket) Copy2(_ context.Context, _ string, to string, _ ...CopyOption) error {
+	return &PermissionError{Op: "copy", Name: to}
+}
+
+func (r *ReadOnlyBucket) CopyAll2(_ context.Context, _ string, to string, _ ...CopyOption) error {
+	return &PermissionError{Op: "copy", Name: to}
+}
+
+func (r *ReadOnlyBucket) Walk(ctx context.Context, dir string, walkFunc WalkFunc) error {
+	w, ok := r.bucket.(Walkable)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item Item, err error) error {
+		if item != nil {
+			item = RebindItem(r, item.Name(), item)
+		}
+
+		return walkFunc(item, err)
+	})
+}
+
+func (r *ReadOnlyBucket) Items(name string) (ListIterator, error) {
+	l, ok := r.bucket.(Listable)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &readOnlyListIterator{
+		bucket: r,
+		it:     it,
+	}, nil
+}
+
+func (i *readOnlyListIterator) Next(ctx context.Context) (Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return RebindItem(i.bucket, item.Name(), item), nil
+}
+
+func (i *readOnlyListIterator) Close() error {
+	return i.it.Close()
+}
@@ -0,0 +1,79 @@
+package bucketly_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"os"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	_, err := parent.Write(ctx, "foo/bar.txt", []byte("12345"))
+	a.NoError(err)
+
+	bucket := bucketly.ReadOnly(parent)
+
+	content, err := bucket.Read(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	item, err := bucket.Stat(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		a.Equal(bucket, item.Bucket())
+	}
+
+	names, err := walkNames(ctx, bucket.(bucketly.Walkable), "/")
+	if a.NoError(err) {
+		a.Equal([]string{"foo", "foo/bar.txt"}, names)
+	}
+
+	items, err := getItemsArray(ctx, bucket.(bucketly.Listable), "foo")
+	if a.NoError(err) && a.Len(items, 1) {
+		a.Equal(bucket, items[0].Bucket())
+	}
+
+	errs := []error{}
+	_, err = bucket.Write(ctx, "foo/bar.txt", []byte("12345"))
+	errs = append(errs, err)
+	_, err = bucket.NewWriter(ctx, "foo/baz.txt")
+	errs = append(errs, err)
+	errs = append(
+		errs,
+		bucket.Remove(ctx, "foo/bar.txt"),
+		bucket.RemoveAll(ctx, "/"),
+		bucket.Mkdir(ctx, "baz"),
+		bucket.MkdirAll(ctx, "baz/qux"),
+		bucket.Chmod(ctx, "foo/bar.txt", 0600),
+		bucket.Rename(ctx, "foo", "baz"),
+		bucket.Copy(ctx, bucketly.NewItem(parent, "foo/bar.txt"), "baz.txt"),
+		bucket.CopyAll(ctx, bucketly.NewItem(parent, "foo/"), "baz/"),
+		bucket.Copy2(ctx, "foo/bar.txt", "baz.txt"),
+		bucket.CopyAll2(ctx, "foo/", "baz/"),
+	)
+
+	for _, err := range errs {
+		var permErr *bucketly.PermissionError
+		a.True(errors.As(err, &permErr), err)
+		a.True(errors.Is(err, os.ErrPermission), err)
+	}
+
+	names, err = walkNames(ctx, parent, "/")
+	if a.NoError(err) {
+		a.Equal([]string{"foo", "foo/bar.txt"}, names)
+	}
+
+	dest := memory.NewBucket("dest")
+	if a.NoError(dest.CopyAll(ctx, bucketly.NewItem(bucket, "foo/"), "copy/")) {
+		content, err := dest.Read(ctx, "copy/bar.txt")
+		if a.NoError(err) {
+			a.Equal([]byte("12345"), content)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker opens after threshold transient failures in a row and fails fast until the cooldown is
+// over. A single call is then let through, its success closes the breaker again.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	open      bool
+	openedAt  time.Time
+	probing   bool
+}
+
+func (b *breaker) allow(now time.Time) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return nil
+	}
+
+	if now.Sub(b.openedAt) < b.cooldown || b.probing {
+		return ErrCircuitOpen
+	}
+
+	b.probing = true
+
+	return nil
+}
+
+// record counts the result of a call, failed being true for a transient error.
+func (b *breaker) record(failed bool, now time.Time) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.failures = 0
+		b.open = false
+		b.probing = false
+
+		return
+	}
+
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.open = true
+		b.openedAt = now
+		b.probing = false
+	}
+}
+
+func (b *breaker) isOpen(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open && now.Sub(b.openedAt) < b.cooldown
+}
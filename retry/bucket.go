@@ -0,0 +1,491 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+const (
+	defaultMaxAttempts  = 3
+	defaultInitialDelay = 100 * time.Millisecond
+	defaultMaxDelay     = 5 * time.Second
+	defaultMultiplier   = 2
+	defaultJitter       = 0.2
+)
+
+// ErrCircuitOpen is returned without calling the wrapped bucket while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type (
+	// Bucket retries the operations of the wrapped bucket failing with a transient error, waiting
+	// more after every attempt. The operations which are not idempotent are retried only when it is
+	// safe: the streams returned by NewReader and NewWriter are only retried while being opened,
+	// never once content went through them, and a retried Remove or Rename finding its work done
+	// succeeds. An optional circuit breaker fails fast once the wrapped bucket looks down, the
+	// failures of the streams count for it too.
+	Bucket struct {
+		bucket  bucketly.Bucket
+		config  Config
+		breaker *breaker
+	}
+
+	Config struct {
+		maxAttempts  int
+		initialDelay time.Duration
+		maxDelay     time.Duration
+		multiplier   float64
+		jitter       float64
+		classifier   Classifier
+		threshold    int
+		cooldown     time.Duration
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		bucket *Bucket
+		it     bucketly.ListIterator
+	}
+
+	// permanentError stops the retries whatever the error is.
+	permanentError struct {
+		err error
+	}
+)
+
+// WithMaxAttempts sets how many times an operation is tried, 3 by default.
+func WithMaxAttempts(n int) Option {
+	return func(cfg *Config) {
+		cfg.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, 100ms by default, multiplied after every
+// attempt up to the max delay, 5s by default.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.initialDelay = initial
+		cfg.maxDelay = max
+	}
+}
+
+// WithMultiplier sets how much the delay grows after every attempt, 2 by default.
+func WithMultiplier(multiplier float64) Option {
+	return func(cfg *Config) {
+		cfg.multiplier = multiplier
+	}
+}
+
+// WithJitter sets the fraction of the delay taken off randomly, 0.2 by default, so the clients
+// failing together don't retry together.
+func WithJitter(jitter float64) Option {
+	return func(cfg *Config) {
+		cfg.jitter = jitter
+	}
+}
+
+// WithClassifier sets what errors are retried, DefaultClassifier by default.
+func WithClassifier(classifier Classifier) Option {
+	return func(cfg *Config) {
+		cfg.classifier = classifier
+	}
+}
+
+// WithCircuitBreaker opens the circuit breaker after threshold transient failures in a row, the
+// operations failing with ErrCircuitOpen until the cooldown is over.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.threshold = threshold
+		cfg.cooldown = cooldown
+	}
+}
+
+func NewBucket(b bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		maxAttempts:  defaultMaxAttempts,
+		initialDelay: defaultInitialDelay,
+		maxDelay:     defaultMaxDelay,
+		multiplier:   defaultMultiplier,
+		jitter:       defaultJitter,
+		classifier:   DefaultClassifier,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.maxAttempts < 1 {
+		return nil, fmt.Errorf("invalid max attempts %d", cfg.maxAttempts)
+	}
+
+	if cfg.initialDelay < 0 || cfg.maxDelay < cfg.initialDelay {
+		return nil, fmt.Errorf("invalid backoff %s-%s", cfg.initialDelay, cfg.maxDelay)
+	}
+
+	if cfg.multiplier < 1 {
+		return nil, fmt.Errorf("invalid multiplier %v", cfg.multiplier)
+	}
+
+	if cfg.jitter < 0 || cfg.jitter > 1 {
+		return nil, fmt.Errorf("invalid jitter %v", cfg.jitter)
+	}
+
+	if cfg.classifier == nil {
+		return nil, errors.New("missing classifier")
+	}
+
+	return &Bucket{
+		bucket: b,
+		config: cfg,
+		breaker: &breaker{
+			threshold: cfg.threshold,
+			cooldown:  cfg.cooldown,
+		},
+	}, nil
+}
+
+func (b *Bucket) Parent() bucketly.Bucket {
+	return b.bucket
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.bucket)
+}
+
+// CircuitOpen reports whether the operations fail fast.
+func (b *Bucket) CircuitOpen() bool {
+	return b.breaker.isOpen(time.Now())
+}
+
+func (b *Bucket) Name() string {
+	return b.bucket.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.bucket.PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	var data []byte
+	err := b.do(ctx, func(int) error {
+		var err error
+		data, err = b.bucket.Read(ctx, name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	err := b.open(ctx, func(int) error {
+		var err error
+		r, err = b.bucket.NewReader(ctx, name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{ReadCloser: r, bucket: b}, nil
+}
+
+// Write retries writing the whole content, replacing whatever a failed attempt wrote.
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	var n int
+	err := b.do(ctx, func(int) error {
+		var err error
+		n, err = b.bucket.Write(ctx, name, data, opts...)
+
+		return err
+	})
+
+	return n, err
+}
+
+// NewWriter only retries opening the writer, the content can't be written again once it failed.
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	var w io.WriteCloser
+	err := b.open(ctx, func(int) error {
+		var err error
+		w, err = b.bucket.NewWriter(ctx, name, opts...)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &writer{WriteCloser: w, bucket: b}, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := b.do(ctx, func(int) error {
+		var err error
+		exists, err = b.bucket.Exists(ctx, name)
+
+		return err
+	})
+
+	return exists, err
+}
+
+// Remove succeeds when a retry finds the item missing, an attempt reported as failed might have
+// removed it.
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	return b.do(ctx, func(attempt int) error {
+		err := b.bucket.Remove(ctx, name)
+		if attempt > 1 && os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	})
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	var item bucketly.Item
+	err := b.do(ctx, func(int) error {
+		var err error
+		item, err = b.bucket.Stat(ctx, name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.do(ctx, func(int) error {
+		return b.bucket.Mkdir(ctx, name, opts...)
+	})
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	return b.do(ctx, func(int) error {
+		return b.bucket.MkdirAll(ctx, name, opts...)
+	})
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	return b.do(ctx, func(int) error {
+		return b.bucket.Chmod(ctx, name, mode)
+	})
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	return b.do(ctx, func(int) error {
+		return b.bucket.RemoveAll(ctx, name)
+	})
+}
+
+// Rename succeeds when a retry finds the source missing and the destination existing, an attempt
+// reported as failed might have renamed it.
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	return b.do(ctx, func(attempt int) error {
+		err := b.bucket.Rename(ctx, from, to, opts...)
+		if attempt == 1 || !os.IsNotExist(err) {
+			return err
+		}
+
+		exists, existsErr := b.bucket.Exists(ctx, to)
+		if existsErr != nil {
+			return existsErr
+		}
+
+		if exists {
+			return nil
+		}
+
+		return err
+	})
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if from.Bucket() == bucketly.Bucket(b) {
+		err := b.do(ctx, func(int) error {
+			item, err := b.bucket.Stat(ctx, from.Name())
+			if err == nil {
+				from = item
+			}
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.do(ctx, func(int) error {
+		return b.bucket.Copy(ctx, from, to, opts...)
+	})
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+// Walk is retried only until the first item is visited, the walk function isn't called twice for
+// the same item.
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	visited := false
+
+	return b.do(ctx, func(int) error {
+		err := w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+			visited = true
+			if item == nil {
+				return walkFunc(item, err)
+			}
+
+			return walkFunc(b.newItem(item), err)
+		})
+		if err != nil && visited {
+			return &permanentError{err: err}
+		}
+
+		return err
+	})
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	l, ok := b.bucket.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	var it bucketly.ListIterator
+	err := b.do(context.Background(), func(int) error {
+		var err error
+		it, err = l.Items(name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+// do calls the function until it succeeds, fails with an error which is not transient or runs out
+// of attempts. The function gets the number of the attempt, starting from 1.
+func (b *Bucket) do(ctx context.Context, fn func(attempt int) error) error {
+	return b.retry(ctx, fn, true)
+}
+
+// open retries opening a stream. Its success is only recorded by the circuit breaker once the stream
+// is closed without failing.
+func (b *Bucket) open(ctx context.Context, fn func(attempt int) error) error {
+	return b.retry(ctx, fn, false)
+}
+
+func (b *Bucket) retry(ctx context.Context, fn func(attempt int) error, recordSuccess bool) error {
+	for attempt := 1; ; attempt++ {
+		if err := b.breaker.allow(time.Now()); err != nil {
+			return err
+		}
+
+		err := fn(attempt)
+		if p, ok := err.(*permanentError); ok {
+			b.breaker.record(b.config.classifier(p.err), time.Now())
+
+			return p.err
+		}
+
+		transient := b.config.classifier(err)
+		if err != nil || recordSuccess {
+			b.breaker.record(transient, time.Now())
+		}
+		if !transient || attempt >= b.config.maxAttempts {
+			return err
+		}
+
+		t := time.NewTimer(b.delay(attempt))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+
+			return ctx.Err()
+		}
+	}
+}
+
+// report records the result of a stream in the circuit breaker, the streams are never retried.
+func (b *Bucket) report(err error) {
+	b.breaker.record(b.config.classifier(err), time.Now())
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// delay returns how long to wait after the failed attempt.
+func (b *Bucket) delay(attempt int) time.Duration {
+	cfg := b.config
+	d := float64(cfg.initialDelay) * math.Pow(cfg.multiplier, float64(attempt-1))
+	d = math.Min(d, float64(cfg.maxDelay))
+	d -= d * cfg.jitter * rand.Float64()
+
+	return time.Duration(d)
+}
+
+// newItem rebinds an item of the wrapped bucket.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	return bucketly.RebindItem(b, from.Name(), from)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.bucket.newItem(item), nil
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
@@ -0,0 +1,199 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/retry"
+	"google.golang.org/api/googleapi"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string {
+	return "temporary failure"
+}
+
+func (temporaryError) Temporary() bool {
+	return true
+}
+
+// flakyBucket fails the reads and the removals with a temporary error, the removals after removing
+// the item, while failures is greater than zero.
+type flakyBucket struct {
+	bucketly.Bucket
+	failures int32
+	calls    int32
+}
+
+func (b *flakyBucket) Read(ctx context.Context, name string) ([]byte, error) {
+	atomic.AddInt32(&b.calls, 1)
+	if atomic.AddInt32(&b.failures, -1) >= 0 {
+		return nil, temporaryError{}
+	}
+
+	return b.Bucket.Read(ctx, name)
+}
+
+func (b *flakyBucket) Remove(ctx context.Context, name string) error {
+	atomic.AddInt32(&b.calls, 1)
+	if err := b.Bucket.Remove(ctx, name); err != nil {
+		return err
+	}
+
+	if atomic.AddInt32(&b.failures, -1) >= 0 {
+		return temporaryError{}
+	}
+
+	return nil
+}
+
+// brokenBucket returns readers failing with a temporary error.
+type brokenBucket struct {
+	bucketly.Bucket
+}
+
+type brokenReader struct{}
+
+func (b *brokenBucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return brokenReader{}, nil
+}
+
+func (brokenReader) Read(p []byte) (int, error) {
+	return 0, temporaryError{}
+}
+
+func (brokenReader) Close() error {
+	return nil
+}
+
+func newBucket(t *testing.T, b bucketly.Bucket, opts ...retry.Option) *retry.Bucket {
+	opts = append([]retry.Option{retry.WithBackoff(time.Millisecond, 10*time.Millisecond)}, opts...)
+	bucket, err := retry.NewBucket(b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func TestBucket_Retry(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := &flakyBucket{Bucket: memory.NewBucket("parent"), failures: 2}
+	bucket := newBucket(t, parent)
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("foo"))
+	a.NoError(err)
+
+	content, err := bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("foo"), content)
+	}
+	a.Equal(int32(3), parent.calls)
+
+	parent.calls = 0
+	_, err = bucket.Read(ctx, "bar.txt")
+	a.True(os.IsNotExist(err))
+	a.Equal(int32(1), parent.calls)
+
+	parent.calls, parent.failures = 0, 5
+	_, err = bucket.Read(ctx, "foo.txt")
+	a.Equal(temporaryError{}, err)
+	a.Equal(int32(3), parent.calls)
+
+	parent.calls, parent.failures = 0, 1
+	a.NoError(bucket.Remove(ctx, "foo.txt"))
+	a.Equal(int32(2), parent.calls)
+
+	parent.calls, parent.failures = 0, 1
+	bucket = newBucket(t, parent, retry.WithClassifier(func(err error) bool {
+		return false
+	}))
+	_, err = bucket.Read(ctx, "foo.txt")
+	a.Equal(temporaryError{}, err)
+	a.Equal(int32(1), parent.calls)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	parent.calls, parent.failures = 0, 1
+	bucket = newBucket(t, parent, retry.WithBackoff(time.Hour, time.Hour))
+	_, err = bucket.Read(ctx, "foo.txt")
+	a.Equal(context.Canceled, err)
+}
+
+func TestBucket_CircuitBreaker(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := &flakyBucket{Bucket: memory.NewBucket("parent"), failures: 4}
+	bucket := newBucket(t, parent, retry.WithMaxAttempts(2), retry.WithCircuitBreaker(4, 50*time.Millisecond))
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("foo"))
+	a.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		_, err = bucket.Read(ctx, "foo.txt")
+		a.Equal(temporaryError{}, err)
+	}
+	a.True(bucket.CircuitOpen())
+
+	_, err = bucket.Read(ctx, "foo.txt")
+	a.True(errors.Is(err, retry.ErrCircuitOpen))
+	a.Equal(int32(4), parent.calls)
+
+	time.Sleep(60 * time.Millisecond)
+	a.False(bucket.CircuitOpen())
+
+	content, err := bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("foo"), content)
+	}
+	a.False(bucket.CircuitOpen())
+}
+
+func TestBucket_StreamCircuitBreaker(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, &brokenBucket{Bucket: memory.NewBucket("parent")}, retry.WithCircuitBreaker(2, time.Hour))
+
+	for i := 0; i < 2; i++ {
+		r, err := bucket.NewReader(ctx, "foo.txt")
+		if a.NoError(err) {
+			_, err = r.Read(make([]byte, 1))
+			a.Equal(temporaryError{}, err)
+			a.NoError(r.Close())
+		}
+	}
+	a.True(bucket.CircuitOpen())
+
+	_, err := bucket.NewReader(ctx, "foo.txt")
+	a.True(errors.Is(err, retry.ErrCircuitOpen))
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	a := assert.New(t)
+	a.True(retry.DefaultClassifier(temporaryError{}))
+	a.False(retry.DefaultClassifier(nil))
+	a.False(retry.DefaultClassifier(os.ErrNotExist))
+	a.False(retry.DefaultClassifier(context.Canceled))
+	a.False(retry.DefaultClassifier(errors.New("invalid name")))
+
+	slowDown := awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "id")
+	a.True(retry.DefaultClassifier(slowDown))
+	a.True(retry.DefaultClassifier(fmt.Errorf("write foo.txt: %w", slowDown)))
+	a.True(retry.DefaultClassifier(awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "id")))
+	a.False(retry.DefaultClassifier(awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, "id")))
+	a.True(retry.DefaultClassifier(&googleapi.Error{Code: 429}))
+	a.True(retry.DefaultClassifier(&googleapi.Error{Code: 502}))
+	a.False(retry.DefaultClassifier(&googleapi.Error{Code: 501}))
+	a.False(retry.DefaultClassifier(&googleapi.Error{Code: 412}))
+}
@@ -0,0 +1,135 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/vcraescu/bucketly"
+	"google.golang.org/api/googleapi"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// Classifier reports whether the error is transient, so the operation is worth retrying.
+type Classifier func(err error) bool
+
+// transientCodes are the error codes of the throttled or failed requests of the cloud storages.
+var transientCodes = map[string]bool{
+	"SlowDown":             true,
+	"Throttling":           true,
+	"ThrottlingException":  true,
+	"RequestLimitExceeded": true,
+	"RequestTimeout":       true,
+	"InternalError":        true,
+	"ServiceUnavailable":   true,
+	"ServerBusy":           true,
+	"OperationTimedOut":    true,
+}
+
+// DefaultClassifier retries the network timeouts, the temporary errors, the connections reset or
+// refused, the unexpected ends of the content and the requests of S3, GCS or Azure failing with a
+// server error or being throttled. Anything else, including the missing items and the denied
+// permissions, is returned as is.
+func DefaultClassifier(err error) bool {
+	if err == nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if os.IsNotExist(err) || os.IsExist(err) || os.IsPermission(err) {
+		return false
+	}
+
+	if errors.Is(err, bucketly.ErrNotSupported) || errors.Is(err, bucketly.ErrSkipWalkDir) || errors.Is(err, bucketly.ErrStopWalk) {
+		return false
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	if code, ok := errorCode(err); ok && transientCodes[code] {
+		return true
+	}
+
+	if status, ok := statusCode(err); ok {
+		return isTransientStatus(status)
+	}
+
+	// the network errors of the S3 requests are wrapped without being unwrappable
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.OrigErr() != nil && DefaultClassifier(awsErr.OrigErr()) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || netErr.Temporary()
+	}
+
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		return temporary.Temporary()
+	}
+
+	return false
+}
+
+// statusCode returns the HTTP status code of a failed request of S3, GCS or Azure.
+func statusCode(err error) (int, bool) {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode(), true
+	}
+
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return gErr.Code, true
+	}
+
+	var sErr azblob.StorageError
+	if errors.As(err, &sErr) && sErr.Response() != nil {
+		return sErr.Response().StatusCode, true
+	}
+
+	return 0, false
+}
+
+// errorCode returns the code of a failed request of S3 or Azure.
+func errorCode(err error) (string, bool) {
+	var sErr azblob.StorageError
+	if errors.As(err, &sErr) {
+		return string(sErr.ServiceCode()), true
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code(), true
+	}
+
+	return "", false
+}
+
+// isTransientStatus reports whether the request is worth retrying: it timed out, was throttled or
+// failed on the server side, unless the server doesn't implement it.
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+
+	return status >= http.StatusInternalServerError
+}
@@ -0,0 +1,61 @@
+package retry
+
+import (
+	"io"
+)
+
+type (
+	// reader reports the errors of the content read to the circuit breaker, without retrying them.
+	reader struct {
+		io.ReadCloser
+		bucket *Bucket
+		failed bool
+	}
+
+	// writer reports the errors of the content written to the circuit breaker, without retrying them.
+	writer struct {
+		io.WriteCloser
+		bucket *Bucket
+		failed bool
+	}
+)
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		r.failed = true
+		r.bucket.report(err)
+	}
+
+	return n, err
+}
+
+// Close records the success of the stream once all its content went through without failing.
+func (r *reader) Close() error {
+	err := r.ReadCloser.Close()
+	if err != nil || !r.failed {
+		r.bucket.report(err)
+	}
+
+	return err
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	if err != nil {
+		w.failed = true
+		w.bucket.report(err)
+	}
+
+	return n, err
+}
+
+// Close records the success of the stream once all its content went through without failing.
+func (w *writer) Close() error {
+	err := w.WriteCloser.Close()
+	if err != nil || !w.failed {
+		w.bucket.report(err)
+	}
+
+	return err
+}
@@ -514,6 +514,10 @@ func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts .
 		opt(cfg)
 	}
 
+	if _, ok := from.Bucket().(*Bucket); !ok {
+		return b.copyFrom(ctx, from, to, cfg.Metadata)
+	}
+
 	src := bucketly.Join(b, from.Bucket().Name(), from.Name())
 	if strings.HasSuffix(from.Name(), string(b.PathSeparator())) {
 		src += string(b.PathSeparator())
@@ -526,6 +530,11 @@ func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts .
 		Metadata:   aws.StringMap(cfg.Metadata),
 	}
 
+	// the metadata of the source is kept unless replaced, which also allows to copy an object onto itself
+	if cfg.Metadata != nil {
+		input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	}
+
 	_, err := b.client.CopyObjectWithContext(ctx, input)
 	if err != nil {
 		return err
@@ -550,6 +559,45 @@ func (b *Bucket) WaitUntilNotExists(ctx context.Context, name string) error {
 	return waitUntilKeyNotExists(ctx, b.client, b.name, name)
 }
 
+// copyFrom streams an item of a bucket living outside of S3, where no server side copy is possible.
+func (b *Bucket) copyFrom(ctx context.Context, from bucketly.Item, to string, metadata bucketly.Metadata) error {
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.MkdirAll(ctx, to)
+	}
+
+	if metadata == nil {
+		var err error
+		metadata, err = from.Metadata()
+		if err != nil {
+			return err
+		}
+	}
+
+	r, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// canceling the context aborts the upload instead of committing a partial object
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w, err := b.NewWriter(ctx, to, bucketly.WithWriteMetadata(metadata))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		w.Close()
+
+		return err
+	}
+
+	return w.Close()
+}
+
 func (b *Bucket) openBucket(ctx context.Context) (*blob.Bucket, error) {
 	bucket, err := s3blob.OpenBucket(ctx, b.session, b.name, nil)
 	if err != nil {
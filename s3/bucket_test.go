@@ -0,0 +1,139 @@
+package s3_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/s3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeObject struct {
+	data     []byte
+	metadata map[string]string
+}
+
+// fakeS3 serves the object requests of a single path style bucket.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		w.WriteHeader(http.StatusNotImplemented)
+
+		return
+	}
+
+	key := parts[1]
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		metadata := make(map[string]string)
+		for k, v := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+				metadata[strings.ToLower(k[len("x-amz-meta-"):])] = v[0]
+			}
+		}
+
+		f.objects[key] = fakeObject{data: data, metadata: metadata}
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, len(data)))
+	case http.MethodHead, http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj.data)))
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, len(obj.data)))
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestBucket_CopyFrom(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	fake := &fakeS3{objects: make(map[string]fakeObject)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := s3.NewBucket("bucket", s3.WithSession(sess))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := memory.NewBucket("src")
+	_, err = src.Write(ctx, "foo.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"owner": "me"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Mkdir(ctx, "dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := src.Stat(ctx, "foo.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	// the item of another bucket is streamed with its metadata
+	a.NoError(bucket.Copy(ctx, item, "bar/foo.txt"))
+
+	a.NoError(bucket.Copy(ctx, item, "baz.txt", bucketly.WithCopyMetadata(bucketly.Metadata{"owner": "you"})))
+
+	// the directories are created instead of streamed
+	dir, err := src.Stat(ctx, "dir")
+	if a.NoError(err) {
+		a.NoError(bucket.Copy(ctx, dir, "dir"))
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	obj, ok := fake.objects["bar/foo.txt"]
+	if a.True(ok) {
+		a.Equal([]byte("12345"), obj.data)
+		a.Equal("me", obj.metadata["owner"])
+	}
+
+	obj, ok = fake.objects["baz.txt"]
+	if a.True(ok) {
+		a.Equal("you", obj.metadata["owner"])
+	}
+
+	_, ok = fake.objects["dir/"]
+	a.True(ok)
+}
@@ -0,0 +1,726 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"github.com/vcraescu/bucketly"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pathSeparator  rune = '/'
+	defaultTimeout      = 30 * time.Second
+)
+
+type (
+	Bucket struct {
+		name      string
+		config    Config
+		mu        sync.Mutex
+		sshClient *ssh.Client
+		client    *sftp.Client
+	}
+
+	Config struct {
+		addr            string
+		user            string
+		password        string
+		signers         []ssh.Signer
+		agent           agent.Agent
+		agentSocket     string
+		hostKeyCallback ssh.HostKeyCallback
+		timeout         time.Duration
+		sshClient       *ssh.Client
+		err             error
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+)
+
+func WithAddress(addr string) Option {
+	return func(cfg *Config) {
+		cfg.addr = addr
+	}
+}
+
+func WithUser(user string) Option {
+	return func(cfg *Config) {
+		cfg.user = user
+	}
+}
+
+func WithPassword(password string) Option {
+	return func(cfg *Config) {
+		cfg.password = password
+	}
+}
+
+func WithPrivateKey(pemBytes []byte) Option {
+	return func(cfg *Config) {
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			cfg.err = fmt.Errorf("error parsing private key: %w", err)
+
+			return
+		}
+
+		cfg.signers = append(cfg.signers, signer)
+	}
+}
+
+func WithEncryptedPrivateKey(pemBytes []byte, passphrase []byte) Option {
+	return func(cfg *Config) {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(pemBytes, passphrase)
+		if err != nil {
+			cfg.err = fmt.Errorf("error parsing private key: %w", err)
+
+			return
+		}
+
+		cfg.signers = append(cfg.signers, signer)
+	}
+}
+
+func WithSigner(signer ssh.Signer) Option {
+	return func(cfg *Config) {
+		cfg.signers = append(cfg.signers, signer)
+	}
+}
+
+func WithAgent(a agent.Agent) Option {
+	return func(cfg *Config) {
+		cfg.agent = a
+	}
+}
+
+// WithAgentSocket authenticates using the keys of the ssh-agent listening on the given unix
+// socket, usually the value of SSH_AUTH_SOCK.
+func WithAgentSocket(socket string) Option {
+	return func(cfg *Config) {
+		cfg.agentSocket = socket
+	}
+}
+
+func WithHostKeyCallback(callback ssh.HostKeyCallback) Option {
+	return func(cfg *Config) {
+		cfg.hostKeyCallback = callback
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.timeout = timeout
+	}
+}
+
+func WithSSHClient(client *ssh.Client) Option {
+	return func(cfg *Config) {
+		cfg.sshClient = client
+	}
+}
+
+func NewBucket(name string, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+
+	if cfg.sshClient == nil {
+		if cfg.addr == "" {
+			return nil, errors.New("sftp server address is missing")
+		}
+
+		if cfg.hostKeyCallback == nil {
+			return nil, errors.New("host key callback is missing")
+		}
+	}
+
+	return &Bucket{
+		name:      name,
+		config:    cfg,
+		sshClient: cfg.sshClient,
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+// StoresMetadata reports false, the metadata of the items is not kept.
+func (b *Bucket) StoresMetadata() bool {
+	return false
+}
+
+func (b *Bucket) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client == nil {
+		return nil
+	}
+
+	err := b.client.Close()
+	b.client = nil
+
+	if b.config.sshClient == nil && b.sshClient != nil {
+		b.sshClient.Close()
+		b.sshClient = nil
+	}
+
+	return err
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Open(b.realPath(name))
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, name)); err != nil {
+		return 0, err
+	}
+
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.Close()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := client.OpenFile(b.realPath(name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+
+	if wo.Mode != 0 {
+		if err := f.Chmod(wo.Mode); err != nil {
+			f.Close()
+
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.Remove(b.realPath(name))
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := client.Stat(b.realPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return b.fileInfoToItem(name, fi), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	p := b.realPath(name)
+	fi, err := client.Stat(p)
+	if err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", name)
+		}
+	} else {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := client.Mkdir(p); err != nil {
+			if fi, err2 := client.Stat(p); err2 != nil || !fi.IsDir() {
+				return err
+			}
+		}
+	}
+
+	if wo.Mode != 0 {
+		return client.Chmod(p, wo.Mode)
+	}
+
+	return nil
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	p := b.realPath(name)
+	if err := client.MkdirAll(p); err != nil {
+		return err
+	}
+
+	if wo.Mode != 0 {
+		return client.Chmod(p, wo.Mode)
+	}
+
+	return nil
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.Chmod(b.realPath(name), mode)
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if name == string(b.PathSeparator()) {
+		return removeDirContents(client, b.realPath(name))
+	}
+
+	return removeAll(client, b.realPath(name))
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, _ ...bucketly.CopyOption) error {
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, strings.TrimRight(to, string(b.PathSeparator())))); err != nil {
+		return err
+	}
+
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.Rename(b.realPath(from), b.realPath(to))
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{
+		Mode: from.Mode().Perm(),
+	}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.MkdirAll(ctx, to, bucketly.WithWriteMode(co.Mode))
+	}
+
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, to)); err != nil {
+		return err
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := b.NewWriter(ctx, to, bucketly.WithWriteMode(co.Mode))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, strings.TrimRight(to, string(b.PathSeparator())))); err != nil {
+		return err
+	}
+
+	toItem := bucketly.NewItem(b, to)
+	toItem.SetMode(from.Mode())
+
+	return bucketly.CopyAll(ctx, from, toItem, opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	items, err := b.readDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) readDir(ctx context.Context, dir string) ([]bucketly.Item, error) {
+	client, err := b.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := client.ReadDir(b.realPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	items := make([]bucketly.Item, 0, len(infos))
+	for _, info := range infos {
+		name := strings.TrimLeft(bucketly.Join(b, dir, info.Name()), string(b.PathSeparator()))
+		items = append(items, b.fileInfoToItem(name, info))
+	}
+
+	return items, nil
+}
+
+func (b *Bucket) getClient(ctx context.Context) (*sftp.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	if b.sshClient == nil {
+		sshClient, err := b.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		b.sshClient = sshClient
+	}
+
+	client, err := sftp.NewClient(b.sshClient)
+	if err != nil {
+		return nil, err
+	}
+
+	b.client = client
+
+	// drop the cached clients when the connection goes away so the next call can reconnect
+	sshClient := b.sshClient
+	go func() {
+		sshClient.Wait()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.client == client {
+			b.client = nil
+		}
+
+		if b.config.sshClient == nil && b.sshClient == sshClient {
+			b.sshClient = nil
+		}
+	}()
+
+	return client, nil
+}
+
+func (b *Bucket) dial(ctx context.Context) (*ssh.Client, error) {
+	auths, closeAgent, err := b.authMethods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the agent is only needed for the handshake
+	defer closeAgent()
+
+	dialer := net.Dialer{Timeout: b.config.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", b.config.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, b.config.addr, &ssh.ClientConfig{
+		User:            b.config.user,
+		Auth:            auths,
+		HostKeyCallback: b.config.hostKeyCallback,
+		Timeout:         b.config.timeout,
+	})
+	if err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// authMethods returns the auth methods and a function closing the connection to the agent socket,
+// if one was opened.
+func (b *Bucket) authMethods(ctx context.Context) ([]ssh.AuthMethod, func(), error) {
+	var auths []ssh.AuthMethod
+	if len(b.config.signers) > 0 {
+		auths = append(auths, ssh.PublicKeys(b.config.signers...))
+	}
+
+	closeAgent := func() {}
+	a := b.config.agent
+	if a == nil && b.config.agentSocket != "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", b.config.agentSocket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error connecting to ssh agent: %w", err)
+		}
+
+		a = agent.NewClient(conn)
+		closeAgent = func() {
+			conn.Close()
+		}
+	}
+
+	if a != nil {
+		auths = append(auths, ssh.PublicKeysCallback(a.Signers))
+	}
+
+	if b.config.password != "" {
+		auths = append(auths, ssh.Password(b.config.password))
+	}
+
+	return auths, closeAgent, nil
+}
+
+func (b *Bucket) realPath(name string) string {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return ""
+	}
+
+	return bucketly.Join(b, b.name, name)
+}
+
+func (b *Bucket) fileInfoToItem(name string, info os.FileInfo) bucketly.Item {
+	item := bucketly.NewItem(b, name)
+	item.SetMode(info.Mode())
+	item.SetModeTime(info.ModTime())
+	item.SetDir(info.IsDir())
+	item.SetSize(info.Size())
+	item.SetSys(info.Sys())
+
+	return item
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		i.queue, err = i.bucket.readDir(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package sftp_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly/internal/sftptest"
+	"github.com/vcraescu/bucketly/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBucket_Auth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	server := sftptest.NewServer("bucketly", "secret", signer.PublicKey())
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "bucketly-sftp-auth-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		opt  sftp.Option
+		err  bool
+	}{
+		{
+			name: "password",
+			opt:  sftp.WithPassword("secret"),
+		},
+		{
+			name: "wrong password",
+			opt:  sftp.WithPassword("wrong"),
+			err:  true,
+		},
+		{
+			name: "private key",
+			opt:  sftp.WithPrivateKey(pemBytes),
+		},
+		{
+			name: "agent",
+			opt:  sftp.WithAgent(keyring),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := assert.New(t)
+			bucket, err := sftp.NewBucket(
+				dir,
+				sftp.WithAddress(server.Addr),
+				sftp.WithUser("bucketly"),
+				sftp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey)),
+				test.opt,
+			)
+			if !a.NoError(err) {
+				return
+			}
+			defer bucket.Close()
+
+			ctx := context.Background()
+			_, err = bucket.Write(ctx, test.name+".txt", []byte("12345"))
+			if test.err {
+				a.Error(err)
+
+				return
+			}
+
+			if !a.NoError(err) {
+				return
+			}
+
+			content, err := bucket.Read(ctx, test.name+".txt")
+			if a.NoError(err) {
+				a.Equal([]byte("12345"), content)
+			}
+		})
+	}
+}
+
+func TestNewBucket_MissingHostKeyCallback(t *testing.T) {
+	_, err := sftp.NewBucket("/tmp", sftp.WithAddress("127.0.0.1:22"))
+	assert.Error(t, err)
+}
+
+func TestBucket_AgentSocket(t *testing.T) {
+	a := assert.New(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "bucketly-sftp-agent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var open int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			atomic.AddInt32(&open, 1)
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+				atomic.AddInt32(&open, -1)
+			}()
+		}
+	}()
+
+	server := sftptest.NewServer("bucketly", "secret", signer.PublicKey())
+	defer server.Close()
+
+	bucket, err := sftp.NewBucket(
+		dir,
+		sftp.WithAddress(server.Addr),
+		sftp.WithUser("bucketly"),
+		sftp.WithHostKeyCallback(ssh.FixedHostKey(server.HostKey)),
+		sftp.WithAgentSocket(socket),
+	)
+	if !a.NoError(err) {
+		return
+	}
+	defer bucket.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err = bucket.Write(ctx, "foo.txt", []byte("12345"))
+		a.NoError(err)
+		a.NoError(bucket.Close())
+	}
+
+	// the agent connections are closed once the handshakes are done
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&open) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.Equal(int32(0), atomic.LoadInt32(&open))
+}
@@ -0,0 +1,37 @@
+package sftp
+
+import (
+	"context"
+)
+
+type (
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+func (m *BucketManager) Create(ctx context.Context) error {
+	client, err := m.bucket.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.MkdirAll(m.bucket.Name())
+}
+
+func (m *BucketManager) Remove(ctx context.Context) error {
+	client, err := m.bucket.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return removeAll(client, m.bucket.Name())
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, string(m.bucket.PathSeparator()))
+}
@@ -0,0 +1,47 @@
+package sftp
+
+import (
+	"github.com/pkg/sftp"
+	"os"
+	"path"
+)
+
+func removeAll(client *sftp.Client, p string) error {
+	fi, err := client.Lstat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !fi.IsDir() {
+		return client.Remove(p)
+	}
+
+	if err := removeDirContents(client, p); err != nil {
+		return err
+	}
+
+	return client.RemoveDirectory(p)
+}
+
+func removeDirContents(client *sftp.Client, p string) error {
+	infos, err := client.ReadDir(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, info := range infos {
+		if err := removeAll(client, path.Join(p, info.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,675 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"os"
+	"strings"
+)
+
+const defaultVirtualNodes = 128
+
+type (
+	// Bucket spreads the items over several shards. Every file is stored on the shard its name is
+	// routed to by consistent hashing, so adding or removing a shard only moves a fraction of them.
+	// Directories are created on every shard and listings merge the content of all of them, which
+	// the shards must list sorted by name. Until Rebalance moves them, the files written before the
+	// shards changed are found on the shard they were written to.
+	Bucket struct {
+		shards []bucketly.Bucket
+		ring   *ring
+		config Config
+	}
+
+	Config struct {
+		name         string
+		virtualNodes int
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		bucket *Bucket
+		name   string
+		merged *mergeIterator
+		done   bool
+	}
+
+	// mergeIterator merges the sorted listings of a directory on the shards. A directory found on
+	// several shards is returned once.
+	mergeIterator struct {
+		bucket *Bucket
+		its    []bucketly.ListIterator
+		heads  []bucketly.Item
+		last   string
+	}
+)
+
+// WithName sets the name of the bucket, the name of the first shard by default.
+func WithName(name string) Option {
+	return func(cfg *Config) {
+		cfg.name = name
+	}
+}
+
+// WithVirtualNodes sets the number of points of every shard on the hash ring. More points spread
+// the items more evenly.
+func WithVirtualNodes(n int) Option {
+	return func(cfg *Config) {
+		cfg.virtualNodes = n
+	}
+}
+
+// NewBucket returns a bucket sharded over the buckets. The shards are identified on the hash ring by
+// their names, which must be unique and stay the same for the items to be found again.
+func NewBucket(shards []bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		virtualNodes: defaultVirtualNodes,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if len(shards) == 0 {
+		return nil, errors.New("no shards")
+	}
+
+	if cfg.virtualNodes <= 0 {
+		return nil, fmt.Errorf("invalid number of virtual nodes %d", cfg.virtualNodes)
+	}
+
+	names := make(map[string]bool)
+	for _, shard := range shards {
+		if names[shard.Name()] {
+			return nil, fmt.Errorf("duplicate shard %s", shard.Name())
+		}
+
+		names[shard.Name()] = true
+	}
+
+	if cfg.name == "" {
+		cfg.name = shards[0].Name()
+	}
+
+	return &Bucket{
+		shards: append([]bucketly.Bucket(nil), shards...),
+		ring:   newRing(shards, cfg.virtualNodes),
+		config: cfg,
+	}, nil
+}
+
+func (b *Bucket) Shards() []bucketly.Bucket {
+	return append([]bucketly.Bucket(nil), b.shards...)
+}
+
+// StoresMetadata reports whether every shard keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	for _, shard := range b.shards {
+		if !bucketly.StoresMetadata(shard) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Shard returns the shard the name is routed to.
+func (b *Bucket) Shard(name string) (bucketly.Bucket, error) {
+	key, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.ring.get(key), nil
+}
+
+func (b *Bucket) Name() string {
+	return b.config.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.shards[0].PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	shard, _, err := b.locate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.Read(ctx, name)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	shard, _, err := b.locate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.NewReader(ctx, name)
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	shard, err := b.Shard(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return shard.Write(ctx, name, data, opts...)
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	shard, err := b.Shard(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return shard.NewWriter(ctx, name, opts...)
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Remove removes the file, or the empty directory, from every shard having it, so a copy left on
+// an old shard doesn't show up again.
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	return b.each(ctx, name, func(shard bucketly.Bucket) error {
+		return shard.Remove(ctx, name)
+	})
+}
+
+// Stat returns the file from its shard. A directory is looked up on every shard.
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	_, item, err := b.locate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item.Name(), item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	key, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	if parent := bucketly.Dir(b, key); parent != "" {
+		item, err := b.Stat(ctx, parent)
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			return fmt.Errorf("%s is not a directory", parent)
+		}
+	}
+
+	return b.MkdirAll(ctx, name, opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	for _, shard := range b.shards {
+		if err := shard.MkdirAll(ctx, name, opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	shard, item, err := b.locate(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if !item.IsDir() {
+		return shard.Chmod(ctx, name, mode)
+	}
+
+	return b.each(ctx, name, func(shard bucketly.Bucket) error {
+		return shard.Chmod(ctx, name, mode)
+	})
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	for _, shard := range b.shards {
+		if err := shard.RemoveAll(ctx, name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rename moves the file to the shard of the new name. A directory is renamed on every shard and its
+// files are moved to their new shards.
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	src, item, err := b.locate(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	if !item.IsDir() {
+		dest, err := b.Shard(to)
+		if err != nil {
+			return err
+		}
+
+		if src == dest {
+			return src.Rename(ctx, from, to, opts...)
+		}
+
+		return move(ctx, src, dest, from, to, opts...)
+	}
+
+	var shards []bucketly.Bucket
+	err = b.each(ctx, from, func(shard bucketly.Bucket) error {
+		shards = append(shards, shard)
+
+		return shard.Rename(ctx, from, to, opts...)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = b.rebalance(ctx, to, shards)
+
+	return err
+}
+
+// Copy copies the item to the shard of the new name. A directory is created on every shard.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		co := &bucketly.CopyOptions{
+			Mode: from.Mode().Perm(),
+		}
+		for _, opt := range opts {
+			opt(co)
+		}
+
+		var writeOpts []bucketly.WriteOption
+		if co.Mode != 0 {
+			writeOpts = append(writeOpts, bucketly.WithWriteMode(co.Mode))
+		}
+
+		return b.MkdirAll(ctx, to, writeOpts...)
+	}
+
+	dest, err := b.Shard(to)
+	if err != nil {
+		return err
+	}
+
+	if from.Bucket() == bucketly.Bucket(b) {
+		src, _, err := b.locate(ctx, from.Name())
+		if err != nil {
+			return err
+		}
+
+		from = bucketly.RebindItem(src, from.Name(), from)
+	}
+
+	return dest.Copy(ctx, from, to, opts...)
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+// Walk walks the merged content of the shards, the items of a directory are sorted by name.
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+// Items lists the merged content of the directory on the shards, sorted by name.
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	if _, err := bucketly.Sanitize(b, name); err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		name:   name,
+	}, nil
+}
+
+// Rebalance moves the files which are not stored on the shard their names are routed to, e.g. after
+// a shard was added. The files of removed shards are moved too when the shards are passed. A file
+// already found on its shard was written after the shards changed, so the old copy is removed
+// instead of replacing it. It returns the number of moved files.
+func (b *Bucket) Rebalance(ctx context.Context, removed ...bucketly.Bucket) (int, error) {
+	return b.rebalance(ctx, "/", append(b.Shards(), removed...))
+}
+
+func (b *Bucket) rebalance(ctx context.Context, dir string, shards []bucketly.Bucket) (int, error) {
+	moved := 0
+	for _, shard := range shards {
+		w, ok := shard.(bucketly.Walkable)
+		if !ok {
+			return moved, bucketly.ErrNotSupported
+		}
+
+		var names []string
+		err := w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !item.IsDir() {
+				names = append(names, item.Name())
+			}
+
+			return nil
+		})
+		if err != nil {
+			return moved, err
+		}
+
+		for _, name := range names {
+			dest, err := b.Shard(name)
+			if err != nil {
+				return moved, err
+			}
+
+			if dest == shard {
+				continue
+			}
+
+			exists, err := dest.Exists(ctx, name)
+			if err != nil {
+				return moved, err
+			}
+
+			if exists {
+				if err := shard.Remove(ctx, name); err != nil {
+					return moved, err
+				}
+
+				continue
+			}
+
+			if err := move(ctx, shard, dest, name, name); err != nil {
+				return moved, err
+			}
+
+			moved++
+		}
+	}
+
+	return moved, nil
+}
+
+// each runs the function on the shards having the item, it fails when none has it.
+func (b *Bucket) each(ctx context.Context, name string, fn func(shard bucketly.Bucket) error) error {
+	found := false
+	for _, shard := range b.shards {
+		exists, err := shard.Exists(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			continue
+		}
+
+		found = true
+		if err := fn(shard); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return os.ErrNotExist
+	}
+
+	return nil
+}
+
+// locate returns the shard holding the item and the item. A file is looked up on the shard its
+// name is routed to first, then on the others in case it was not rebalanced yet. A directory is
+// returned from the first shard having it.
+func (b *Bucket) locate(ctx context.Context, name string) (bucketly.Bucket, bucketly.Item, error) {
+	shard, err := b.Shard(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	item, err := shard.Stat(ctx, name)
+	if err == nil {
+		return shard, item, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	for _, s := range b.shards {
+		if s == shard {
+			continue
+		}
+
+		item, err := s.Stat(ctx, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, nil, err
+		}
+
+		return s, item, nil
+	}
+
+	return nil, nil, os.ErrNotExist
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	it, err := b.readDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for {
+		item, err := it.Next(ctx)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+}
+
+// readDir returns an iterator merging the content of the directory on the shards.
+func (b *Bucket) readDir(ctx context.Context, dir string) (*mergeIterator, error) {
+	m := &mergeIterator{
+		bucket: b,
+		heads:  make([]bucketly.Item, len(b.shards)),
+	}
+
+	for _, shard := range b.shards {
+		it, err := openDir(ctx, shard, dir)
+		if err != nil {
+			m.Close()
+
+			return nil, err
+		}
+
+		m.its = append(m.its, it)
+	}
+
+	return m, nil
+}
+
+func (b *Bucket) newItem(name string, from bucketly.Item) bucketly.Item {
+	return bucketly.RebindItem(b, name, from)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.done {
+		return nil, io.EOF
+	}
+
+	if i.merged == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.done = true
+
+			return item, nil
+		}
+
+		i.merged, err = i.bucket.readDir(ctx, item.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return i.merged.Next(ctx)
+}
+
+func (i *listIterator) Close() error {
+	i.done = true
+	if i.merged == nil {
+		return nil
+	}
+
+	return i.merged.Close()
+}
+
+// Next returns the item with the lowest name among the next items of the shards.
+func (m *mergeIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	sep := string(m.bucket.PathSeparator())
+	for {
+		min := -1
+		for i, it := range m.its {
+			if m.heads[i] == nil && it != nil {
+				item, err := it.Next(ctx)
+				if err != nil && err != io.EOF && !os.IsNotExist(err) {
+					return nil, err
+				}
+
+				if err != nil {
+					it.Close()
+					m.its[i] = nil
+
+					continue
+				}
+
+				m.heads[i] = item
+			}
+
+			if m.heads[i] != nil && (min < 0 || m.key(m.heads[i], sep) < m.key(m.heads[min], sep)) {
+				min = i
+			}
+		}
+
+		if min < 0 {
+			return nil, io.EOF
+		}
+
+		item := m.heads[min]
+		m.heads[min] = nil
+
+		key := m.key(item, sep)
+		if key == m.last {
+			continue
+		}
+		m.last = key
+
+		return m.bucket.newItem(item.Name(), item), nil
+	}
+}
+
+func (m *mergeIterator) Close() error {
+	var err error
+	for i, it := range m.its {
+		if it == nil {
+			continue
+		}
+
+		if cerr := it.Close(); err == nil {
+			err = cerr
+		}
+		m.its[i] = nil
+	}
+
+	return err
+}
+
+func (m *mergeIterator) key(item bucketly.Item, sep string) string {
+	return strings.TrimSuffix(item.Name(), sep)
+}
@@ -0,0 +1,355 @@
+package shard_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/shard"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+)
+
+func newShards(names ...string) []bucketly.Bucket {
+	var shards []bucketly.Bucket
+	for _, name := range names {
+		shards = append(shards, memory.NewBucket(name))
+	}
+
+	return shards
+}
+
+func newLocalShards(t *testing.T, n int) []bucketly.Bucket {
+	var shards []bucketly.Bucket
+	for i := 0; i < n; i++ {
+		dir, err := ioutil.TempDir("", "bucketly-shard")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() {
+			os.RemoveAll(dir)
+		})
+
+		shards = append(shards, local.NewBucket(dir))
+	}
+
+	return shards
+}
+
+func newBucket(t *testing.T, shards []bucketly.Bucket, opts ...shard.Option) *shard.Bucket {
+	bucket, err := shard.NewBucket(shards, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func write(t *testing.T, bucket bucketly.Bucket, names ...string) {
+	for _, name := range names {
+		if _, err := bucket.Write(context.Background(), name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func fileNames(t *testing.T, bucket bucketly.Walkable) []string {
+	var names []string
+	err := bucket.Walk(context.Background(), "/", func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			names = append(names, item.Name())
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return names
+}
+
+func TestBucket_Routing(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	shards := newShards("a", "b", "c")
+	bucket := newBucket(t, shards)
+
+	var names []string
+	for i := 0; i < 300; i++ {
+		names = append(names, fmt.Sprintf("logs/%03d.txt", i))
+	}
+	write(t, bucket, names...)
+
+	total := 0
+	for _, s := range shards {
+		count := len(fileNames(t, s.(bucketly.Walkable)))
+		a.Greater(count, 50, s.Name())
+		total += count
+	}
+	a.Equal(len(names), total)
+
+	for _, name := range names {
+		content, err := bucket.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte(name), content)
+		}
+	}
+
+	a.Equal(names, fileNames(t, bucket))
+}
+
+func TestBucket_Items(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, newShards("a", "b", "c"))
+	write(t, bucket, "foo/c.txt", "foo/a.txt", "foo/b/d.txt", "foo/b/e.txt", "bar.txt")
+	a.NoError(bucket.Mkdir(ctx, "foo/empty"))
+
+	it, err := bucket.Items("foo")
+	if !a.NoError(err) {
+		return
+	}
+	defer it.Close()
+
+	var names []string
+	for {
+		item, err := it.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		if !a.NoError(err) {
+			return
+		}
+
+		a.Equal(bucket, item.Bucket())
+		names = append(names, item.Name())
+	}
+
+	a.True(sort.StringsAreSorted(names))
+	a.Len(names, 4)
+}
+
+func TestBucket_Rename(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, newShards("a", "b", "c"))
+
+	var names []string
+	for i := 0; i < 20; i++ {
+		names = append(names, fmt.Sprintf("foo/%02d.txt", i))
+	}
+	write(t, bucket, names...)
+
+	a.NoError(bucket.Rename(ctx, "foo", "bar"))
+	a.NoError(bucket.Rename(ctx, "bar/00.txt", "baz.txt"))
+
+	content, err := bucket.Read(ctx, "baz.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("foo/00.txt"), content)
+	}
+
+	for _, name := range names[1:] {
+		_, err := bucket.Read(ctx, "bar"+name[len("foo"):])
+		a.NoError(err, name)
+	}
+
+	exists, err := bucket.Exists(ctx, "foo")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+}
+
+func TestBucket_Rebalance(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	shards := newShards("a", "b", "c")
+	bucket := newBucket(t, shards)
+
+	var names []string
+	for i := 0; i < 200; i++ {
+		names = append(names, fmt.Sprintf("%03d.txt", i))
+	}
+	write(t, bucket, names...)
+
+	grown := newBucket(t, append(shards, memory.NewBucket("d")))
+	moved, err := grown.Rebalance(ctx)
+	if a.NoError(err) {
+		a.Greater(moved, 0)
+		a.Less(moved, 100)
+	}
+
+	moved, err = grown.Rebalance(ctx)
+	if a.NoError(err) {
+		a.Equal(0, moved)
+	}
+
+	shrunk := newBucket(t, grown.Shards()[1:])
+	moved, err = shrunk.Rebalance(ctx, grown.Shards()[0])
+	if a.NoError(err) {
+		a.Greater(moved, 0)
+	}
+
+	a.Empty(fileNames(t, grown.Shards()[0].(bucketly.Walkable)))
+	for _, name := range names {
+		content, err := shrunk.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte(name), content)
+		}
+	}
+}
+
+func TestBucket_RebalanceRewritten(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	shards := newShards("a", "b", "c")
+	bucket := newBucket(t, shards)
+
+	var names []string
+	for i := 0; i < 50; i++ {
+		names = append(names, fmt.Sprintf("%03d.txt", i))
+	}
+	write(t, bucket, names...)
+
+	// the files routed to the new shard are rewritten there before the rebalancing
+	added := memory.NewBucket("d")
+	grown := newBucket(t, append(shards, added))
+	var rewritten []string
+	for _, name := range names {
+		if dest, err := grown.Shard(name); err == nil && dest == bucketly.Bucket(added) {
+			_, err := grown.Write(ctx, name, []byte("new"))
+			a.NoError(err)
+			rewritten = append(rewritten, name)
+		}
+	}
+	if !a.NotEmpty(rewritten) {
+		return
+	}
+
+	moved, err := grown.Rebalance(ctx)
+	if a.NoError(err) {
+		a.Equal(0, moved)
+	}
+
+	for _, name := range rewritten {
+		content, err := grown.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte("new"), content, name)
+		}
+	}
+
+	a.Len(fileNames(t, added), len(rewritten))
+	a.Len(fileNames(t, grown), len(names))
+}
+
+func TestBucket_RemoveOldCopy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	shards := newShards("a", "b", "c")
+	bucket := newBucket(t, shards)
+
+	var names []string
+	for i := 0; i < 50; i++ {
+		names = append(names, fmt.Sprintf("%03d.txt", i))
+	}
+	write(t, bucket, names...)
+
+	// the files routed to the new shard are on both the old and the new shard
+	added := memory.NewBucket("d")
+	grown := newBucket(t, append(shards, added))
+	for _, name := range names {
+		if dest, err := grown.Shard(name); err == nil && dest == bucketly.Bucket(added) {
+			write(t, grown, name)
+		}
+	}
+
+	for _, name := range names {
+		a.NoError(grown.Remove(ctx, name), name)
+
+		exists, err := grown.Exists(ctx, name)
+		if a.NoError(err, name) {
+			a.False(exists, name)
+		}
+	}
+}
+
+func TestBucket_Local(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	shards := newLocalShards(t, 4)
+	bucket := newBucket(t, shards[:3], shard.WithName("local"))
+
+	var names []string
+	for i := 0; i < 30; i++ {
+		names = append(names, fmt.Sprintf("foo/%02d.txt", i))
+	}
+	write(t, bucket, names...)
+
+	a.NoError(bucket.Rename(ctx, "foo", "bar"))
+
+	grown := newBucket(t, shards, shard.WithName("local"))
+	moved, err := grown.Rebalance(ctx)
+	if a.NoError(err) {
+		a.Greater(moved, 0)
+	}
+
+	var renamed []string
+	for _, name := range names {
+		to := "bar" + name[len("foo"):]
+		renamed = append(renamed, to)
+
+		content, err := grown.Read(ctx, to)
+		if a.NoError(err, to) {
+			a.Equal([]byte(name), content, to)
+		}
+	}
+
+	a.Equal(renamed, fileNames(t, grown))
+}
+
+func TestBucket_BeforeRebalance(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	shards := newShards("a", "b", "c")
+	bucket := newBucket(t, shards)
+
+	var names []string
+	for i := 0; i < 50; i++ {
+		names = append(names, fmt.Sprintf("dir/%03d.txt", i))
+	}
+	write(t, bucket, names...)
+
+	// the files routed to the new shard are still found on their old shards
+	grown := newBucket(t, append(shards, memory.NewBucket("d")))
+	a.Equal(names, fileNames(t, grown))
+	for _, name := range names {
+		content, err := grown.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte(name), content)
+		}
+	}
+
+	for _, name := range names {
+		a.NoError(grown.Remove(ctx, name), name)
+	}
+	a.Empty(fileNames(t, grown))
+}
+
+func TestNewBucket_Invalid(t *testing.T) {
+	_, err := shard.NewBucket(nil)
+	assert.Error(t, err)
+
+	_, err = shard.NewBucket(newShards("a", "a"))
+	assert.Error(t, err)
+}
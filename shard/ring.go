@@ -0,0 +1,73 @@
+package shard
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"github.com/vcraescu/bucketly"
+	"sort"
+	"strconv"
+)
+
+type (
+	// ring maps the hashes of the shard virtual nodes to the shards.
+	ring struct {
+		hashes []uint64
+		shards []bucketly.Bucket
+	}
+
+	node struct {
+		hash  uint64
+		shard bucketly.Bucket
+	}
+)
+
+func newRing(shards []bucketly.Bucket, virtualNodes int) *ring {
+	nodes := make([]node, 0, len(shards)*virtualNodes)
+	for _, shard := range shards {
+		for i := 0; i < virtualNodes; i++ {
+			nodes = append(nodes, node{
+				hash:  hash(shard.Name() + "#" + strconv.Itoa(i)),
+				shard: shard,
+			})
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].hash != nodes[j].hash {
+			return nodes[i].hash < nodes[j].hash
+		}
+
+		return nodes[i].shard.Name() < nodes[j].shard.Name()
+	})
+
+	r := &ring{
+		hashes: make([]uint64, len(nodes)),
+		shards: make([]bucketly.Bucket, len(nodes)),
+	}
+	for i, n := range nodes {
+		r.hashes[i] = n.hash
+		r.shards[i] = n.shard
+	}
+
+	return r
+}
+
+// get returns the shard of the first virtual node following the hash of the key.
+func (r *ring) get(key string) bucketly.Bucket {
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.shards[i]
+}
+
+func hash(s string) uint64 {
+	sum := md5.Sum([]byte(s))
+
+	return binary.BigEndian.Uint64(sum[:8])
+}
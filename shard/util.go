@@ -0,0 +1,46 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"os"
+)
+
+// move copies the file to the other shard and removes it from the first one.
+func move(ctx context.Context, src, dest bucketly.Bucket, from string, to string, opts ...bucketly.CopyOption) error {
+	item, err := src.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	if err := dest.Copy(ctx, item, to, opts...); err != nil {
+		return err
+	}
+
+	return src.Remove(ctx, from)
+}
+
+// openDir lists the direct children of the directory on the shard, or returns nil when it doesn't
+// exist there.
+func openDir(ctx context.Context, shard bucketly.Bucket, dir string) (bucketly.ListIterator, error) {
+	l, ok := shard.(bucketly.Listable)
+	if !ok {
+		return nil, fmt.Errorf("shard %s is not listable", shard.Name())
+	}
+
+	item, err := shard.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if !item.IsDir() {
+		return nil, nil
+	}
+
+	return l.Items(dir)
+}
@@ -0,0 +1,358 @@
+package bucketly
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type (
+	// SubBucket is a view of the part of a bucket under a prefix. Names are resolved under the
+	// prefix and can't escape it.
+	SubBucket struct {
+		bucket Bucket
+		prefix string
+	}
+
+	subListIterator struct {
+		sub *SubBucket
+		it  ListIterator
+	}
+)
+
+// Sub returns the view of the bucket under the prefix. It panics when the prefix is the root
+// directory, e.g. "" or "..", or when it climbs above it, the view wouldn't be scoped.
+func Sub(b Bucket, prefix string) Bucket {
+	ps := string(b.PathSeparator())
+	sanitized, err := Sanitize(b, prefix)
+	if err != nil {
+		panic(fmt.Sprintf("bucketly: invalid sub bucket prefix %q: %v", prefix, err))
+	}
+
+	rel := Join(b, strings.TrimLeft(strings.TrimSpace(prefix), ps))
+	if sanitized == ps || rel == ".." || strings.HasPrefix(rel, ".."+ps) {
+		panic(fmt.Sprintf("bucketly: invalid sub bucket prefix %q", prefix))
+	}
+
+	return &SubBucket{
+		bucket: b,
+		prefix: strings.Trim(sanitized, ps),
+	}
+}
+
+func (s *SubBucket) Parent() Bucket {
+	return s.bucket
+}
+
+func (s *SubBucket) Prefix() string {
+	return s.prefix
+}
+
+func (s *SubBucket) Name() string {
+	return s.bucket.Name()
+}
+
+func (s *SubBucket) PathSeparator() rune {
+	return s.bucket.PathSeparator()
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (s *SubBucket) StoresMetadata() bool {
+	return StoresMetadata(s.bucket)
+}
+
+func (s *SubBucket) Read(ctx context.Context, name string) ([]byte, error) {
+	name, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bucket.Read(ctx, name)
+}
+
+func (s *SubBucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	name, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bucket.NewReader(ctx, name)
+}
+
+func (s *SubBucket) Write(ctx context.Context, name string, data []byte, opts ...WriteOption) (int, error) {
+	name, err := s.resolve(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.bucket.Write(ctx, name, data, opts...)
+}
+
+func (s *SubBucket) NewWriter(ctx context.Context, name string, opts ...WriteOption) (io.WriteCloser, error) {
+	name, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bucket.NewWriter(ctx, name, opts...)
+}
+
+func (s *SubBucket) Exists(ctx context.Context, name string) (bool, error) {
+	name, err := s.resolve(name)
+	if err != nil {
+		return false, err
+	}
+
+	return s.bucket.Exists(ctx, name)
+}
+
+func (s *SubBucket) Remove(ctx context.Context, name string) error {
+	resolved, err := s.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	if s.isRoot(resolved) {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	return s.bucket.Remove(ctx, resolved)
+}
+
+func (s *SubBucket) Stat(ctx context.Context, name string) (Item, error) {
+	name, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newItem(item)
+}
+
+func (s *SubBucket) Mkdir(ctx context.Context, name string, opts ...WriteOption) error {
+	name, err := s.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.Mkdir(ctx, name, opts...)
+}
+
+func (s *SubBucket) MkdirAll(ctx context.Context, name string, opts ...WriteOption) error {
+	name, err := s.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.MkdirAll(ctx, name, opts...)
+}
+
+func (s *SubBucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	name, err := s.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.Chmod(ctx, name, mode)
+}
+
+func (s *SubBucket) RemoveAll(ctx context.Context, name string) error {
+	name, err := s.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.RemoveAll(ctx, name)
+}
+
+func (s *SubBucket) Rename(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	from, err := s.resolve(from)
+	if err != nil {
+		return err
+	}
+
+	to, err = s.resolve(to)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.Rename(ctx, from, to, opts...)
+}
+
+func (s *SubBucket) Copy(ctx context.Context, from Item, to string, opts ...CopyOption) error {
+	to, err := s.resolve(to)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.Copy(ctx, unwrapSubItem(from), to, opts...)
+}
+
+func (s *SubBucket) CopyAll(ctx context.Context, from Item, to string, opts ...CopyOption) error {
+	to, err := s.resolve(to)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.CopyAll(ctx, unwrapSubItem(from), to, opts...)
+}
+
+func (s *SubBucket) Copy2(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	from, err := s.resolve(from)
+	if err != nil {
+		return err
+	}
+
+	to, err = s.resolve(to)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.Copy2(ctx, from, to, opts...)
+}
+
+func (s *SubBucket) CopyAll2(ctx context.Context, from string, to string, opts ...CopyOption) error {
+	from, err := s.resolve(from)
+	if err != nil {
+		return err
+	}
+
+	to, err = s.resolve(to)
+	if err != nil {
+		return err
+	}
+
+	return s.bucket.CopyAll2(ctx, from, to, opts...)
+}
+
+func (s *SubBucket) Walk(ctx context.Context, dir string, walkFunc WalkFunc) error {
+	w, ok := s.bucket.(Walkable)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	dir, err := s.resolve(dir)
+	if err != nil {
+		return err
+	}
+
+	return w.Walk(ctx, dir, func(item Item, err error) error {
+		if item != nil {
+			var serr error
+			if item, serr = s.newItem(item); serr != nil {
+				return serr
+			}
+		}
+
+		return walkFunc(item, err)
+	})
+}
+
+func (s *SubBucket) Items(name string) (ListIterator, error) {
+	l, ok := s.bucket.(Listable)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	name, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &subListIterator{
+		sub: s,
+		it:  it,
+	}, nil
+}
+
+// resolve returns the name in the parent bucket. Sanitize makes the name absolute first, so ".."
+// can't go above the prefix.
+func (s *SubBucket) resolve(name string) (string, error) {
+	ps := string(s.PathSeparator())
+	dir := strings.HasSuffix(strings.TrimSpace(name), ps)
+	name, err := Sanitize(s, name)
+	if err != nil {
+		return "", err
+	}
+
+	if name == ps {
+		return s.prefix + ps, nil
+	}
+
+	resolved := Join(s, s.prefix, name)
+	if dir {
+		resolved += ps
+	}
+
+	return resolved, nil
+}
+
+func (s *SubBucket) isRoot(name string) bool {
+	return strings.Trim(name, string(s.PathSeparator())) == s.prefix
+}
+
+// strip returns the name relative to the prefix of a parent bucket item name. It fails for the
+// names outside of the prefix, which the view must not expose.
+func (s *SubBucket) strip(name string) (string, error) {
+	ps := string(s.PathSeparator())
+	key := strings.Trim(name, ps)
+	if key != s.prefix && !strings.HasPrefix(key, s.prefix+ps) {
+		return "", fmt.Errorf("%s is outside of %s", name, s.prefix)
+	}
+
+	key = strings.TrimLeft(strings.TrimPrefix(strings.TrimLeft(name, ps), s.prefix), ps)
+	if key == "" {
+		return ps, nil
+	}
+
+	return key, nil
+}
+
+func (s *SubBucket) newItem(from Item) (Item, error) {
+	name, err := s.strip(from.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return RebindItem(s, name, from), nil
+}
+
+func (i *subListIterator) Next(ctx context.Context) (Item, error) {
+	item, err := i.it.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.sub.newItem(item)
+}
+
+func (i *subListIterator) Close() error {
+	return i.it.Close()
+}
+
+// unwrapSubItem returns the parent bucket item of a sub bucket item so the parent bucket can use
+// its own copy, e.g. a server side one.
+func unwrapSubItem(item Item) Item {
+	s, ok := item.Bucket().(*SubBucket)
+	if !ok {
+		return item
+	}
+
+	name, err := s.resolve(item.Name())
+	if err != nil {
+		return item
+	}
+
+	return unwrapSubItem(RebindItem(s.bucket, name, item))
+}
@@ -0,0 +1,103 @@
+package bucketly_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"os"
+	"testing"
+)
+
+func TestSub(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	_, err := parent.Write(ctx, "secret.txt", []byte("secret"))
+	a.NoError(err)
+	_, err = parent.Write(ctx, "tenants/bar/bar.txt", []byte("bar"))
+	a.NoError(err)
+
+	foo := bucketly.Sub(parent, "/tenants/foo/")
+	_, err = foo.Write(ctx, "docs/a.txt", []byte("12345"))
+	a.NoError(err)
+
+	content, err := parent.Read(ctx, "tenants/foo/docs/a.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+
+	item, err := foo.Stat(ctx, "/docs/a.txt")
+	if a.NoError(err) {
+		a.Equal("docs/a.txt", item.Name())
+		a.Equal(foo, item.Bucket())
+	}
+
+	for _, name := range []string{"../../secret.txt", "/../bar/bar.txt", "docs/../../../secret.txt"} {
+		_, err := foo.Read(ctx, name)
+		a.True(os.IsNotExist(err), name)
+	}
+
+	names, err := walkNames(ctx, foo.(bucketly.Walkable), "/")
+	if a.NoError(err) {
+		a.Equal([]string{"docs", "docs/a.txt"}, names)
+	}
+
+	items, err := getItemsArray(ctx, foo.(bucketly.Listable), "docs")
+	if a.NoError(err) && a.Len(items, 1) {
+		a.Equal("docs/a.txt", items[0].Name())
+	}
+
+	bar := bucketly.Sub(parent, "tenants/bar")
+	if a.NoError(bar.CopyAll(ctx, bucketly.NewItem(foo, "docs/"), "copy/")) {
+		content, err := parent.Read(ctx, "tenants/bar/copy/a.txt")
+		if a.NoError(err) {
+			a.Equal([]byte("12345"), content)
+		}
+	}
+
+	a.Error(foo.Remove(ctx, ".."))
+	a.NoError(foo.RemoveAll(ctx, ".."))
+
+	exists, err := parent.Exists(ctx, "secret.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	exists, err = parent.Exists(ctx, "tenants/foo")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+}
+
+func TestSub_InvalidPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "/", "..", "../foo", " "} {
+		assert.Panics(t, func() {
+			bucketly.Sub(memory.NewBucket("parent"), prefix)
+		}, prefix)
+	}
+}
+
+func TestSub_OutsideItem(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := &escapingBucket{Bucket: memory.NewBucket("parent")}
+	_, err := parent.Write(ctx, "tenants/foo/a.txt", []byte("12345"))
+	a.NoError(err)
+
+	_, err = bucketly.Sub(parent, "tenants/foo").Stat(ctx, "a.txt")
+	a.Error(err)
+}
+
+// escapingBucket returns the items under another name than asked.
+type escapingBucket struct {
+	*memory.Bucket
+}
+
+func (b *escapingBucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	if _, err := b.Bucket.Stat(ctx, name); err != nil {
+		return nil, err
+	}
+
+	return bucketly.NewItem(b, "secret.txt"), nil
+}
@@ -0,0 +1,835 @@
+package tarbucket
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pathSeparator   rune        = '/'
+	defaultFileMode os.FileMode = 0644
+	defaultDirMode  os.FileMode = 0755
+)
+
+var (
+	errReadOnly  = errors.New("archive is opened for reading")
+	errWriteOnly = errors.New("archive is opened for writing")
+)
+
+type (
+	// Bucket is either a read-only index of an existing archive, see OpenBucket and OpenItem, or a
+	// write-only stream emitting a new archive in one pass, see NewBucket and CreateItem.
+	Bucket struct {
+		name   string
+		config Config
+		closer io.Closer
+
+		reader  io.ReaderAt
+		entries map[string]*entry
+
+		mu      sync.Mutex
+		gw      *gzip.Writer
+		writer  *tar.Writer
+		written map[string]bool
+		// err fails the archive once an entry is only partially written.
+		err    error
+		closed bool
+	}
+
+	Config struct {
+		gzip      bool
+		gzipLevel int
+	}
+
+	Option func(cfg *Config)
+
+	entry struct {
+		header   *tar.Header
+		offset   int64
+		dir      bool
+		children []string
+	}
+
+	// entryWriter buffers the content of an entry because the header, written first, holds its size.
+	entryWriter struct {
+		bytes.Buffer
+		bucket  *Bucket
+		name    string
+		mode    os.FileMode
+		modTime time.Time
+		closed  bool
+	}
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+)
+
+// WithGzip compresses the written archive with gzip, producing a tar.gz.
+func WithGzip() Option {
+	return WithGzipLevel(gzip.DefaultCompression)
+}
+
+func WithGzipLevel(level int) Option {
+	return func(cfg *Config) {
+		cfg.gzip = true
+		cfg.gzipLevel = level
+	}
+}
+
+// NewBucket returns a bucket streaming a new archive into w. The archive is complete only after Close.
+func NewBucket(name string, w io.Writer, opts ...Option) (*Bucket, error) {
+	cfg := Config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	b := &Bucket{
+		name:    name,
+		config:  cfg,
+		written: make(map[string]bool),
+	}
+
+	if cfg.gzip {
+		gw, err := gzip.NewWriterLevel(w, cfg.gzipLevel)
+		if err != nil {
+			return nil, err
+		}
+
+		b.gw = gw
+		w = gw
+	}
+
+	b.writer = tar.NewWriter(w)
+
+	return b, nil
+}
+
+// CreateItem streams a new archive into the item with the given name of the dest bucket.
+func CreateItem(ctx context.Context, dest bucketly.Bucket, name string, opts ...Option) (*Bucket, error) {
+	w, err := dest.NewWriter(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewBucket(name, w, opts...)
+	if err != nil {
+		w.Close()
+
+		return nil, err
+	}
+
+	b.closer = w
+
+	return b, nil
+}
+
+// OpenBucket indexes the archive of the given size read from r. Compressed archives are
+// decompressed in memory since a gzip stream cannot be read at random offsets.
+func OpenBucket(name string, r io.ReaderAt, size int64) (*Bucket, error) {
+	magic := make([]byte, 2)
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if isGzip(magic) {
+		gr, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, fmt.Errorf(`error opening archive "%s": %w`, name, err)
+		}
+
+		data, err := ioutil.ReadAll(gr)
+		if err != nil {
+			return nil, fmt.Errorf(`error decompressing archive "%s": %w`, name, err)
+		}
+
+		r = bytes.NewReader(data)
+		size = int64(len(data))
+	}
+
+	b := &Bucket{
+		name:   name,
+		reader: r,
+	}
+
+	if err := b.index(io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, fmt.Errorf(`error indexing archive "%s": %w`, name, err)
+	}
+
+	return b, nil
+}
+
+// OpenItem indexes the archive stored in the item. Unless the item can be read at random offsets,
+// like a local file, the archive is loaded in memory.
+func OpenItem(ctx context.Context, item bucketly.Item) (*Bucket, error) {
+	rc, err := item.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := rc.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			rc.Close()
+
+			return nil, err
+		}
+
+		b, err := OpenBucket(item.Name(), f, size)
+		if err != nil {
+			rc.Close()
+
+			return nil, err
+		}
+
+		b.closer = rc
+
+		return b, nil
+	}
+
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenBucket(item.Name(), bytes.NewReader(data), int64(len(data)))
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+// StoresMetadata reports false, the metadata of the items is not kept.
+func (b *Bucket) StoresMetadata() bool {
+	return false
+}
+
+// Close writes the trailer of a new archive and closes the underlying item, if any.
+func (b *Bucket) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	err := b.err
+	if b.writer != nil {
+		if werr := b.writer.Close(); err == nil {
+			err = werr
+		}
+	}
+
+	if b.gw != nil {
+		if gerr := b.gw.Close(); err == nil {
+			err = gerr
+		}
+	}
+
+	if b.closer != nil {
+		if cerr := b.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(_ context.Context, name string) (io.ReadCloser, error) {
+	e, err := b.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return ioutil.NopCloser(io.NewSectionReader(b.reader, e.offset, e.header.Size)), nil
+}
+
+func (b *Bucket) Write(_ context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultFileMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	if isDirPath(name) {
+		return 0, fmt.Errorf("%s is a directory", name)
+	}
+
+	if err := b.writeEntry(name, wo.Mode, time.Now(), int64(len(data)), bytes.NewReader(data)); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// NewWriter buffers the content in memory until Close, prefer Write or Copy for large entries.
+func (b *Bucket) NewWriter(_ context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultFileMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	if isDirPath(name) {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	if b.writer == nil {
+		return nil, errReadOnly
+	}
+
+	return &entryWriter{
+		bucket:  b,
+		name:    name,
+		mode:    wo.Mode,
+		modTime: time.Now(),
+	}, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(_ context.Context, _ string) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Stat(_ context.Context, name string) (bucketly.Item, error) {
+	e, err := b.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		key = string(pathSeparator)
+	}
+
+	return b.entryToItem(key, e), nil
+}
+
+func (b *Bucket) Mkdir(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	return b.createDir(key, wo.Mode, time.Now())
+}
+
+func (b *Bucket) MkdirAll(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	return b.createDirAll(key, wo.Mode, time.Now())
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) RemoveAll(_ context.Context, _ string) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Rename(_ context.Context, _ string, _ string, _ ...bucketly.CopyOption) error {
+	return bucketly.ErrNotSupported
+}
+
+// Copy streams the item into a new archive, keeping its mode and modification time.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{
+		Mode: from.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+	}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	modTime := from.ModTime()
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		if co.Mode == 0 {
+			co.Mode = defaultDirMode
+		}
+
+		key, err := b.key(to)
+		if err != nil {
+			return err
+		}
+
+		return b.createDirAll(key, co.Mode, modTime)
+	}
+
+	if co.Mode == 0 {
+		co.Mode = defaultFileMode
+	}
+
+	size := from.Size()
+	if size == 0 {
+		// the item may not have been stat-ed yet, the header needs the real size
+		item, err := from.Bucket().Stat(ctx, from.Name())
+		if err != nil {
+			return err
+		}
+
+		size = item.Size()
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return b.writeEntry(to, co.Mode, modTime, size, src)
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(dir string, walkFunc bucketly.WalkFunc) error {
+	items, err := b.readDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) readDir(dir string) ([]bucketly.Item, error) {
+	e, err := b.lookup(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]bucketly.Item, 0, len(e.children))
+	for _, key := range e.children {
+		items = append(items, b.entryToItem(key, b.entries[key]))
+	}
+
+	return items, nil
+}
+
+func (b *Bucket) lookup(name string) (*entry, error) {
+	if b.reader == nil {
+		return nil, errWriteOnly
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := b.entries[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return e, nil
+}
+
+// writeEntry writes the header and the size bytes of r as a single file entry.
+func (b *Bucket) writeEntry(name string, mode os.FileMode, modTime time.Time, size int64, r io.Reader) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key == "" {
+		return fmt.Errorf("%s is a directory", name)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.checkWritable(key); err != nil {
+		return err
+	}
+
+	if b.written[dirKey(key)] {
+		return fmt.Errorf("%s is a directory", name)
+	}
+
+	if err := b.writer.WriteHeader(fileHeader(key, mode, modTime, size)); err != nil {
+		return err
+	}
+
+	// the header holds the size, the archive can't go on with fewer bytes
+	n, err := io.Copy(b.writer, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("%s: expected %d bytes, got %d", name, size, n)
+	}
+
+	if err != nil {
+		b.err = fmt.Errorf("archive is corrupted by %s: %w", name, err)
+
+		return err
+	}
+
+	b.written[key] = true
+
+	return nil
+}
+
+func (b *Bucket) createDirAll(key string, mode os.FileMode, modTime time.Time) error {
+	if key == "" {
+		return b.createDir(key, mode, modTime)
+	}
+
+	var current []string
+	for _, token := range strings.Split(key, string(pathSeparator)) {
+		current = append(current, token)
+		if err := b.createDir(strings.Join(current, string(pathSeparator)), mode, modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) createDir(key string, mode os.FileMode, modTime time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.writer == nil {
+		return errReadOnly
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	if b.written[key] {
+		return fmt.Errorf("%s is not a directory", key)
+	}
+
+	if b.written[dirKey(key)] {
+		return nil
+	}
+
+	if err := b.checkWritable(dirKey(key)); err != nil {
+		return err
+	}
+
+	if err := b.writer.WriteHeader(dirHeader(dirKey(key), mode, modTime)); err != nil {
+		return err
+	}
+
+	b.written[dirKey(key)] = true
+
+	return nil
+}
+
+func (b *Bucket) checkWritable(key string) error {
+	if b.writer == nil {
+		return errReadOnly
+	}
+
+	if b.closed {
+		return errors.New("archive is closed")
+	}
+
+	if b.err != nil {
+		return b.err
+	}
+
+	if b.written[key] {
+		return fmt.Errorf("%s already exists in the archive", key)
+	}
+
+	return nil
+}
+
+// index records the header and the data offset of every entry, adding the directories without
+// an entry of their own. Entries other than regular files and directories are skipped.
+func (b *Bucket) index(r io.ReadSeeker) error {
+	b.entries = map[string]*entry{
+		"": {dir: true},
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		dir := hdr.Typeflag == tar.TypeDir
+		if !dir && hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		key := cleanKey(hdr.Name)
+		if key == "" {
+			continue
+		}
+
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		if e, ok := b.entries[key]; ok {
+			e.header = hdr
+			e.offset = offset
+			e.dir = e.dir || dir
+
+			continue
+		}
+
+		b.entries[key] = &entry{header: hdr, offset: offset, dir: dir}
+		b.addParents(key)
+	}
+
+	for _, e := range b.entries {
+		sort.Strings(e.children)
+	}
+
+	return nil
+}
+
+func (b *Bucket) addParents(key string) {
+	for {
+		parent := ""
+		if i := strings.LastIndexByte(key, byte(pathSeparator)); i >= 0 {
+			parent = key[:i]
+		}
+
+		p, ok := b.entries[parent]
+		if !ok {
+			p = &entry{dir: true}
+			b.entries[parent] = p
+		}
+
+		p.dir = true
+		p.children = append(p.children, key)
+		if ok || parent == "" {
+			return
+		}
+
+		key = parent
+	}
+}
+
+func (b *Bucket) key(name string) (string, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(name, string(pathSeparator)), nil
+}
+
+func (b *Bucket) entryToItem(name string, e *entry) bucketly.Item {
+	item := bucketly.NewItem(b, name)
+	item.SetDir(e.dir)
+	item.SetMetadata(bucketly.Metadata{})
+
+	if e.header == nil {
+		item.SetMode(os.ModeDir | defaultDirMode)
+
+		return item
+	}
+
+	item.SetMode(e.header.FileInfo().Mode())
+	item.SetModeTime(e.header.ModTime)
+	item.SetETag(etag(e.header))
+	item.SetSys(e.header)
+	if !e.dir {
+		item.SetSize(e.header.Size)
+	}
+
+	return item
+}
+
+func (w *entryWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+
+	return w.bucket.writeEntry(w.name, w.mode, w.modTime, int64(w.Len()), &w.Buffer)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		i.queue, err = i.bucket.readDir(i.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
@@ -0,0 +1,313 @@
+package tarbucket_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/tarbucket"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func walk(ctx context.Context, bucket bucketly.Walkable, name string) ([]string, error) {
+	var names []string
+	err := bucket.Walk(ctx, name, func(item bucketly.Item, err error) error {
+		names = append(names, item.Name())
+
+		return nil
+	})
+
+	return names, err
+}
+
+func TestBucket_RoundTrip(t *testing.T) {
+	files := map[string]os.FileMode{
+		"export/a.txt":         0644,
+		"export/bin/run.sh":    0755,
+		"export/docs/b/c.html": 0600,
+	}
+
+	tests := []struct {
+		name string
+		opts []tarbucket.Option
+	}{
+		{
+			name: "tar",
+		},
+		{
+			name: "tar.gz",
+			opts: []tarbucket.Option{tarbucket.WithGzip()},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			src := memory.NewBucket("src")
+			for name, mode := range files {
+				if _, err := src.Write(ctx, name, []byte(name), bucketly.WithWriteMode(mode)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+			archive, err := tarbucket.NewBucket("export."+test.name, &buf, test.opts...)
+			if !a.NoError(err) {
+				return
+			}
+
+			if !a.NoError(archive.CopyAll(ctx, bucketly.NewItem(src, "export/"), "")) {
+				return
+			}
+
+			if !a.NoError(archive.Close()) {
+				return
+			}
+
+			archive, err = tarbucket.OpenBucket("export."+test.name, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if !a.NoError(err) {
+				return
+			}
+
+			names, err := walk(ctx, archive, "/")
+			if a.NoError(err) {
+				a.Equal([]string{"a.txt", "bin", "bin/run.sh", "docs", "docs/b", "docs/b/c.html"}, names)
+			}
+
+			for name, mode := range files {
+				key := name[len("export/"):]
+				item, err := archive.Stat(ctx, key)
+				if !a.NoError(err, name) {
+					continue
+				}
+
+				original, _ := src.Stat(ctx, name)
+				a.Equal(mode, item.Mode(), name)
+				a.Equal(int64(len(name)), item.Size(), name)
+				a.Equal(original.ModTime().Unix(), item.ModTime().Unix(), name)
+
+				content, err := archive.Read(ctx, key)
+				if a.NoError(err, name) {
+					a.Equal([]byte(name), content, name)
+				}
+			}
+
+			item, err := archive.Stat(ctx, "docs")
+			if a.NoError(err) {
+				a.True(item.IsDir())
+			}
+
+			_, err = archive.Stat(ctx, "missing.txt")
+			a.True(os.IsNotExist(err))
+
+			dest := memory.NewBucket("dest")
+			if !a.NoError(dest.CopyAll(ctx, bucketly.NewItem(archive, "/"), "restore/")) {
+				return
+			}
+
+			content, err := dest.Read(ctx, "restore/bin/run.sh")
+			if a.NoError(err) {
+				a.Equal([]byte("export/bin/run.sh"), content)
+			}
+		})
+	}
+}
+
+func TestBucket_Write(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dest := memory.NewBucket("dest")
+
+	archive, err := tarbucket.CreateItem(ctx, dest, "archive.tar")
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = archive.Write(ctx, "foo/bar.txt", []byte("12345"), bucketly.WithWriteMode(0600))
+	a.NoError(err)
+	a.NoError(archive.MkdirAll(ctx, "foo/empty/"))
+
+	w, err := archive.NewWriter(ctx, "foo/baz.txt")
+	if a.NoError(err) {
+		_, err = w.Write([]byte("123"))
+		a.NoError(err)
+		a.NoError(w.Close())
+	}
+
+	_, err = archive.Write(ctx, "foo/bar.txt", []byte("12345"))
+	a.Error(err)
+
+	_, err = archive.Stat(ctx, "foo/bar.txt")
+	a.Error(err)
+
+	if !a.NoError(archive.Close()) {
+		return
+	}
+
+	data, err := dest.Read(ctx, "archive.tar")
+	if !a.NoError(err) {
+		return
+	}
+
+	var headers []*tar.Header
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if !a.NoError(err) {
+			return
+		}
+
+		headers = append(headers, hdr)
+	}
+
+	if a.Len(headers, 4) {
+		a.Equal("foo/bar.txt", headers[0].Name)
+		a.Equal(int64(0600), headers[0].Mode)
+		a.Equal("foo/", headers[1].Name)
+		a.Equal("foo/empty/", headers[2].Name)
+		a.Equal("foo/baz.txt", headers[3].Name)
+		a.Equal(int64(3), headers[3].Size)
+		a.WithinDuration(time.Now(), headers[3].ModTime, time.Minute)
+	}
+
+	item, err := dest.Stat(ctx, "archive.tar")
+	if !a.NoError(err) {
+		return
+	}
+
+	archive, err = tarbucket.OpenItem(ctx, item)
+	if !a.NoError(err) {
+		return
+	}
+	defer archive.Close()
+
+	content, err := archive.Read(ctx, "foo/baz.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("123"), content)
+	}
+}
+
+func TestBucket_ModTime(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	src := memory.NewBucket("src")
+	if _, err := src.Write(ctx, "foo.txt", []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive keeps whole seconds, the fraction must be dropped rather than rounded up
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 900000000, time.UTC)
+	item := bucketly.NewItem(src, "foo.txt")
+	item.SetSize(3)
+	item.SetMode(0644)
+	item.SetModeTime(modTime)
+	item.SetETag(`"foo"`)
+	item.SetMetadata(bucketly.Metadata{})
+
+	var buf bytes.Buffer
+	archive, err := tarbucket.NewBucket("export.tar", &buf)
+	if !a.NoError(err) {
+		return
+	}
+
+	a.NoError(archive.Copy(ctx, item, "foo.txt"))
+	if !a.NoError(archive.Close()) {
+		return
+	}
+
+	archive, err = tarbucket.OpenBucket("export.tar", bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !a.NoError(err) {
+		return
+	}
+
+	stat, err := archive.Stat(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal(modTime.Truncate(time.Second), stat.ModTime().UTC())
+	}
+}
+
+func TestBucket_CopyMode(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	src := memory.NewBucket("src")
+	if _, err := src.Write(ctx, "foo.sh", []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	item := bucketly.NewItem(src, "foo.sh")
+	item.SetSize(3)
+	item.SetMode(0755 | os.ModeSetuid | os.ModeSticky)
+	item.SetModeTime(time.Now())
+
+	var buf bytes.Buffer
+	archive, err := tarbucket.NewBucket("export.tar", &buf)
+	if !a.NoError(err) {
+		return
+	}
+
+	a.NoError(archive.Copy(ctx, item, "foo.sh"))
+	if !a.NoError(archive.Close()) {
+		return
+	}
+
+	hdr, err := tar.NewReader(&buf).Next()
+	if a.NoError(err) {
+		a.Equal(int64(05755), hdr.Mode)
+	}
+}
+
+func TestBucket_FailedCopy(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	item := &failingItem{BucketItem: bucketly.NewItem(memory.NewBucket("src"), "foo.txt")}
+	item.SetSize(10)
+	item.SetModeTime(time.Now())
+
+	var buf bytes.Buffer
+	archive, err := tarbucket.NewBucket("export.tar", &buf)
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(errFailed, archive.Copy(ctx, item, "foo.txt"))
+
+	// the archive holds a partial entry, nothing can be added anymore
+	_, err = archive.Write(ctx, "foo.txt", []byte("foo"))
+	a.True(errors.Is(err, errFailed))
+	_, err = archive.Write(ctx, "bar.txt", []byte("bar"))
+	a.True(errors.Is(err, errFailed))
+	a.True(errors.Is(archive.Close(), errFailed))
+}
+
+var errFailed = errors.New("failed")
+
+type (
+	// failingItem is a file whose content fails after a few bytes.
+	failingItem struct {
+		*bucketly.BucketItem
+	}
+
+	failingReader struct{}
+)
+
+func (i *failingItem) Open(_ context.Context) (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.MultiReader(strings.NewReader("123"), failingReader{})), nil
+}
+
+func (failingReader) Read(_ []byte) (int, error) {
+	return 0, errFailed
+}
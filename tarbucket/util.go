@@ -0,0 +1,81 @@
+package tarbucket
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	modeSetuid = 04000
+	modeSetgid = 02000
+	modeSticky = 01000
+)
+
+func fileHeader(key string, mode os.FileMode, modTime time.Time, size int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     key,
+		Mode:     headerMode(mode),
+		ModTime:  modTime.Truncate(time.Second),
+		Size:     size,
+	}
+}
+
+func dirHeader(key string, mode os.FileMode, modTime time.Time) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     key,
+		Mode:     headerMode(mode),
+		ModTime:  modTime.Truncate(time.Second),
+	}
+}
+
+// headerMode converts the permission and special bits of mode to their unix values.
+func headerMode(mode os.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= modeSetuid
+	}
+
+	if mode&os.ModeSetgid != 0 {
+		m |= modeSetgid
+	}
+
+	if mode&os.ModeSticky != 0 {
+		m |= modeSticky
+	}
+
+	return m
+}
+
+func etag(hdr *tar.Header) string {
+	return fmt.Sprintf(`W/"%d-%d"`, hdr.Size, hdr.ModTime.UnixNano())
+}
+
+func isGzip(magic []byte) bool {
+	return len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// cleanKey turns the name of an archive entry into a key without leading or trailing separators.
+func cleanKey(name string) string {
+	name = path.Clean(string(pathSeparator) + name)
+
+	return strings.Trim(name, string(pathSeparator))
+}
+
+func isDirPath(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return true
+	}
+
+	return strings.HasSuffix(name, string(pathSeparator))
+}
+
+func dirKey(key string) string {
+	return key + string(pathSeparator)
+}
@@ -0,0 +1,645 @@
+package trash
+
+import (
+	"context"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTrashDir = ".trash"
+	// idLayout formats the deletion times into ids sorted from the oldest to the newest.
+	idLayout = "20060102T150405.000000000Z"
+)
+
+type (
+	// Bucket moves the removed items to the trash directory instead of deleting them. Every removal
+	// gets its own <trash dir>/<id> directory, the id being the time of the removal, where the items
+	// keep their paths, so they can be restored until the trash is emptied. The trash directory is
+	// hidden and can't be changed through the bucket.
+	Bucket struct {
+		bucket bucketly.Bucket
+		config Config
+		mu     sync.Mutex
+		last   time.Time
+	}
+
+	Config struct {
+		trashDir string
+	}
+
+	Option func(cfg *Config)
+
+	// Entry is a file in the trash.
+	Entry struct {
+		// ID identifies the removal which moved the file to the trash.
+		ID        string
+		Name      string
+		Size      int64
+		DeletedAt time.Time
+	}
+
+	listIterator struct {
+		bucket *Bucket
+		it     bucketly.ListIterator
+	}
+)
+
+// WithTrashDir sets the directory holding the removed items, ".trash" by default. It must be a
+// clean path.
+func WithTrashDir(dir string) Option {
+	return func(cfg *Config) {
+		cfg.trashDir = dir
+	}
+}
+
+func NewBucket(b bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		trashDir: defaultTrashDir,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	// a rooted name keeps its leading dots through the sanitization
+	dir, err := bucketly.Sanitize(b, string(b.PathSeparator())+cfg.trashDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// a directory changed by the sanitization would hide another one than asked
+	dir = strings.Trim(dir, string(b.PathSeparator()))
+	if dir == "" || dir != strings.Trim(cfg.trashDir, string(b.PathSeparator())) {
+		return nil, fmt.Errorf("invalid trash directory %s", cfg.trashDir)
+	}
+
+	cfg.trashDir = dir
+
+	return &Bucket{
+		bucket: b,
+		config: cfg,
+	}, nil
+}
+
+func (b *Bucket) Parent() bucketly.Bucket {
+	return b.bucket
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.bucket)
+}
+
+func (b *Bucket) Name() string {
+	return b.bucket.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.bucket.PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	return b.bucket.Read(ctx, name)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	return b.bucket.NewReader(ctx, name)
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	if _, err := b.key(name); err != nil {
+		return 0, err
+	}
+
+	return b.bucket.Write(ctx, name, data, opts...)
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	if _, err := b.key(name); err != nil {
+		return nil, err
+	}
+
+	return b.bucket.NewWriter(ctx, name, opts...)
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	if b.hidden(name) {
+		return false, nil
+	}
+
+	return b.bucket.Exists(ctx, name)
+}
+
+// Remove moves the file to the trash. Directories hold no content, they are removed as usual.
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	item, err := b.bucket.Stat(ctx, b.layerName(key))
+	if err != nil {
+		return err
+	}
+
+	if item.IsDir() {
+		return b.bucket.Remove(ctx, name)
+	}
+
+	return b.moveToTrash(ctx, key, b.trashPath(b.nextID()))
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	if _, err := b.key(name); err != nil {
+		return err
+	}
+
+	return b.bucket.Mkdir(ctx, name, opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	if _, err := b.key(name); err != nil {
+		return err
+	}
+
+	return b.bucket.MkdirAll(ctx, name, opts...)
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	if _, err := b.key(name); err != nil {
+		return err
+	}
+
+	return b.bucket.Chmod(ctx, name, mode)
+}
+
+// RemoveAll moves the item to the trash. When the root directory is removed, all its items but the
+// trash directory are moved.
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	if key != "" {
+		exists, err := b.bucket.Exists(ctx, b.layerName(key))
+		if err != nil || !exists {
+			return err
+		}
+
+		return b.moveToTrash(ctx, key, b.trashPath(b.nextID()))
+	}
+
+	items, err := b.readDir(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	dir := b.trashPath(b.nextID())
+	for _, item := range items {
+		key := strings.Trim(item.Name(), string(b.PathSeparator()))
+		if err := b.moveToTrash(ctx, key, dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	if _, err := b.key(from); err != nil {
+		return err
+	}
+
+	if _, err := b.key(to); err != nil {
+		return err
+	}
+
+	return b.bucket.Rename(ctx, from, to, opts...)
+}
+
+// Copy copies the item with the wrapped bucket, an item of the bucket is copied by it directly.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if _, err := b.key(to); err != nil {
+		return err
+	}
+
+	if from.Bucket() == bucketly.Bucket(b) {
+		item, err := b.bucket.Stat(ctx, from.Name())
+		if err != nil {
+			return err
+		}
+
+		from = item
+	}
+
+	return b.bucket.Copy(ctx, from, to, opts...)
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+// Walk walks the wrapped bucket without the trash directory.
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	if b.hidden(dir) {
+		return nil
+	}
+
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if item == nil {
+			return walkFunc(item, err)
+		}
+
+		if b.isTrash(item.Name()) {
+			return bucketly.ErrSkipWalkDir
+		}
+
+		return walkFunc(b.newItem(item), err)
+	})
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	l, ok := b.bucket.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+// ListTrash returns the files in the trash, from the most recently removed ones, and by name.
+func (b *Bucket) ListTrash(ctx context.Context) ([]Entry, error) {
+	removals, err := b.removals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	var entries []Entry
+	for _, id := range removals {
+		deletedAt, _ := time.Parse(idLayout, id)
+		dir := b.trashPath(id)
+		err := w.Walk(ctx, b.layerName(dir), func(item bucketly.Item, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if item.IsDir() {
+				return nil
+			}
+
+			key := strings.Trim(item.Name(), string(b.PathSeparator()))
+			entries = append(entries, Entry{
+				ID:        id,
+				Name:      strings.TrimPrefix(key, dir+string(b.PathSeparator())),
+				Size:      item.Size(),
+				DeletedAt: deletedAt,
+			})
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].ID != entries[j].ID {
+			return entries[i].ID > entries[j].ID
+		}
+
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
+
+// Restore moves the item, a file or a directory, removed by the removal back to its path. The root
+// directory restores everything the removal moved to the trash. Nothing is restored when one of the
+// files exists.
+func (b *Bucket) Restore(ctx context.Context, id string, name string) error {
+	if _, err := time.Parse(idLayout, id); err != nil {
+		return fmt.Errorf("invalid trash id %s", id)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	src := bucketly.Join(b, b.trashPath(id), key)
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	var keys []string
+	var dirs []string
+	prefix := b.trashPath(id) + string(b.PathSeparator())
+	err = w.Walk(ctx, b.layerName(src), func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.Trim(item.Name(), string(b.PathSeparator()))
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		key := strings.TrimPrefix(name, prefix)
+		if item.IsDir() {
+			dirs = append(dirs, key)
+
+			return nil
+		}
+
+		keys = append(keys, key)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 && len(dirs) == 0 {
+		return os.ErrNotExist
+	}
+
+	for _, key := range keys {
+		exists, err := b.bucket.Exists(ctx, b.layerName(key))
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return fmt.Errorf("%s: %w", key, os.ErrExist)
+		}
+	}
+
+	if dir := bucketly.Dir(b, key); key != "" && dir != "." {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		if err := b.bucket.MkdirAll(ctx, b.layerName(dir)); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		if err := b.bucket.Rename(ctx, b.layerName(bucketly.Join(b, b.trashPath(id), key)), b.layerName(key)); err != nil {
+			return err
+		}
+	}
+
+	return b.prune(ctx, id)
+}
+
+// EmptyTrash deletes the removals older than the duration for good. It returns the number of
+// deleted removals.
+func (b *Bucket) EmptyTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	removals, err := b.removals(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(-olderThan)
+	deleted := 0
+	for _, id := range removals {
+		deletedAt, _ := time.Parse(idLayout, id)
+		if deletedAt.After(deadline) {
+			continue
+		}
+
+		if err := b.bucket.RemoveAll(ctx, b.layerName(b.trashPath(id))); err != nil {
+			return deleted, err
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// prune removes the removal from the trash once it has no files left.
+func (b *Bucket) prune(ctx context.Context, id string) error {
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	empty := true
+	err := w.Walk(ctx, b.layerName(b.trashPath(id)), func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			empty = false
+
+			return bucketly.ErrStopWalk
+		}
+
+		return nil
+	})
+	if err != nil || !empty {
+		return err
+	}
+
+	return b.bucket.RemoveAll(ctx, b.layerName(b.trashPath(id)))
+}
+
+// removals returns the ids of the removals in the trash.
+func (b *Bucket) removals(ctx context.Context) ([]string, error) {
+	items, err := bucketly.ListDir(ctx, b.bucket, b.layerName(b.config.trashDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, item := range items {
+		id := bucketly.Base(b.bucket, strings.TrimRight(item.Name(), string(b.PathSeparator())))
+		if _, err := time.Parse(idLayout, id); err != nil || !item.IsDir() {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// readDir returns the items of the directory without the trash directory.
+func (b *Bucket) readDir(ctx context.Context, key string) ([]bucketly.Item, error) {
+	items, err := bucketly.ListDir(ctx, b.bucket, b.layerName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	visible := items[:0]
+	for _, item := range items {
+		if !b.isTrash(item.Name()) {
+			visible = append(visible, item)
+		}
+	}
+
+	return visible, nil
+}
+
+// key turns a path into a key without leading or trailing separators, the root directory has the
+// empty key. It fails when the path is in the trash directory.
+func (b *Bucket) key(name string) (string, error) {
+	key, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	key = strings.Trim(key, string(b.PathSeparator()))
+	if b.isTrash(key) {
+		return "", fmt.Errorf("%s: %s is a reserved name", name, b.config.trashDir)
+	}
+
+	return key, nil
+}
+
+// moveToTrash moves the item to the same path in the trash directory of the removal.
+func (b *Bucket) moveToTrash(ctx context.Context, key string, dir string) error {
+	to := bucketly.Join(b, dir, key)
+	if err := b.bucket.MkdirAll(ctx, b.layerName(bucketly.Dir(b, to))); err != nil {
+		return err
+	}
+
+	return b.bucket.Rename(ctx, b.layerName(key), b.layerName(to))
+}
+
+// hidden reports whether the name given to the bucket is in the trash directory. The names of the
+// wrapped bucket items are checked with isTrash, they are not sanitized again.
+func (b *Bucket) hidden(name string) bool {
+	key, err := bucketly.Sanitize(b, name)
+
+	return err == nil && b.isTrash(key)
+}
+
+func (b *Bucket) isTrash(key string) bool {
+	key = strings.Trim(key, string(b.PathSeparator()))
+
+	return key == b.config.trashDir || strings.HasPrefix(key, b.config.trashDir+string(b.PathSeparator()))
+}
+
+// trashPath returns the key of the directory of the removal.
+func (b *Bucket) trashPath(id string) string {
+	return bucketly.Join(b, b.config.trashDir, id)
+}
+
+// layerName returns the name of the key in the wrapped bucket. It is rooted, so the leading dots of
+// the key, e.g. of the trash directory, are kept by the sanitization.
+func (b *Bucket) layerName(key string) string {
+	return string(b.PathSeparator()) + key
+}
+
+// nextID returns the id of a new removal, greater than the previous ones.
+func (b *Bucket) nextID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := time.Now().UTC()
+	if !t.After(b.last) {
+		t = b.last.Add(time.Nanosecond)
+	}
+	b.last = t
+
+	return t.Format(idLayout)
+}
+
+// newItem rebinds an item of the wrapped bucket.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	return bucketly.RebindItem(b, from.Name(), from)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	for {
+		item, err := i.it.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !i.bucket.isTrash(item.Name()) {
+			return i.bucket.newItem(item), nil
+		}
+	}
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
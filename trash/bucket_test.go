@@ -0,0 +1,210 @@
+package trash_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/trash"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newBucket(t *testing.T, b bucketly.Bucket, opts ...trash.Option) *trash.Bucket {
+	bucket, err := trash.NewBucket(b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func write(t *testing.T, bucket bucketly.Bucket, names ...string) {
+	for _, name := range names {
+		if _, err := bucket.Write(context.Background(), name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func walkNames(t *testing.T, bucket bucketly.Walkable) []string {
+	var names []string
+	err := bucket.Walk(context.Background(), "/", func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		names = append(names, item.Name())
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return names
+}
+
+func TestBucket_Remove(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, memory.NewBucket("parent"))
+	write(t, bucket, "foo/a.txt", "foo/b.txt")
+
+	a.NoError(bucket.Remove(ctx, "foo/a.txt"))
+	exists, err := bucket.Exists(ctx, "foo/a.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	a.NoError(bucket.RemoveAll(ctx, "foo"))
+	a.Empty(walkNames(t, bucket))
+
+	entries, err := bucket.ListTrash(ctx)
+	if !a.NoError(err) || !a.Len(entries, 2) {
+		return
+	}
+
+	a.Equal("foo/b.txt", entries[0].Name)
+	a.Equal("foo/a.txt", entries[1].Name)
+	a.Equal(int64(len("foo/a.txt")), entries[1].Size)
+	a.True(entries[0].DeletedAt.After(entries[1].DeletedAt))
+
+	a.NoError(bucket.Restore(ctx, entries[1].ID, "foo/a.txt"))
+	write(t, bucket, "foo/b.txt")
+	a.True(errors.Is(bucket.Restore(ctx, entries[0].ID, "/"), os.ErrExist))
+
+	a.NoError(bucket.Remove(ctx, "foo/b.txt"))
+	a.NoError(bucket.Restore(ctx, entries[0].ID, "/"))
+	a.Equal([]string{"foo", "foo/a.txt", "foo/b.txt"}, walkNames(t, bucket))
+
+	entries, err = bucket.ListTrash(ctx)
+	if a.NoError(err) && a.Len(entries, 1) {
+		a.Equal("foo/b.txt", entries[0].Name)
+	}
+}
+
+func TestBucket_RemoveAll(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent)
+	write(t, bucket, "foo/a.txt", "bar.txt")
+
+	a.NoError(bucket.RemoveAll(ctx, "/"))
+	a.Empty(walkNames(t, bucket))
+
+	entries, err := bucket.ListTrash(ctx)
+	if !a.NoError(err) || !a.Len(entries, 2) {
+		return
+	}
+
+	a.Equal(entries[0].ID, entries[1].ID)
+
+	exists, err := parent.Exists(ctx, "/.trash/"+entries[0].ID+"/foo/a.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	_, err = bucket.Stat(ctx, "/.trash")
+	a.True(os.IsNotExist(err))
+
+	_, err = bucket.Write(ctx, "/.trash/foo.txt", []byte("forged"))
+	a.Error(err)
+
+	a.NoError(bucket.Restore(ctx, entries[0].ID, ""))
+	a.Equal([]string{"bar.txt", "foo", "foo/a.txt"}, walkNames(t, bucket))
+	a.Equal([]string{".trash", "bar.txt", "foo", "foo/a.txt"}, walkNames(t, parent))
+}
+
+func TestBucket_EmptyTrash(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent, trash.WithTrashDir("deleted"))
+	write(t, bucket, "foo.txt", "bar.txt")
+
+	a.NoError(bucket.Remove(ctx, "foo.txt"))
+	a.NoError(bucket.Remove(ctx, "bar.txt"))
+
+	deleted, err := bucket.EmptyTrash(ctx, time.Hour)
+	if a.NoError(err) {
+		a.Equal(0, deleted)
+	}
+
+	deleted, err = bucket.EmptyTrash(ctx, 0)
+	if a.NoError(err) {
+		a.Equal(2, deleted)
+	}
+
+	entries, err := bucket.ListTrash(ctx)
+	if a.NoError(err) {
+		a.Empty(entries)
+	}
+
+	a.Equal([]string{"deleted"}, walkNames(t, parent))
+}
+
+func TestBucket_Local(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "bucketly-trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	parent := local.NewBucket(dir)
+	bucket := newBucket(t, parent)
+	write(t, bucket, "foo/a.txt", "foo/b.txt", "bar.txt")
+
+	a.NoError(bucket.Remove(ctx, "foo/a.txt"))
+	a.NoError(bucket.RemoveAll(ctx, "foo"))
+	a.NoError(bucket.RemoveAll(ctx, "/"))
+
+	exists, err := bucket.Exists(ctx, "bar.txt")
+	if a.NoError(err) {
+		a.False(exists)
+	}
+
+	entries, err := bucket.ListTrash(ctx)
+	if !a.NoError(err) || !a.Len(entries, 3) {
+		return
+	}
+
+	a.Equal("bar.txt", entries[0].Name)
+	a.Equal("foo/b.txt", entries[1].Name)
+	a.Equal("foo/a.txt", entries[2].Name)
+
+	exists, err = parent.Exists(ctx, "/.trash/"+entries[2].ID+"/foo/a.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	for _, entry := range entries {
+		a.NoError(bucket.Restore(ctx, entry.ID, entry.Name), entry.Name)
+	}
+
+	for _, name := range []string{"foo/a.txt", "foo/b.txt", "bar.txt"} {
+		content, err := bucket.Read(ctx, name)
+		if a.NoError(err, name) {
+			a.Equal([]byte(name), content)
+		}
+	}
+
+	entries, err = bucket.ListTrash(ctx)
+	if a.NoError(err) {
+		a.Empty(entries)
+	}
+}
+
+func TestNewBucket_InvalidTrashDir(t *testing.T) {
+	for _, dir := range []string{"", "/", "..", "foo/../bar"} {
+		_, err := trash.NewBucket(memory.NewBucket("parent"), trash.WithTrashDir(dir))
+		assert.Error(t, err, dir)
+	}
+}
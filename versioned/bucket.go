@@ -0,0 +1,771 @@
+package versioned
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistoryDir = "~versions"
+	// versionPrefix starts the names of the versions in the history directory of an item, followed
+	// by the version id.
+	versionPrefix = "~v"
+	versionIDSize = 20
+)
+
+var errInvalidVersion = errors.New("invalid version id")
+
+type (
+	// Bucket keeps the previous revisions of the items of the wrapped bucket. Before an item is
+	// overwritten, removed or renamed its current content is copied to the history directory, under
+	// <history dir>/<name>/~v<id>. The version ids are the times the revisions were archived, so
+	// they sort from the oldest to the newest. The history directory is hidden and can't be changed
+	// through the bucket.
+	Bucket struct {
+		bucket bucketly.Bucket
+		config Config
+		mu     sync.Mutex
+		lastID int64
+	}
+
+	Config struct {
+		historyDir  string
+		maxVersions int
+	}
+
+	Option func(cfg *Config)
+
+	// Version is a previous revision of an item.
+	Version struct {
+		ID   string
+		Name string
+		Size int64
+		// Time is when the revision was replaced or removed.
+		Time time.Time
+	}
+
+	listIterator struct {
+		bucket *Bucket
+		it     bucketly.ListIterator
+	}
+
+	// revision is a revision archived before a change. It is dropped again when the change fails
+	// and leaves the item as it was.
+	revision struct {
+		key  string
+		path string
+		item bucketly.Item
+	}
+
+	// writer keeps or drops the revision archived by NewWriter once the content is committed.
+	writer struct {
+		io.WriteCloser
+		ctx       context.Context
+		bucket    *Bucket
+		revisions []*revision
+	}
+)
+
+// WithHistoryDir sets the directory holding the previous revisions, "~versions" by default. It
+// must be a clean path and can't start with a dot, the leading dots are trimmed from the item
+// names.
+func WithHistoryDir(dir string) Option {
+	return func(cfg *Config) {
+		cfg.historyDir = dir
+	}
+}
+
+// WithMaxVersions sets the number of previous revisions kept for every item, the oldest ones are
+// purged when new ones are archived. All of them are kept by default.
+func WithMaxVersions(n int) Option {
+	return func(cfg *Config) {
+		cfg.maxVersions = n
+	}
+}
+
+func NewBucket(b bucketly.Bucket, opts ...Option) (*Bucket, error) {
+	cfg := Config{
+		historyDir: defaultHistoryDir,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	dir, err := bucketly.Sanitize(b, cfg.historyDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// a directory changed by the sanitization would hide another one than asked
+	dir = strings.Trim(dir, string(b.PathSeparator()))
+	if dir == "" || dir != strings.Trim(cfg.historyDir, string(b.PathSeparator())) {
+		return nil, fmt.Errorf("invalid history directory %s", cfg.historyDir)
+	}
+
+	if cfg.maxVersions < 0 {
+		return nil, fmt.Errorf("invalid max versions %d", cfg.maxVersions)
+	}
+
+	cfg.historyDir = dir
+
+	return &Bucket{
+		bucket: b,
+		config: cfg,
+	}, nil
+}
+
+func (b *Bucket) Parent() bucketly.Bucket {
+	return b.bucket
+}
+
+// StoresMetadata reports whether the wrapped bucket keeps the metadata of the items.
+func (b *Bucket) StoresMetadata() bool {
+	return bucketly.StoresMetadata(b.bucket)
+}
+
+func (b *Bucket) Name() string {
+	return b.bucket.Name()
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return b.bucket.PathSeparator()
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	return b.bucket.Read(ctx, name)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	return b.bucket.NewReader(ctx, name)
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return 0, err
+	}
+
+	revisions, err := b.archive(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := b.bucket.Write(ctx, name, data, opts...)
+
+	return n, b.commit(ctx, revisions, err)
+}
+
+// NewWriter archives the current revision of the item before returning the writer. The revision is
+// dropped again when closing the writer fails and leaves the item as it was.
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := b.archive(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := b.bucket.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return nil, b.commit(ctx, revisions, err)
+	}
+
+	return &writer{
+		WriteCloser: w,
+		ctx:         ctx,
+		bucket:      b,
+		revisions:   revisions,
+	}, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	if b.hidden(name) {
+		return false, nil
+	}
+
+	return b.bucket.Exists(ctx, name)
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := b.archive(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return b.commit(ctx, revisions, b.bucket.Remove(ctx, name))
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	item, err := b.bucket.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.newItem(item), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	if _, err := b.key(name); err != nil {
+		return err
+	}
+
+	return b.bucket.Mkdir(ctx, name, opts...)
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	if _, err := b.key(name); err != nil {
+		return err
+	}
+
+	return b.bucket.MkdirAll(ctx, name, opts...)
+}
+
+func (b *Bucket) Chmod(ctx context.Context, name string, mode os.FileMode) error {
+	if _, err := b.key(name); err != nil {
+		return err
+	}
+
+	return b.bucket.Chmod(ctx, name, mode)
+}
+
+// RemoveAll archives the items under the directory before removing it. The history is kept when
+// the root directory is removed.
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := b.archiveAll(ctx, key, key)
+	if err != nil {
+		return err
+	}
+
+	return b.commit(ctx, revisions, b.removeAll(ctx, key))
+}
+
+// Rename archives the item, or the items under the directory, and the items it overwrites.
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromKey, err := b.key(from)
+	if err != nil {
+		return err
+	}
+
+	toKey, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := b.archiveAll(ctx, fromKey, toKey)
+	if err != nil {
+		return err
+	}
+
+	moved, err := b.archiveAll(ctx, fromKey, fromKey)
+	if err != nil {
+		b.rollback(ctx, revisions)
+
+		return err
+	}
+
+	return b.commit(ctx, append(revisions, moved...), b.bucket.Rename(ctx, from, to, opts...))
+}
+
+// Copy archives the item it overwrites. An item of the bucket is copied by the wrapped bucket.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	key, err := b.key(to)
+	if err != nil {
+		return err
+	}
+
+	if from.Bucket() == bucketly.Bucket(b) {
+		item, err := b.bucket.Stat(ctx, from.Name())
+		if err != nil {
+			return err
+		}
+
+		from = item
+	}
+
+	revisions, err := b.archive(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return b.commit(ctx, revisions, b.bucket.Copy(ctx, from, to, opts...))
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+// Walk walks the wrapped bucket without the history directory.
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	if b.hidden(dir) {
+		return nil
+	}
+
+	w, ok := b.bucket.(bucketly.Walkable)
+	if !ok {
+		return bucketly.ErrNotSupported
+	}
+
+	return w.Walk(ctx, dir, func(item bucketly.Item, err error) error {
+		if item == nil {
+			return walkFunc(item, err)
+		}
+
+		if b.hidden(item.Name()) {
+			return bucketly.ErrSkipWalkDir
+		}
+
+		return walkFunc(b.newItem(item), err)
+	})
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	if b.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	l, ok := b.bucket.(bucketly.Listable)
+	if !ok {
+		return nil, bucketly.ErrNotSupported
+	}
+
+	it, err := l.Items(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		bucket: b,
+		it:     it,
+	}, nil
+}
+
+// Versions returns the previous revisions of the item, from the newest to the oldest.
+func (b *Bucket) Versions(ctx context.Context, name string) ([]Version, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := bucketly.ListDir(ctx, b.bucket, b.historyPath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, item := range items {
+		base := bucketly.Base(b.bucket, item.Name())
+		if item.IsDir() || !strings.HasPrefix(base, versionPrefix) {
+			continue
+		}
+
+		id := strings.TrimPrefix(base, versionPrefix)
+		t, err := parseID(id)
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, Version{
+			ID:   id,
+			Name: key,
+			Size: item.Size(),
+			Time: t,
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+
+	return versions, nil
+}
+
+func (b *Bucket) OpenVersion(ctx context.Context, name string, id string) (io.ReadCloser, error) {
+	path, err := b.versionPath(name, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.bucket.NewReader(ctx, path)
+}
+
+func (b *Bucket) ReadVersion(ctx context.Context, name string, id string) ([]byte, error) {
+	r, err := b.OpenVersion(ctx, name, id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// Restore makes the version the current revision of the item. The replaced revision is archived.
+func (b *Bucket) Restore(ctx context.Context, name string, id string) error {
+	path, err := b.versionPath(name, id)
+	if err != nil {
+		return err
+	}
+
+	item, err := b.bucket.Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	key, _ := b.key(name)
+	revisions, err := b.archive(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return b.commit(ctx, revisions, b.bucket.Copy(ctx, item, key))
+}
+
+func (b *Bucket) DeleteVersion(ctx context.Context, name string, id string) error {
+	path, err := b.versionPath(name, id)
+	if err != nil {
+		return err
+	}
+
+	return b.bucket.Remove(ctx, path)
+}
+
+// Purge deletes the previous revisions of the item but the newest ones to keep. It returns the
+// number of deleted revisions.
+func (b *Bucket) Purge(ctx context.Context, name string, keep int) (int, error) {
+	versions, err := b.Versions(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if keep < 0 {
+		keep = 0
+	}
+
+	purged := 0
+	for i := keep; i < len(versions); i++ {
+		if err := b.DeleteVersion(ctx, name, versions[i].ID); err != nil {
+			return purged, err
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+// archive copies the current revision of the file to the history directory. The revisions over the
+// limit are only purged by commit, once the change succeeded.
+func (b *Bucket) archive(ctx context.Context, key string) ([]*revision, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	item, err := b.bucket.Stat(ctx, key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if item.IsDir() {
+		return nil, nil
+	}
+
+	path := b.join(b.historyPath(key), versionPrefix+b.nextID())
+	if err := b.bucket.Copy(ctx, item, path); err != nil {
+		return nil, err
+	}
+
+	return []*revision{{key: key, path: path, item: item}}, nil
+}
+
+// archiveAll archives the files under the directory with their names moved to the destination.
+func (b *Bucket) archiveAll(ctx context.Context, dir string, dest string) ([]*revision, error) {
+	item, err := b.bucket.Stat(ctx, b.layerName(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if !item.IsDir() {
+		return b.archive(ctx, dest)
+	}
+
+	var keys []string
+	err = b.Walk(ctx, b.layerName(dir), func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !item.IsDir() {
+			key, _ := b.key(item.Name())
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []*revision
+	for _, key := range keys {
+		if dest != dir {
+			key = b.join(dest, strings.TrimPrefix(strings.TrimPrefix(key, dir), string(b.PathSeparator())))
+		}
+
+		archived, err := b.archive(ctx, key)
+		if err != nil {
+			b.rollback(ctx, revisions)
+
+			return nil, err
+		}
+
+		revisions = append(revisions, archived...)
+	}
+
+	return revisions, nil
+}
+
+// commit purges the revisions over the limit once the change succeeded, or rolls back the archived
+// revisions when it failed.
+func (b *Bucket) commit(ctx context.Context, revisions []*revision, err error) error {
+	if err != nil {
+		b.rollback(ctx, revisions)
+
+		return err
+	}
+
+	if b.config.maxVersions == 0 {
+		return nil
+	}
+
+	for _, r := range revisions {
+		if _, err := b.Purge(ctx, r.key, b.config.maxVersions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollback drops the archived revisions of the items left as they were. A revision of an item the
+// failed change modified anyway is kept, it is the only copy of the previous content.
+func (b *Bucket) rollback(ctx context.Context, revisions []*revision) {
+	for _, r := range revisions {
+		item, err := b.bucket.Stat(ctx, r.key)
+		if err != nil || !sameRevision(item, r.item) {
+			continue
+		}
+
+		b.bucket.Remove(ctx, r.path)
+	}
+}
+
+// removeAll removes the directory, the history is kept when it is the root directory.
+func (b *Bucket) removeAll(ctx context.Context, key string) error {
+	if key != "" {
+		return b.bucket.RemoveAll(ctx, key)
+	}
+
+	items, err := b.readDir(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := b.bucket.RemoveAll(ctx, item.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDir returns the items of the directory without the history directory.
+func (b *Bucket) readDir(ctx context.Context, key string) ([]bucketly.Item, error) {
+	items, err := bucketly.ListDir(ctx, b.bucket, b.layerName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	visible := items[:0]
+	for _, item := range items {
+		if !b.hidden(item.Name()) {
+			visible = append(visible, item)
+		}
+	}
+
+	return visible, nil
+}
+
+// key turns a path into a key without leading or trailing separators, the root directory has the
+// empty key. It fails when the path is in the history directory.
+func (b *Bucket) key(name string) (string, error) {
+	key, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	key = strings.Trim(key, string(b.PathSeparator()))
+	if b.isHistory(key) {
+		return "", fmt.Errorf("%s: %s is a reserved name", name, b.config.historyDir)
+	}
+
+	return key, nil
+}
+
+func (b *Bucket) hidden(name string) bool {
+	key, err := bucketly.Sanitize(b, name)
+
+	return err == nil && b.isHistory(key)
+}
+
+func (b *Bucket) isHistory(key string) bool {
+	key = strings.Trim(key, string(b.PathSeparator()))
+
+	return key == b.config.historyDir || strings.HasPrefix(key, b.config.historyDir+string(b.PathSeparator()))
+}
+
+func (b *Bucket) historyPath(key string) string {
+	return b.join(b.config.historyDir, key)
+}
+
+func (b *Bucket) versionPath(name string, id string) (string, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := parseID(id); err != nil {
+		return "", err
+	}
+
+	return b.join(b.historyPath(key), versionPrefix+id), nil
+}
+
+func (b *Bucket) join(dir, base string) string {
+	if dir == "" {
+		return base
+	}
+
+	return dir + string(b.PathSeparator()) + base
+}
+
+func (b *Bucket) layerName(key string) string {
+	if key == "" {
+		return string(b.PathSeparator())
+	}
+
+	return key
+}
+
+// nextID returns a version id greater than the previous ones.
+func (b *Bucket) nextID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := time.Now().UnixNano()
+	if id <= b.lastID {
+		id = b.lastID + 1
+	}
+	b.lastID = id
+
+	return fmt.Sprintf("%0*d", versionIDSize, id)
+}
+
+// newItem rebinds an item of the wrapped bucket.
+func (b *Bucket) newItem(from bucketly.Item) bucketly.Item {
+	return bucketly.RebindItem(b, from.Name(), from)
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	for {
+		item, err := i.it.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !i.bucket.hidden(item.Name()) {
+			return i.bucket.newItem(item), nil
+		}
+	}
+}
+
+func (i *listIterator) Close() error {
+	return i.it.Close()
+}
+
+func (w *writer) Close() error {
+	return w.bucket.commit(w.ctx, w.revisions, w.WriteCloser.Close())
+}
+
+func parseID(id string) (time.Time, error) {
+	if len(id) != versionIDSize {
+		return time.Time{}, fmt.Errorf("%w %s", errInvalidVersion, id)
+	}
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, fmt.Errorf("%w %s", errInvalidVersion, id)
+	}
+
+	return time.Unix(0, n), nil
+}
@@ -0,0 +1,227 @@
+package versioned_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/local"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/versioned"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newBucket(t *testing.T, b bucketly.Bucket, opts ...versioned.Option) *versioned.Bucket {
+	bucket, err := versioned.NewBucket(b, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func write(t *testing.T, bucket bucketly.Bucket, name string, contents ...string) {
+	for _, content := range contents {
+		if _, err := bucket.Write(context.Background(), name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func versionContents(t *testing.T, bucket *versioned.Bucket, name string) []string {
+	ctx := context.Background()
+	versions, err := bucket.Versions(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []string
+	for _, version := range versions {
+		content, err := bucket.ReadVersion(ctx, name, version.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents = append(contents, string(content))
+	}
+
+	return contents
+}
+
+func TestBucket_Versions(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	bucket := newBucket(t, memory.NewBucket("parent"))
+	write(t, bucket, "config.yaml", "v1", "v2", "v3")
+
+	content, err := bucket.Read(ctx, "config.yaml")
+	if a.NoError(err) {
+		a.Equal([]byte("v3"), content)
+	}
+
+	a.Equal([]string{"v2", "v1"}, versionContents(t, bucket, "config.yaml"))
+
+	versions, err := bucket.Versions(ctx, "config.yaml")
+	if a.NoError(err) && a.Len(versions, 2) {
+		a.Equal("config.yaml", versions[0].Name)
+		a.Equal(int64(2), versions[0].Size)
+		a.True(versions[0].Time.After(versions[1].Time))
+	}
+
+	a.NoError(bucket.Remove(ctx, "config.yaml"))
+	a.Equal([]string{"v3", "v2", "v1"}, versionContents(t, bucket, "config.yaml"))
+
+	versions, _ = bucket.Versions(ctx, "config.yaml")
+	a.NoError(bucket.Restore(ctx, "config.yaml", versions[1].ID))
+
+	content, err = bucket.Read(ctx, "config.yaml")
+	if a.NoError(err) {
+		a.Equal([]byte("v2"), content)
+	}
+
+	purged, err := bucket.Purge(ctx, "config.yaml", 1)
+	if a.NoError(err) {
+		a.Equal(2, purged)
+	}
+	a.Equal([]string{"v3"}, versionContents(t, bucket, "config.yaml"))
+}
+
+func TestBucket_Local(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "bucketly-versioned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bucket := newBucket(t, local.NewBucket(dir))
+	write(t, bucket, "config/app.yaml", "v1", "v2", "v3")
+
+	content, err := bucket.Read(ctx, "config/app.yaml")
+	if a.NoError(err) {
+		a.Equal([]byte("v3"), content)
+	}
+
+	a.Equal([]string{"v2", "v1"}, versionContents(t, bucket, "config/app.yaml"))
+
+	a.NoError(bucket.Remove(ctx, "config/app.yaml"))
+	a.Equal([]string{"v3", "v2", "v1"}, versionContents(t, bucket, "config/app.yaml"))
+
+	versions, err := bucket.Versions(ctx, "config/app.yaml")
+	if a.NoError(err) && a.Len(versions, 3) {
+		a.NoError(bucket.Restore(ctx, "config/app.yaml", versions[2].ID))
+	}
+
+	content, err = bucket.Read(ctx, "config/app.yaml")
+	if a.NoError(err) {
+		a.Equal([]byte("v1"), content)
+	}
+
+	var names []string
+	err = bucket.Walk(ctx, "/", func(item bucketly.Item, err error) error {
+		if err != nil {
+			return err
+		}
+
+		names = append(names, item.Name())
+
+		return nil
+	})
+	if a.NoError(err) {
+		a.Contains(names, "config/app.yaml")
+		for _, name := range names {
+			a.False(strings.HasPrefix(name, "~versions"), name)
+		}
+	}
+
+	purged, err := bucket.Purge(ctx, "config/app.yaml", 1)
+	if a.NoError(err) {
+		a.Equal(2, purged)
+	}
+}
+
+func TestBucket_History(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := memory.NewBucket("parent")
+	bucket := newBucket(t, parent)
+	write(t, bucket, "foo/a.txt", "a1", "a2")
+	write(t, bucket, "foo/b.txt", "b1")
+	write(t, bucket, "bar/b.txt", "bar")
+
+	a.NoError(bucket.Rename(ctx, "bar/b.txt", "foo/b.txt"))
+	a.Equal([]string{"b1"}, versionContents(t, bucket, "foo/b.txt"))
+	a.Equal([]string{"bar"}, versionContents(t, bucket, "bar/b.txt"))
+
+	var names []string
+	err := bucket.Walk(ctx, "/", func(item bucketly.Item, err error) error {
+		names = append(names, item.Name())
+
+		return err
+	})
+	if a.NoError(err) {
+		a.Equal([]string{"bar", "foo", "foo/a.txt", "foo/b.txt"}, names)
+	}
+
+	exists, err := parent.Exists(ctx, "~versions/foo/a.txt")
+	if a.NoError(err) {
+		a.True(exists)
+	}
+
+	_, err = bucket.Stat(ctx, "~versions/foo/a.txt")
+	a.True(os.IsNotExist(err))
+
+	_, err = bucket.Write(ctx, "~versions/foo/a.txt", []byte("forged"))
+	a.Error(err)
+
+	a.NoError(bucket.RemoveAll(ctx, "/"))
+	a.Equal([]string{"a2", "a1"}, versionContents(t, bucket, "foo/a.txt"))
+}
+
+func TestBucket_MaxVersions(t *testing.T) {
+	a := assert.New(t)
+	bucket := newBucket(t, memory.NewBucket("parent"), versioned.WithMaxVersions(2))
+	write(t, bucket, "foo.txt", "1", "2", "3", "4", "5")
+
+	a.Equal([]string{"4", "3"}, versionContents(t, bucket, "foo.txt"))
+}
+
+// failingBucket fails the writes without changing the item.
+type failingBucket struct {
+	*memory.Bucket
+}
+
+func (b *failingBucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestBucket_FailedWrite(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	parent := &failingBucket{Bucket: memory.NewBucket("parent")}
+	if _, err := parent.Bucket.Write(ctx, "foo.txt", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := newBucket(t, parent, versioned.WithMaxVersions(1))
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("v2"))
+	a.Error(err)
+	a.Empty(versionContents(t, bucket, "foo.txt"))
+
+	content, err := bucket.Read(ctx, "foo.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("v1"), content)
+	}
+}
+
+func TestNewBucket_InvalidHistoryDir(t *testing.T) {
+	for _, dir := range []string{"", "/", ".versions", "foo/../bar"} {
+		_, err := versioned.NewBucket(memory.NewBucket("parent"), versioned.WithHistoryDir(dir))
+		assert.Error(t, err, dir)
+	}
+}
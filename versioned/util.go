@@ -0,0 +1,21 @@
+package versioned
+
+import (
+	"github.com/vcraescu/bucketly"
+)
+
+// sameRevision reports whether the items hold the same revision.
+func sameRevision(item bucketly.Item, other bucketly.Item) bool {
+	if item.IsDir() != other.IsDir() || item.Size() != other.Size() || !item.ModTime().Equal(other.ModTime()) {
+		return false
+	}
+
+	etag, err := item.ETag()
+	if err != nil {
+		return false
+	}
+
+	otherETag, err := other.ETag()
+
+	return err == nil && etag == otherETag
+}
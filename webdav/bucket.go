@@ -0,0 +1,859 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const pathSeparator rune = '/'
+
+type (
+	Bucket struct {
+		name     string
+		config   Config
+		endpoint *url.URL
+		client   *http.Client
+	}
+
+	Config struct {
+		endpoint   string
+		user       string
+		password   string
+		httpClient *http.Client
+	}
+
+	Option func(cfg *Config)
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+
+	writer struct {
+		pw   *io.PipeWriter
+		done chan error
+		err  error
+	}
+)
+
+// WithEndpoint sets the URL of the WebDAV share, e.g. https://cloud.example.com/remote.php/dav/files/user/.
+func WithEndpoint(endpoint string) Option {
+	return func(cfg *Config) {
+		cfg.endpoint = endpoint
+	}
+}
+
+func WithUser(user string) Option {
+	return func(cfg *Config) {
+		cfg.user = user
+	}
+}
+
+func WithPassword(password string) Option {
+	return func(cfg *Config) {
+		cfg.password = password
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *Config) {
+		cfg.httpClient = client
+	}
+}
+
+// NewBucket returns a bucket rooted at the collection with the given name under the endpoint.
+func NewBucket(name string, opts ...Option) (*Bucket, error) {
+	cfg := Config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.endpoint == "" {
+		return nil, errors.New("webdav endpoint is missing")
+	}
+
+	endpoint, err := url.Parse(cfg.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing endpoint: %w", err)
+	}
+
+	client := cfg.httpClient
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Bucket{
+		name:     name,
+		config:   cfg,
+		endpoint: endpoint,
+		client:   client,
+	}, nil
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	resp, err := b.do(ctx, http.MethodGet, b.url(item.Name(), false), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		drain(resp)
+
+		return nil, responseError(resp)
+	}
+
+	return resp.Body, nil
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	if isDirPath(name) {
+		return 0, fmt.Errorf("%s is a directory", name)
+	}
+
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, name)); err != nil {
+		return 0, err
+	}
+
+	if err := b.put(ctx, name, bytes.NewReader(data), wo.Metadata); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (b *Bucket) NewWriter(ctx context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	if isDirPath(name) {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, name)); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	w := &writer{
+		pw:   pw,
+		done: make(chan error, 1),
+	}
+
+	go func() {
+		err := b.put(ctx, name, pr, wo.Metadata)
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(ctx context.Context, name string) error {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	if name == string(pathSeparator) {
+		return fmt.Errorf("%s: cannot remove root directory", name)
+	}
+
+	return b.delete(ctx, name)
+}
+
+func (b *Bucket) Stat(ctx context.Context, name string) (bucketly.Item, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := b.propfind(ctx, name, "0")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responses) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return b.responseToItem(name, responses[0]), nil
+}
+
+func (b *Bucket) Mkdir(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.mkcol(ctx, name); err != nil {
+		return err
+	}
+
+	if wo.Metadata != nil {
+		return b.setMetadata(ctx, name, wo.Metadata)
+	}
+
+	return nil
+}
+
+func (b *Bucket) MkdirAll(ctx context.Context, name string, opts ...bucketly.WriteOption) error {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	if name == string(pathSeparator) {
+		return b.Mkdir(ctx, name, opts...)
+	}
+
+	var current []string
+	for _, token := range strings.Split(name, string(pathSeparator)) {
+		current = append(current, token)
+		if err := b.Mkdir(ctx, strings.Join(current, string(pathSeparator)), opts...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) RemoveAll(ctx context.Context, name string) error {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return err
+	}
+
+	if name != string(pathSeparator) {
+		err := b.delete(ctx, name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	items, err := b.readDir(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, item := range items {
+		if err := b.delete(ctx, item.Name()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) Rename(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	from, err := bucketly.Sanitize(b, from)
+	if err != nil {
+		return err
+	}
+
+	to, err = bucketly.Sanitize(b, to)
+	if err != nil {
+		return err
+	}
+
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, to)); err != nil {
+		return err
+	}
+
+	if err := b.copyMove(ctx, "MOVE", b, from, to); err != nil {
+		return err
+	}
+
+	if co.Metadata != nil {
+		return b.setMetadata(ctx, to, co.Metadata)
+	}
+
+	return nil
+}
+
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		return b.MkdirAll(ctx, to)
+	}
+
+	to, err := bucketly.Sanitize(b, to)
+	if err != nil {
+		return err
+	}
+
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, to)); err != nil {
+		return err
+	}
+
+	if src, ok := from.Bucket().(*Bucket); ok && src.sameServer(b) {
+		fromName, err := bucketly.Sanitize(src, from.Name())
+		if err != nil {
+			return err
+		}
+
+		if err := src.copyMove(ctx, "COPY", b, fromName, to); err != nil {
+			return err
+		}
+
+		if co.Metadata != nil {
+			return b.setMetadata(ctx, to, co.Metadata)
+		}
+
+		return nil
+	}
+
+	if co.Metadata == nil {
+		metadata, err := from.Metadata()
+		if err != nil {
+			return err
+		}
+
+		co.Metadata = metadata
+	}
+
+	r, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := b.NewWriter(ctx, to, bucketly.WithWriteMetadata(co.Metadata))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.(*writer).abort(err)
+
+		return err
+	}
+
+	return w.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	if err := b.MkdirAll(ctx, bucketly.Dir(b, strings.TrimRight(to, string(b.PathSeparator())))); err != nil {
+		return err
+	}
+
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(ctx, item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	items, err := b.readDir(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(ctx, item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) readDir(ctx context.Context, dir string) ([]bucketly.Item, error) {
+	responses, err := b.propfind(ctx, dir, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	self := strings.TrimRight(b.path(dir), string(pathSeparator))
+	items := make([]bucketly.Item, 0, len(responses))
+	for _, resp := range responses {
+		p, err := hrefPath(resp.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		p = strings.TrimRight(p, string(pathSeparator))
+		if p == self {
+			continue
+		}
+
+		name := strings.TrimLeft(bucketly.Join(b, dir, path.Base(p)), string(b.PathSeparator()))
+		items = append(items, b.responseToItem(name, resp))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name() < items[j].Name()
+	})
+
+	return items, nil
+}
+
+func (b *Bucket) propfind(ctx context.Context, name string, depth string) ([]response, error) {
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := b.do(ctx, "PROPFIND", b.url(name, depth != "0"), strings.NewReader(propfindBody), header)
+	if err != nil {
+		return nil, err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, responseError(resp)
+	}
+
+	return parseMultistatus(resp.Body)
+}
+
+func (b *Bucket) put(ctx context.Context, name string, body io.Reader, metadata bucketly.Metadata) error {
+	resp, err := b.do(ctx, http.MethodPut, b.url(name, false), body, nil)
+	if err != nil {
+		return err
+	}
+	drain(resp)
+
+	if !isSuccess(resp.StatusCode) {
+		if resp.StatusCode == http.StatusConflict {
+			return os.ErrNotExist
+		}
+
+		return responseError(resp)
+	}
+
+	if metadata != nil {
+		return b.setMetadata(ctx, name, metadata)
+	}
+
+	return nil
+}
+
+func (b *Bucket) mkcol(ctx context.Context, name string) error {
+	resp, err := b.do(ctx, "MKCOL", b.url(name, true), nil, nil)
+	if err != nil {
+		return err
+	}
+	drain(resp)
+
+	switch {
+	case isSuccess(resp.StatusCode):
+		return nil
+	case resp.StatusCode == http.StatusConflict:
+		return os.ErrNotExist
+	case resp.StatusCode != http.StatusMethodNotAllowed:
+		return responseError(resp)
+	}
+
+	// the collection or a file with the same name already exists
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if !item.IsDir() {
+		return fmt.Errorf("%s is not a directory", name)
+	}
+
+	return nil
+}
+
+func (b *Bucket) delete(ctx context.Context, name string) error {
+	resp, err := b.do(ctx, http.MethodDelete, b.url(name, false), nil, nil)
+	if err != nil {
+		return err
+	}
+	drain(resp)
+
+	if !isSuccess(resp.StatusCode) {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// copyMove issues a COPY or MOVE of from onto the name to of the dest bucket, which must live on the same server.
+func (b *Bucket) copyMove(ctx context.Context, method string, dest *Bucket, from string, to string) error {
+	header := http.Header{}
+	header.Set("Destination", dest.url(to, false))
+	header.Set("Overwrite", "T")
+	if method == "COPY" {
+		header.Set("Depth", "0")
+	}
+
+	resp, err := b.do(ctx, method, b.url(from, false), nil, header)
+	if err != nil {
+		return err
+	}
+	drain(resp)
+
+	if !isSuccess(resp.StatusCode) {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// setMetadata replaces the metadata of the item with the given one.
+func (b *Bucket) setMetadata(ctx context.Context, name string, metadata bucketly.Metadata) error {
+	item, err := b.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	current, err := item.Metadata()
+	if err != nil {
+		return err
+	}
+
+	var remove []string
+	for k := range current {
+		if _, ok := metadata[k]; !ok {
+			remove = append(remove, k)
+		}
+	}
+	sort.Strings(remove)
+
+	if len(metadata) == 0 && len(remove) == 0 {
+		return nil
+	}
+
+	body, err := proppatchBody(metadata, remove)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := b.do(ctx, "PROPPATCH", b.url(name, item.IsDir()), bytes.NewReader(body), header)
+	if err != nil {
+		return err
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return responseError(resp)
+	}
+
+	responses, err := parseMultistatus(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range responses {
+		for _, ps := range r.Propstats {
+			if !isSuccess(parseStatus(ps.Status)) {
+				return fmt.Errorf(`error updating metadata of "%s": %s`, name, ps.Status)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) do(ctx context.Context, method string, u string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if b.config.user != "" || b.config.password != "" {
+		req.SetBasicAuth(b.config.user, b.config.password)
+	}
+
+	return b.client.Do(req)
+}
+
+// path returns the absolute path on the server of a sanitized name.
+func (b *Bucket) path(name string) string {
+	return path.Join("/", b.endpoint.Path, b.name, name)
+}
+
+func (b *Bucket) url(name string, dir bool) string {
+	u := *b.endpoint
+	u.Path = b.path(name)
+	u.RawPath = ""
+	if dir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	return u.String()
+}
+
+func (b *Bucket) sameServer(other *Bucket) bool {
+	return b.endpoint.Scheme == other.endpoint.Scheme &&
+		b.endpoint.Host == other.endpoint.Host &&
+		b.config.user == other.config.user
+}
+
+func (b *Bucket) responseToItem(name string, resp response) bucketly.Item {
+	item := bucketly.NewItem(b, name)
+	metadata := make(bucketly.Metadata)
+
+	for _, ps := range resp.Propstats {
+		if parseStatus(ps.Status) != http.StatusOK {
+			continue
+		}
+
+		p := ps.Prop
+		if p.ResourceType.Collection != nil {
+			item.SetDir(true)
+		}
+
+		if p.ContentLength != "" {
+			if size, err := strconv.ParseInt(p.ContentLength, 10, 64); err == nil {
+				item.SetSize(size)
+			}
+		}
+
+		if p.LastModified != "" {
+			if t, err := http.ParseTime(p.LastModified); err == nil {
+				item.SetModeTime(t)
+			}
+		}
+
+		if p.ETag != "" {
+			item.SetETag(p.ETag)
+		}
+
+		for _, a := range p.Any {
+			if a.XMLName.Space == metadataNamespace {
+				metadata[a.XMLName.Local] = a.Value
+			}
+		}
+	}
+
+	item.SetMetadata(metadata)
+
+	return item
+}
+
+func hrefPath(href string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf(`error parsing href "%s": %w`, href, err)
+	}
+
+	return u.Path, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.done == nil {
+		return w.err
+	}
+
+	w.pw.Close()
+	w.err = <-w.done
+	w.done = nil
+
+	return w.err
+}
+
+// abort fails the upload before the request body is complete.
+func (w *writer) abort(err error) {
+	w.pw.CloseWithError(err)
+	if w.done != nil {
+		<-w.done
+		w.done = nil
+	}
+	w.err = err
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		i.queue, err = i.bucket.readDir(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package webdav_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/webdav"
+	xwebdav "golang.org/x/net/webdav"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newServer() *httptest.Server {
+	handler := &xwebdav.Handler{
+		Prefix:     "/remote.php/dav",
+		FileSystem: xwebdav.NewMemFS(),
+		LockSystem: xwebdav.NewMemLS(),
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "bucketly" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+func newBucket(t *testing.T, server *httptest.Server, name string) *webdav.Bucket {
+	bucket, err := webdav.NewBucket(
+		name,
+		webdav.WithEndpoint(server.URL+"/remote.php/dav"),
+		webdav.WithUser("bucketly"),
+		webdav.WithPassword("secret"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := webdav.NewBucketManager(bucket).Create(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return bucket
+}
+
+func TestBucket_Metadata(t *testing.T) {
+	a := assert.New(t)
+	server := newServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	bucket := newBucket(t, server, "files/bucketly")
+
+	_, err := bucket.Write(ctx, "foo/bar.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{
+		"owner": "bucketly",
+		"tag":   "<a & b>",
+	}))
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err := bucket.Stat(ctx, "foo/bar.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal(int64(5), item.Size())
+	a.False(item.ModTime().IsZero())
+
+	etag, err := item.ETag()
+	if a.NoError(err) {
+		a.NotEmpty(etag)
+	}
+
+	metadata, err := item.Metadata()
+	if a.NoError(err) {
+		a.Equal(bucketly.Metadata{"owner": "bucketly", "tag": "<a & b>"}, metadata)
+	}
+
+	_, err = bucket.Write(ctx, "foo/bar.txt", []byte("123"), bucketly.WithWriteMetadata(bucketly.Metadata{
+		"owner": "someone",
+	}))
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err = bucket.Stat(ctx, "foo/bar.txt")
+	if a.NoError(err) {
+		metadata, _ := item.Metadata()
+		a.Equal(bucketly.Metadata{"owner": "someone"}, metadata)
+	}
+
+	_, err = bucket.Write(ctx, "invalid.txt", []byte("123"), bucketly.WithWriteMetadata(bucketly.Metadata{
+		"not valid": "value",
+	}))
+	a.Error(err)
+}
+
+func TestBucket_Copy(t *testing.T) {
+	a := assert.New(t)
+	server := newServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	src := newBucket(t, server, "src")
+	dest := newBucket(t, server, "dest")
+
+	_, err := src.Write(ctx, "foo.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"owner": "bucketly"}))
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.NoError(dest.Copy(ctx, bucketly.NewItem(src, "foo.txt"), "copies/foo.txt")) {
+		return
+	}
+
+	item, err := dest.Stat(ctx, "copies/foo.txt")
+	if a.NoError(err) {
+		metadata, _ := item.Metadata()
+		a.Equal(bucketly.Metadata{"owner": "bucketly"}, metadata)
+	}
+
+	err = dest.Copy(ctx, bucketly.NewItem(src, "foo.txt"), "copies/bar.txt", bucketly.WithCopyMetadata(bucketly.Metadata{"owner": "someone"}))
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err = dest.Stat(ctx, "copies/bar.txt")
+	if a.NoError(err) {
+		metadata, _ := item.Metadata()
+		a.Equal(bucketly.Metadata{"owner": "someone"}, metadata)
+	}
+
+	content, err := dest.Read(ctx, "copies/bar.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+}
+
+func TestBucket_Rename(t *testing.T) {
+	a := assert.New(t)
+	server := newServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	bucket := newBucket(t, server, "bucket")
+
+	_, err := bucket.Write(ctx, "foo.txt", []byte("12345"), bucketly.WithWriteMetadata(bucketly.Metadata{"owner": "bucketly"}))
+	if !a.NoError(err) {
+		return
+	}
+
+	err = bucket.Rename(ctx, "foo.txt", "bar/foo.txt", bucketly.WithCopyMetadata(bucketly.Metadata{"owner": "someone"}))
+	if !a.NoError(err) {
+		return
+	}
+
+	item, err := bucket.Stat(ctx, "bar/foo.txt")
+	if a.NoError(err) {
+		metadata, _ := item.Metadata()
+		a.Equal(bucketly.Metadata{"owner": "someone"}, metadata)
+	}
+}
+
+func TestBucket_NewWriter(t *testing.T) {
+	a := assert.New(t)
+	server := newServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	bucket := newBucket(t, server, "bucket")
+
+	w, err := bucket.NewWriter(ctx, "foo/bar/baz.txt")
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = w.Write([]byte("12345"))
+	a.NoError(err)
+	a.NoError(w.Close())
+
+	content, err := bucket.Read(ctx, "foo/bar/baz.txt")
+	if a.NoError(err) {
+		a.Equal([]byte("12345"), content)
+	}
+}
+
+func TestBucket_WrongCredentials(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+
+	bucket, err := webdav.NewBucket("bucketly", webdav.WithEndpoint(server.URL), webdav.WithUser("bucketly"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = bucket.Stat(context.Background(), "foo.txt")
+	assert.Error(t, err)
+}
+
+func TestNewBucket_MissingEndpoint(t *testing.T) {
+	_, err := webdav.NewBucket("bucketly")
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package webdav
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+type (
+	BucketManager struct {
+		bucket *Bucket
+	}
+)
+
+func NewBucketManager(bucket *Bucket) *BucketManager {
+	return &BucketManager{bucket: bucket}
+}
+
+// Create creates the collection of the bucket, including its missing parents, under the endpoint.
+func (m *BucketManager) Create(ctx context.Context) error {
+	root := &Bucket{
+		config:   m.bucket.config,
+		endpoint: m.bucket.endpoint,
+		client:   m.bucket.client,
+	}
+
+	var current []string
+	for _, token := range strings.Split(strings.Trim(m.bucket.Name(), string(pathSeparator)), string(pathSeparator)) {
+		current = append(current, token)
+		if err := root.mkcol(ctx, strings.Join(current, string(pathSeparator))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *BucketManager) Remove(ctx context.Context) error {
+	err := m.bucket.delete(ctx, string(pathSeparator))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (m *BucketManager) Clean(ctx context.Context) error {
+	return m.bucket.RemoveAll(ctx, string(m.bucket.PathSeparator()))
+}
@@ -0,0 +1,148 @@
+package webdav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metadataNamespace is the XML namespace of the dead properties holding the item metadata.
+const metadataNamespace = "https://github.com/vcraescu/bucketly"
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:"><D:allprop/></D:propfind>`
+
+var metadataKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9._-]*$`)
+
+type (
+	multistatus struct {
+		XMLName   xml.Name   `xml:"DAV: multistatus"`
+		Responses []response `xml:"DAV: response"`
+	}
+
+	response struct {
+		Href      string     `xml:"DAV: href"`
+		Status    string     `xml:"DAV: status"`
+		Propstats []propstat `xml:"DAV: propstat"`
+	}
+
+	propstat struct {
+		Status string `xml:"DAV: status"`
+		Prop   prop   `xml:"DAV: prop"`
+	}
+
+	prop struct {
+		ResourceType  resourceType `xml:"DAV: resourcetype"`
+		ContentLength string       `xml:"DAV: getcontentlength"`
+		LastModified  string       `xml:"DAV: getlastmodified"`
+		ETag          string       `xml:"DAV: getetag"`
+		Any           []anyProp    `xml:",any"`
+	}
+
+	resourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	}
+
+	anyProp struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	}
+)
+
+func parseMultistatus(r io.Reader) ([]response, error) {
+	var ms multistatus
+	if err := xml.NewDecoder(r).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("error parsing multistatus response: %w", err)
+	}
+
+	return ms.Responses, nil
+}
+
+// parseStatus extracts the code from a status line such as "HTTP/1.1 200 OK".
+func parseStatus(status string) int {
+	fields := strings.Fields(status)
+	if len(fields) < 2 {
+		return 0
+	}
+
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+
+	return code
+}
+
+func isSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
+
+func responseError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return os.ErrNotExist
+	}
+
+	return fmt.Errorf(`%s "%s" failed: %s`, resp.Request.Method, resp.Request.URL.Path, resp.Status)
+}
+
+// drain discards the rest of the body so the connection can be reused.
+func drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func proppatchBody(set map[string]string, remove []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	buf.WriteString(`<D:propertyupdate xmlns:D="DAV:" xmlns:m="` + metadataNamespace + `">`)
+
+	if len(set) > 0 {
+		keys := make([]string, 0, len(set))
+		for k := range set {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteString("<D:set><D:prop>")
+		for _, k := range keys {
+			if !metadataKeyRegexp.MatchString(k) {
+				return nil, fmt.Errorf(`invalid metadata key "%s"`, k)
+			}
+
+			buf.WriteString("<m:" + k + ">")
+			if err := xml.EscapeText(&buf, []byte(set[k])); err != nil {
+				return nil, err
+			}
+			buf.WriteString("</m:" + k + ">")
+		}
+		buf.WriteString("</D:prop></D:set>")
+	}
+
+	if len(remove) > 0 {
+		buf.WriteString("<D:remove><D:prop>")
+		for _, k := range remove {
+			buf.WriteString("<m:" + k + "/>")
+		}
+		buf.WriteString("</D:prop></D:remove>")
+	}
+
+	buf.WriteString("</D:propertyupdate>")
+
+	return buf.Bytes(), nil
+}
+
+func isDirPath(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return true
+	}
+
+	return strings.HasSuffix(name, string(pathSeparator))
+}
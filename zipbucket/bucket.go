@@ -0,0 +1,748 @@
+package zipbucket
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vcraescu/bucketly"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pathSeparator   rune        = '/'
+	defaultFileMode os.FileMode = 0644
+	defaultDirMode  os.FileMode = 0755
+)
+
+var (
+	errReadOnly  = errors.New("archive is opened for reading")
+	errWriteOnly = errors.New("archive is opened for writing")
+)
+
+type (
+	// Bucket is either a read-only view of an existing archive, see OpenBucket and OpenItem, or a
+	// write-only archive being built, see NewBucket and CreateItem. Entries of a new archive are
+	// written one at a time: NewWriter blocks until the writer of the previous entry is closed.
+	Bucket struct {
+		name   string
+		config Config
+		closer io.Closer
+
+		reader  *zip.Reader
+		entries map[string]*entry
+
+		mu      sync.Mutex
+		writer  *zip.Writer
+		written map[string]bool
+		closed  bool
+	}
+
+	Config struct {
+		method uint16
+	}
+
+	Option func(cfg *Config)
+
+	entry struct {
+		file     *zip.File
+		dir      bool
+		children []string
+	}
+
+	entryWriter struct {
+		io.Writer
+		unlock func()
+		closed bool
+	}
+
+	listIterator struct {
+		name   string
+		bucket *Bucket
+		queue  []bucketly.Item
+	}
+)
+
+// WithMethod sets the compression method of the written entries, zip.Deflate by default.
+func WithMethod(method uint16) Option {
+	return func(cfg *Config) {
+		cfg.method = method
+	}
+}
+
+// NewBucket returns a bucket building a new archive into w. The archive is complete only after Close.
+func NewBucket(name string, w io.Writer, opts ...Option) *Bucket {
+	cfg := Config{
+		method: zip.Deflate,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Bucket{
+		name:    name,
+		config:  cfg,
+		writer:  zip.NewWriter(w),
+		written: make(map[string]bool),
+	}
+}
+
+// CreateItem builds a new archive into the item with the given name of the dest bucket.
+func CreateItem(ctx context.Context, dest bucketly.Bucket, name string, opts ...Option) (*Bucket, error) {
+	w, err := dest.NewWriter(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBucket(name, w, opts...)
+	b.closer = w
+
+	return b, nil
+}
+
+// OpenBucket returns a bucket reading the archive of the given size from r.
+func OpenBucket(name string, r io.ReaderAt, size int64) (*Bucket, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf(`error opening archive "%s": %w`, name, err)
+	}
+
+	b := &Bucket{
+		name:   name,
+		reader: zr,
+	}
+	b.index()
+
+	return b, nil
+}
+
+// OpenItem returns a bucket reading the archive stored in the item. Unless the item can be read
+// at random offsets, like a local file, the archive is loaded in memory.
+func OpenItem(ctx context.Context, item bucketly.Item) (*Bucket, error) {
+	rc, err := item.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if f, ok := rc.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			rc.Close()
+
+			return nil, err
+		}
+
+		b, err := OpenBucket(item.Name(), f, size)
+		if err != nil {
+			rc.Close()
+
+			return nil, err
+		}
+
+		b.closer = rc
+
+		return b, nil
+	}
+
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenBucket(item.Name(), bytes.NewReader(data), int64(len(data)))
+}
+
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+func (b *Bucket) PathSeparator() rune {
+	return pathSeparator
+}
+
+// StoresMetadata reports false, the metadata of the items is not kept.
+func (b *Bucket) StoresMetadata() bool {
+	return false
+}
+
+// Close writes the central directory of a new archive and closes the underlying item, if any.
+func (b *Bucket) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	var err error
+	if b.writer != nil {
+		err = b.writer.Close()
+	}
+
+	if b.closer != nil {
+		if cerr := b.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (b *Bucket) Read(ctx context.Context, name string) ([]byte, error) {
+	r, err := b.NewReader(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func (b *Bucket) NewReader(_ context.Context, name string) (io.ReadCloser, error) {
+	e, err := b.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.dir {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return e.file.Open()
+}
+
+func (b *Bucket) Write(ctx context.Context, name string, data []byte, opts ...bucketly.WriteOption) (int, error) {
+	w, err := b.NewWriter(ctx, name, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		w.Close()
+
+		return n, err
+	}
+
+	return n, w.Close()
+}
+
+func (b *Bucket) NewWriter(_ context.Context, name string, opts ...bucketly.WriteOption) (io.WriteCloser, error) {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultFileMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	if isDirPath(name) {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	return b.createEntry(name, wo.Mode, time.Now())
+}
+
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Stat(ctx, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bucket) Remove(_ context.Context, _ string) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Stat(_ context.Context, name string) (bucketly.Item, error) {
+	e, err := b.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		key = string(pathSeparator)
+	}
+
+	return b.entryToItem(key, e), nil
+}
+
+func (b *Bucket) Mkdir(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	return b.createDir(key, wo.Mode, time.Now())
+}
+
+func (b *Bucket) MkdirAll(_ context.Context, name string, opts ...bucketly.WriteOption) error {
+	wo := &bucketly.WriteOptions{
+		Mode: defaultDirMode,
+	}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return err
+	}
+
+	return b.createDirAll(key, wo.Mode, time.Now())
+}
+
+func (b *Bucket) Chmod(_ context.Context, _ string, _ os.FileMode) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) RemoveAll(_ context.Context, _ string) error {
+	return bucketly.ErrNotSupported
+}
+
+func (b *Bucket) Rename(_ context.Context, _ string, _ string, _ ...bucketly.CopyOption) error {
+	return bucketly.ErrNotSupported
+}
+
+// Copy adds the item to a new archive, keeping its mode and modification time.
+func (b *Bucket) Copy(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	co := &bucketly.CopyOptions{
+		Mode: from.Mode().Perm(),
+	}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	modTime := from.ModTime()
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	if from.IsDir() || strings.HasSuffix(from.Name(), string(from.Bucket().PathSeparator())) {
+		if co.Mode == 0 {
+			co.Mode = defaultDirMode
+		}
+
+		key, err := b.key(to)
+		if err != nil {
+			return err
+		}
+
+		return b.createDirAll(key, co.Mode, modTime)
+	}
+
+	if co.Mode == 0 {
+		co.Mode = defaultFileMode
+	}
+
+	src, err := from.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := b.createEntry(to, co.Mode, modTime)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+
+		return err
+	}
+
+	return dest.Close()
+}
+
+func (b *Bucket) CopyAll(ctx context.Context, from bucketly.Item, to string, opts ...bucketly.CopyOption) error {
+	return bucketly.CopyAll(ctx, from, bucketly.NewItem(b, to), opts...)
+}
+
+func (b *Bucket) Copy2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.Copy(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) CopyAll2(ctx context.Context, from string, to string, opts ...bucketly.CopyOption) error {
+	fromItem, err := b.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return b.CopyAll(ctx, fromItem, to, opts...)
+}
+
+func (b *Bucket) Walk(ctx context.Context, dir string, walkFunc bucketly.WalkFunc) error {
+	item, err := b.Stat(ctx, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if !item.IsDir() {
+		err = walkFunc(item, nil)
+	} else {
+		err = b.walk(item.Name(), walkFunc)
+	}
+
+	if err != nil && err != bucketly.ErrStopWalk && err != bucketly.ErrSkipWalkDir {
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bucket) Items(name string) (bucketly.ListIterator, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listIterator{
+		name:   name,
+		bucket: b,
+	}, nil
+}
+
+func (b *Bucket) walk(dir string, walkFunc bucketly.WalkFunc) error {
+	items, err := b.readDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := walkFunc(item, nil); err != nil {
+			if err == bucketly.ErrSkipWalkDir {
+				continue
+			}
+
+			return err
+		}
+
+		if !item.IsDir() {
+			continue
+		}
+
+		if err := b.walk(item.Name(), walkFunc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) readDir(dir string) ([]bucketly.Item, error) {
+	e, err := b.lookup(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]bucketly.Item, 0, len(e.children))
+	for _, key := range e.children {
+		items = append(items, b.entryToItem(key, b.entries[key]))
+	}
+
+	return items, nil
+}
+
+func (b *Bucket) lookup(name string) (*entry, error) {
+	if b.reader == nil {
+		return nil, errWriteOnly
+	}
+
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := b.entries[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return e, nil
+}
+
+// createEntry starts a new file entry, holding the lock until the returned writer is closed.
+func (b *Bucket) createEntry(name string, mode os.FileMode, modTime time.Time) (io.WriteCloser, error) {
+	key, err := b.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	b.mu.Lock()
+	if err := b.checkWritable(key); err != nil {
+		b.mu.Unlock()
+
+		return nil, err
+	}
+
+	if b.written[dirKey(key)] {
+		b.mu.Unlock()
+
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	fh := &zip.FileHeader{
+		Name:     key,
+		Method:   b.config.method,
+		Modified: modTime,
+	}
+	fh.SetMode(mode)
+
+	w, err := b.writer.CreateHeader(fh)
+	if err != nil {
+		b.mu.Unlock()
+
+		return nil, err
+	}
+
+	b.written[key] = true
+
+	return &entryWriter{
+		Writer: w,
+		unlock: b.mu.Unlock,
+	}, nil
+}
+
+func (b *Bucket) createDirAll(key string, mode os.FileMode, modTime time.Time) error {
+	if key == "" {
+		return b.createDir(key, mode, modTime)
+	}
+
+	var current []string
+	for _, token := range strings.Split(key, string(pathSeparator)) {
+		current = append(current, token)
+		if err := b.createDir(strings.Join(current, string(pathSeparator)), mode, modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Bucket) createDir(key string, mode os.FileMode, modTime time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.writer == nil {
+		return errReadOnly
+	}
+
+	if key == "" {
+		return nil
+	}
+
+	if b.written[key] {
+		return fmt.Errorf("%s is not a directory", key)
+	}
+
+	if b.written[dirKey(key)] {
+		return nil
+	}
+
+	if err := b.checkWritable(dirKey(key)); err != nil {
+		return err
+	}
+
+	fh := &zip.FileHeader{
+		Name:     dirKey(key),
+		Method:   zip.Store,
+		Modified: modTime,
+	}
+	fh.SetMode(os.ModeDir | mode.Perm())
+
+	if _, err := b.writer.CreateHeader(fh); err != nil {
+		return err
+	}
+
+	b.written[dirKey(key)] = true
+
+	return nil
+}
+
+func (b *Bucket) checkWritable(key string) error {
+	if b.writer == nil {
+		return errReadOnly
+	}
+
+	if b.closed {
+		return errors.New("archive is closed")
+	}
+
+	if b.written[key] {
+		return fmt.Errorf("%s already exists in the archive", key)
+	}
+
+	return nil
+}
+
+// index builds the directory tree of the archive, adding the directories without an entry of their own.
+func (b *Bucket) index() {
+	b.entries = map[string]*entry{
+		"": {dir: true},
+	}
+
+	for _, f := range b.reader.File {
+		key := cleanKey(f.Name)
+		if key == "" {
+			continue
+		}
+
+		dir := strings.HasSuffix(f.Name, string(pathSeparator)) || f.FileInfo().IsDir()
+		if e, ok := b.entries[key]; ok {
+			e.file = f
+			e.dir = e.dir || dir
+
+			continue
+		}
+
+		b.entries[key] = &entry{file: f, dir: dir}
+		b.addParents(key)
+	}
+
+	for _, e := range b.entries {
+		sort.Strings(e.children)
+	}
+}
+
+func (b *Bucket) addParents(key string) {
+	for {
+		parent := ""
+		if i := strings.LastIndexByte(key, byte(pathSeparator)); i >= 0 {
+			parent = key[:i]
+		}
+
+		p, ok := b.entries[parent]
+		if !ok {
+			p = &entry{dir: true}
+			b.entries[parent] = p
+		}
+
+		p.dir = true
+		p.children = append(p.children, key)
+		if ok || parent == "" {
+			return
+		}
+
+		key = parent
+	}
+}
+
+func (b *Bucket) key(name string) (string, error) {
+	name, err := bucketly.Sanitize(b, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Trim(name, string(pathSeparator)), nil
+}
+
+func (b *Bucket) entryToItem(name string, e *entry) bucketly.Item {
+	item := bucketly.NewItem(b, name)
+	item.SetDir(e.dir)
+	item.SetMetadata(bucketly.Metadata{})
+
+	if e.file == nil {
+		item.SetMode(os.ModeDir | defaultDirMode)
+
+		return item
+	}
+
+	item.SetMode(e.file.Mode())
+	item.SetModeTime(e.file.Modified)
+	item.SetETag(fmt.Sprintf("%08x", e.file.CRC32))
+	item.SetSys(&e.file.FileHeader)
+	if !e.dir {
+		item.SetSize(int64(e.file.UncompressedSize64))
+	}
+
+	return item
+}
+
+func (w *entryWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+	w.unlock()
+
+	return nil
+}
+
+func (i *listIterator) Next(ctx context.Context) (bucketly.Item, error) {
+	if i.queue == nil {
+		item, err := i.bucket.Stat(ctx, i.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !item.IsDir() {
+			i.queue = make([]bucketly.Item, 0)
+
+			return item, nil
+		}
+
+		i.queue, err = i.bucket.readDir(i.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(i.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	item := i.queue[0]
+	i.queue = i.queue[1:]
+
+	return item, nil
+}
+
+func (i *listIterator) Close() error {
+	i.queue = nil
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package zipbucket_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vcraescu/bucketly"
+	"github.com/vcraescu/bucketly/memory"
+	"github.com/vcraescu/bucketly/zipbucket"
+	"os"
+	"testing"
+	"time"
+)
+
+func walk(ctx context.Context, bucket bucketly.Walkable, name string) ([]string, error) {
+	var names []string
+	err := bucket.Walk(ctx, name, func(item bucketly.Item, err error) error {
+		names = append(names, item.Name())
+
+		return nil
+	})
+
+	return names, err
+}
+
+func TestBucket_RoundTrip(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	src := memory.NewBucket("src")
+	files := map[string]os.FileMode{
+		"export/a.txt":         0644,
+		"export/bin/run.sh":    0755,
+		"export/docs/b/c.html": 0600,
+	}
+	for name, mode := range files {
+		if _, err := src.Write(ctx, name, []byte(name), bucketly.WithWriteMode(mode)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive, err := zipbucket.CreateItem(ctx, src, "export.zip")
+	if !a.NoError(err) {
+		return
+	}
+
+	if !a.NoError(archive.CopyAll(ctx, bucketly.NewItem(src, "export/"), "")) {
+		return
+	}
+
+	if !a.NoError(archive.Close()) {
+		return
+	}
+
+	item, err := src.Stat(ctx, "export.zip")
+	if !a.NoError(err) {
+		return
+	}
+
+	archive, err = zipbucket.OpenItem(ctx, item)
+	if !a.NoError(err) {
+		return
+	}
+	defer archive.Close()
+
+	names, err := walk(ctx, archive, "/")
+	if a.NoError(err) {
+		a.Equal([]string{"a.txt", "bin", "bin/run.sh", "docs", "docs/b", "docs/b/c.html"}, names)
+	}
+
+	for name, mode := range files {
+		key := name[len("export/"):]
+		item, err := archive.Stat(ctx, key)
+		if !a.NoError(err, name) {
+			continue
+		}
+
+		original, _ := src.Stat(ctx, name)
+		a.Equal(mode, item.Mode(), name)
+		a.Equal(int64(len(name)), item.Size(), name)
+		a.WithinDuration(original.ModTime(), item.ModTime(), 2*time.Second, name)
+
+		content, err := archive.Read(ctx, key)
+		if a.NoError(err, name) {
+			a.Equal([]byte(name), content, name)
+		}
+	}
+
+	_, err = archive.Write(ctx, "foo.txt", []byte("12345"))
+	a.Error(err)
+
+	dest := memory.NewBucket("dest")
+	if !a.NoError(dest.CopyAll(ctx, bucketly.NewItem(archive, "/"), "restore/")) {
+		return
+	}
+
+	content, err := dest.Read(ctx, "restore/docs/b/c.html")
+	if a.NoError(err) {
+		a.Equal([]byte("export/docs/b/c.html"), content)
+	}
+}
+
+func TestBucket_ImplicitDirs(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"foo/bar/baz.txt", "./foo/qux.txt", "top.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write([]byte("12345")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zipbucket.OpenBucket("test.zip", bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !a.NoError(err) {
+		return
+	}
+
+	names, err := walk(ctx, archive, "")
+	if a.NoError(err) {
+		a.Equal([]string{"foo", "foo/bar", "foo/bar/baz.txt", "foo/qux.txt", "top.txt"}, names)
+	}
+
+	item, err := archive.Stat(ctx, "foo/bar/")
+	if a.NoError(err) {
+		a.True(item.IsDir())
+	}
+
+	_, err = archive.Stat(ctx, "missing.txt")
+	a.True(os.IsNotExist(err))
+}
+
+func TestBucket_Write(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	archive := zipbucket.NewBucket("test.zip", &buf, zipbucket.WithMethod(zip.Store))
+	_, err := archive.Write(ctx, "foo/bar.txt", []byte("12345"), bucketly.WithWriteMode(0600))
+	a.NoError(err)
+	a.NoError(archive.MkdirAll(ctx, "foo/empty/"))
+
+	_, err = archive.Write(ctx, "foo/bar.txt", []byte("12345"))
+	a.Error(err)
+
+	_, err = archive.Stat(ctx, "foo/bar.txt")
+	a.Error(err)
+
+	if !a.NoError(archive.Close()) {
+		return
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !a.NoError(err) {
+		return
+	}
+
+	if a.Len(zr.File, 3) {
+		a.Equal("foo/bar.txt", zr.File[0].Name)
+		a.Equal(zip.Store, zr.File[0].Method)
+		a.Equal(os.FileMode(0600), zr.File[0].Mode())
+		a.Equal("foo/", zr.File[1].Name)
+		a.Equal("foo/empty/", zr.File[2].Name)
+	}
+}
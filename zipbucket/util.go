@@ -0,0 +1,27 @@
+package zipbucket
+
+import (
+	"path"
+	"strings"
+)
+
+// cleanKey turns the name of an archive entry into a key without leading or trailing separators.
+func cleanKey(name string) string {
+	name = strings.ReplaceAll(name, `\`, string(pathSeparator))
+	name = path.Clean(string(pathSeparator) + name)
+
+	return strings.Trim(name, string(pathSeparator))
+}
+
+func isDirPath(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return true
+	}
+
+	return strings.HasSuffix(name, string(pathSeparator))
+}
+
+func dirKey(key string) string {
+	return key + string(pathSeparator)
+}